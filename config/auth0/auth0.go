@@ -30,10 +30,10 @@ type Auth0Config struct {
 }
 
 func (c *Auth0Config) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&c.Domain, "auth0.domain", env.GetEnvStrDefault("AUTH0_DOMAIN", DefaultAuth0Domain), "hostname:port to connect to the nomad server")
-	f.StringVar(&c.Token, "auth0.token", env.GetEnvStrDefault("AUTH0_TOKEN", ""), "Token to use to authenticate to auth0 (can be used instead of auth0.client_id + auth0.client_secret)")
-	f.StringVar(&c.ClientID, "auth0.client_id", env.GetEnvStrDefault("AUTH0_CLIENT_ID", ""), "Auth0 Management Client ID to authenticate to auth0 (can be used instead of auth0.token)")
-	f.StringVar(&c.ClientSecret, "auth0.client_secret", env.GetEnvStrDefault("AUTH0_CLIENT_SECRET", ""), "Auth0 Management Client Secret with capability to create users (can be used ins tead of auth0.client_token")
+	env.StringVar(f, &c.Domain, "auth0.domain", "AUTH0_DOMAIN", DefaultAuth0Domain, "hostname:port to connect to the nomad server")
+	env.StringVar(f, &c.Token, "auth0.token", "AUTH0_TOKEN", "", "Token to use to authenticate to auth0 (can be used instead of auth0.client_id + auth0.client_secret)")
+	env.StringVar(f, &c.ClientID, "auth0.client_id", "AUTH0_CLIENT_ID", "", "Auth0 Management Client ID to authenticate to auth0 (can be used instead of auth0.token)")
+	env.StringVar(f, &c.ClientSecret, "auth0.client_secret", "AUTH0_CLIENT_SECRET", "", "Auth0 Management Client Secret with capability to create users (can be used ins tead of auth0.client_token")
 }
 
 func (c *Auth0Config) Validate() error {
@@ -13,7 +13,13 @@ import (
 type RetryPolicy struct {
 	MaxRetries    int `toml:"max_retries"`
 	MinRetryDelay int `toml:"min_retry_delay"`
-	MaxRetryDelay int `toml:"MaxRetryDelay"`
+	MaxRetryDelay int `toml:"max_retry_delay"`
+}
+
+// KeyAliases keeps configuration files written before MaxRetryDelay was
+// renamed to max_retry_delay working, see config.KeyAliaser.
+func (p *RetryPolicy) KeyAliases() map[string]string {
+	return map[string]string{"MaxRetryDelay": "max_retry_delay"}
 }
 
 type RatelimitConfiguration struct {
@@ -33,8 +39,8 @@ type CloudflareConfig struct {
 }
 
 func (c *CloudflareConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&c.Token, "cloudflare.token", env.GetEnvStrDefault("CLOUDFLARE_API_TOKEN", ""), "Cloudflare API token toauthenticate")
-	f.StringVar(&c.BaseURL, "cloudflare.base-url", env.GetEnvStrDefault("CLOUDFLARE_BASE_URL", ""), "Base URL to use for requests. normally used by tests")
+	env.StringVar(f, &c.Token, "cloudflare.token", "CLOUDFLARE_API_TOKEN", "", "Cloudflare API token toauthenticate")
+	env.StringVar(f, &c.BaseURL, "cloudflare.base-url", "CLOUDFLARE_BASE_URL", "", "Base URL to use for requests. normally used by tests")
 }
 
 func (c *CloudflareConfig) Validate() error {
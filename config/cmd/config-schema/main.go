@@ -0,0 +1,102 @@
+// Command config-schema prints the JSON Schema of a configuration type (see
+// config.GenerateSchema). It must be run from inside the module that
+// contains the type:
+//
+//	go run github.com/bloominlabs/baseplate-go/config/cmd/config-schema \
+//		-type github.com/acme/app/internal/config.Config -o config.schema.json
+//
+// The type is referenced by a small generated program that is run with
+// `go run` in a temporary directory of the current module, since Go cannot
+// load types at runtime.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/template"
+)
+
+var program = template.Must(template.New("main").Parse(`package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bloominlabs/baseplate-go/config"
+
+	target {{ printf "%q" .Package }}
+)
+
+func main() {
+	schema, err := config.GenerateSchema(&target.{{ .Type }}{})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(schema); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`))
+
+func main() {
+	var typeName, output string
+	flag.StringVar(&typeName, "type", "", "fully qualified configuration type, e.g. github.com/acme/app/internal/config.Config")
+	flag.StringVar(&output, "o", "", "file to write the schema to. defaults to stdout")
+	flag.Parse()
+
+	if err := run(typeName, output); err != nil {
+		slog.Error("failed to generate the configuration schema", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(typeName, output string) error {
+	i := strings.LastIndex(typeName, ".")
+	if i <= 0 || i <= strings.LastIndex(typeName, "/") {
+		return fmt.Errorf("-type must be <package path>.<type name>, got %q", typeName)
+	}
+
+	dir, err := os.MkdirTemp(".", "config-schema-")
+	if err != nil {
+		return fmt.Errorf("failed to create a temporary directory: %w", err)
+	}
+	defer os.RemoveAll(dir)
+
+	f, err := os.Create(filepath.Join(dir, "main.go"))
+	if err != nil {
+		return err
+	}
+	err = program.Execute(f, struct{ Package, Type string }{typeName[:i], typeName[i+1:]})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the generator program: %w", err)
+	}
+
+	out := os.Stdout
+	if output != "" {
+		out, err = os.Create(output)
+		if err != nil {
+			return err
+		}
+		defer out.Close()
+	}
+
+	cmd := exec.Command("go", "run", "./"+filepath.ToSlash(dir))
+	cmd.Stdout = out
+	cmd.Stderr = os.Stderr
+
+	return cmd.Run()
+}
@@ -1,7 +1,6 @@
 package config
 
 import (
-	"bytes"
 	"context"
 	"errors"
 	"flag"
@@ -10,12 +9,8 @@ import (
 	"log/slog"
 	"os"
 	"path/filepath"
-	"time"
 
-	"github.com/pelletier/go-toml/v2"
-	"github.com/rs/zerolog"
-
-	"github.com/bloominlabs/baseplate-go/config/filesystem"
+	"github.com/bloominlabs/baseplate-go/config/env"
 )
 
 const ConfigFileFlag = "config.file"
@@ -35,6 +30,10 @@ type Configuration interface {
 // Merge should apply non-zero fields from the decoded config onto the
 // receiver. The argument is a pointer to a new zero-value of the same type,
 // decoded from the updated config file.
+//
+// ParseValue is an alternative to Merge that swaps whole immutable snapshots
+// instead, see Value. Configurations whose Merge can fail half way should
+// also implement Snapshotter so a failed reload is rolled back.
 type WatchableConfiguration interface {
 	Configuration
 	Merge(decoded WatchableConfiguration) error
@@ -43,21 +42,34 @@ type WatchableConfiguration interface {
 // ParseConfigFileParameter parses -config.file option via separate flag set, to avoid polluting default
 // one and calling flag.Parse on it twice.
 func ParseConfigFileParameter(args []string) (configFile string) {
+	return parseFlagParameter(
+		args,
+		ConfigFileFlag,
+		"a toml, yaml or json configuration file to read the default configurations from. If specified, changes to this will be watched by a filesystem watcher",
+	)
+}
+
+// ParseConfigFormatParameter parses the -config.format option the same way
+// ParseConfigFileParameter parses -config.file.
+func ParseConfigFormatParameter(args []string) (format string) {
+	return parseFlagParameter(
+		args,
+		ConfigFormatFlag,
+		"the format of the configuration file (toml, yaml or json). detected from the file extension when empty",
+	)
+}
+
+func parseFlagParameter(args []string, name, usage string) (value string) {
 	// ignore errors and any output here. Any flag errors will be reported by main flag.Parse() call.
 	fs := flag.NewFlagSet("", flag.ContinueOnError)
 	fs.SetOutput(io.Discard)
 
 	// usage not used in these functions.
-	fs.StringVar(
-		&configFile,
-		ConfigFileFlag,
-		"",
-		"a toml configuration file to read the default configurations from. If specified, changes to this will be watched by a filesystem watcher",
-	)
+	fs.StringVar(&value, name, "", usage)
 
-	// Try to find -config.file option in the flags. As Parsing stops on the
-	// first error, eg. unknown flag, we simply try remaining parameters until
-	// we find config flag, or there are no params left.
+	// Try to find the option in the flags. As Parsing stops on the first
+	// error, eg. unknown flag, we simply try remaining parameters until we
+	// find the flag, or there are no params left.
 	for len(args) > 0 {
 		_ = fs.Parse(args)
 		args = args[1:]
@@ -66,113 +78,165 @@ func ParseConfigFileParameter(args []string) (configFile string) {
 	return
 }
 
-// ParseConfiguration parses flags and an optional config file. If cfg
-// implements WatchableConfiguration and a config file is specified, a
-// background goroutine watches the file for changes and calls Merge
+// ParseConfiguration parses flags and optional config files. -config.file
+// may be repeated, and may point at a directory of configuration fragments,
+// to layer several files on top of each other (see DecodeConfigurationFiles).
+// If cfg implements WatchableConfiguration and config files are specified, a
+// background goroutine watches every file for changes and calls Merge
 // automatically. The goroutine is canceled when ctx is canceled.
-func ParseConfiguration[T WatchableConfiguration](ctx context.Context, cfg T, createCfg func() T) error {
-	configFile, err := filepath.Abs(ParseConfigFileParameter(os.Args[1:]))
+//
+// A reload rebuilds a new configuration with createCfg using the same
+// precedence as the initial parse: flag defaults and environment variables,
+// then the config files, then the original command line flags. Only that
+// result is passed to Merge. When createCfg is nil, a new zero value of the
+// type cfg points to is used.
+//
+// The values of secret fields that are secret references, e.g.
+// file:///secrets/db_password or env://STRIPE_KEY, are replaced by the secret
+// they point to when a resolver is registered for their scheme (see
+// WithSecretResolver). Files read by file:// references are watched too.
+//
+// The dotenv files given with -env.file, or else listed in
+// BASEPLATE_ENV_FILE, are loaded into the environment before RegisterFlags
+// runs, so the flag defaults read from the environment pick them up. Real
+// environment variables win over the files (see env.LoadFiles).
+//
+// Passing -config.explain prints where every configuration value came from
+// (see Provenance) and exits. Passing -help.env prints the environment
+// variables read while registering the flags and exits. Variables sharing a
+// prefix with those but never read are logged as likely typos, see
+// WithEnvPrefixes.
+//
+// WithRemoteSourceFlag layers documents that do not live in local files, e.g.
+// a Consul KV key, on top of the config files (see RemoteSource).
+//
+// WithReloadOnSignal additionally reloads the configuration on SIGHUP, and
+// WithReloadHook reports the outcome of every reload. Reloads are counted in
+// OpenTelemetry metrics, and WithReloadStatus records the last error and the
+// last successful reload, e.g. for StatusHandler.
+//
+// ParseConfiguration reads os.Args, registers flags on flag.CommandLine and
+// logs to slog.Default(). Use a Parser to load configuration without
+// touching those globals.
+func ParseConfiguration[T WatchableConfiguration](ctx context.Context, cfg T, createCfg func() T, opts ...ParseOption) error {
+	var p Parser
+	for _, opt := range opts {
+		opt(&p)
+	}
+
+	var create func() WatchableConfiguration
+	if createCfg != nil {
+		create = func() WatchableConfiguration {
+			return createCfg()
+		}
+	}
+
+	err := p.Parse(ctx, cfg, create)
+	if errors.Is(err, ErrExplained) {
+		os.Exit(0)
+	}
+
+	return err
+}
+
+// registerParameterFlags registers the flags read by the Parse*Parameter
+// functions so flag.Parse does not reject them.
+func registerParameterFlags(f *flag.FlagSet) {
+	IgnoredFlag(f, ConfigFileFlag, "Configuration file to load. May be repeated or point at a directory to layer several files.")
+	IgnoredFlag(f, ConfigFormatFlag, "Format of the configuration file (toml, yaml or json).")
+	IgnoredBoolFlag(f, ConfigExplainFlag, "Print where every configuration value came from and exit.")
+	IgnoredFlag(f, EnvFileFlag, "Dotenv file to load environment variables from. May be repeated. Defaults to the comma separated files of "+env.EnvFileVariable+".")
+	IgnoredBoolFlag(f, EnvHelpFlag, "Print the environment variables the configuration reads and exit.")
+}
+
+// reloadConfiguration rebuilds cfg, which should be a new zero value, with
+// the same precedence as the initial parse: flag defaults (which include the
+// environment), then files, then the command line arguments. It uses its own
+// flag set and never touches base, the flag set of the initial parse.
+func reloadConfiguration(cfg Configuration, base *flag.FlagSet, files []string, args []string, opts decodeOptions) (decodeResult, error) {
+	fs := flag.NewFlagSet("reload", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	cfg.RegisterFlags(fs)
+	if err := envError(); err != nil {
+		return decodeResult{}, err
+	}
+	decoded, err := decodeFiles(files, cfg, opts)
 	if err != nil {
-		return fmt.Errorf("failed to get absolute path for config file: %w", err)
+		return decoded, err
 	}
 
-	// This sets default values from flags to the config.
-	// It needs to be called before parsing the config file!
-	cfg.RegisterFlags(flag.CommandLine)
-	if configFile != "" {
-		err := DecodeConfiguration(configFile, cfg)
-		if err != nil {
-			return fmt.Errorf("failed to read %s: %w", configFile, err)
+	registerParameterFlags(fs)
+	// flags the application registered on base itself are not part of cfg,
+	// accept and ignore them so args still parse.
+	base.VisitAll(func(f *flag.Flag) {
+		if fs.Lookup(f.Name) != nil {
+			return
 		}
+		if b, ok := f.Value.(interface{ IsBoolFlag() bool }); ok && b.IsBoolFlag() {
+			IgnoredBoolFlag(fs, f.Name, f.Usage)
+		} else {
+			IgnoredFlag(fs, f.Name, f.Usage)
+		}
+	})
+
+	if err := fs.Parse(args); err != nil {
+		return decoded, fmt.Errorf("failed to parse command line arguments: %w", err)
 	}
 
-	IgnoredFlag(flag.CommandLine, ConfigFileFlag, "Configuration file to load.")
-	flag.Parse()
+	return decoded, nil
+}
 
-	// If the config supports merging AND a config file was specified, start
-	// a watcher goroutine.
-	if configFile != "" {
-		// NewRateLimitedFileWatcher still requires zerolog.Logger — pass Nop
-		// until the filesystem package is migrated.
-		w, err := filesystem.NewRateLimitedFileWatcher([]string{configFile}, zerolog.Nop(), time.Second*5)
+// watchedPaths returns the files and directories the config watcher should
+// watch: every expanded file plus any directory given in -config.file.
+func watchedPaths(fsys FileSystem, paths []string, files []string) []string {
+	watched := append([]string{}, files...)
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
 		if err != nil {
-			return fmt.Errorf("failed to create file watcher for %s: %w", configFile, err)
+			continue
+		}
+		if info, err := fsys.Stat(abs); err == nil && info.IsDir() {
+			watched = append(watched, abs)
 		}
-
-		w.Start(ctx)
-
-		go func() {
-			for {
-				logger := slog.Default()
-				select {
-				case <-ctx.Done():
-					if err := w.Stop(); err != nil {
-						logger.Error("failed to stop file watcher",
-							"file", configFile,
-							"error", err,
-						)
-					}
-					return
-				case event := <-w.EventsCh():
-					newConfig := createCfg()
-					logger.Debug("config file changed, reloading",
-						"files", event.Filenames,
-					)
-
-					// register the flags so that newConfig gets the appropriate defaults
-					flag.CommandLine = flag.NewFlagSet(os.Args[0], flag.ExitOnError)
-					newConfig.RegisterFlags(flag.NewFlagSet("testtesttest", flag.ContinueOnError))
-
-					if err := DecodeConfiguration(configFile, &newConfig); err != nil {
-						logger.Error("failed to decode updated config file",
-							"file", configFile,
-							"error", err,
-						)
-						continue
-					}
-
-					if err := newConfig.Validate(); err != nil {
-						logger.Error("updated config failed validation",
-							"file", configFile,
-							"error", err,
-						)
-						continue
-					}
-
-					if err := cfg.Merge(newConfig); err != nil {
-						logger.Error(
-							"failed to merge configuration",
-							slog.String("err", err.Error()),
-						)
-						continue
-					}
-
-					logger.Info("config file reloaded successfully",
-						"file", configFile,
-					)
-				}
-			}
-		}()
 	}
 
-	return nil
+	return watched
 }
 
-func DecodeConfiguration(file string, config any) error {
-	out, err := os.ReadFile(file)
-	if err != nil {
-		return fmt.Errorf("failed to read configuration file %s: %w", file, err)
+type decodeOptions struct {
+	ctx       context.Context
+	fs        FileSystem
+	format    Format
+	resolvers map[string]SecretResolver
+	sources   []RemoteSource
+
+	interpolation interpolationMode
+	logger        *slog.Logger
+}
+
+func (o decodeOptions) fileSystem() FileSystem {
+	if o.fs == nil {
+		return OSFileSystem{}
 	}
 
-	err = toml.NewDecoder(bytes.NewReader(out)).DisallowUnknownFields().Decode(config)
-	if err != nil {
-		var details *toml.StrictMissingError
-		if !errors.As(err, &details) {
-			return fmt.Errorf("err should have been a *toml.StrictMissingError, but got %s (%T)", err, err)
-		}
+	return o.fs
+}
 
-		return fmt.Errorf("failed to decode the configuration file: \n%s", details.String())
+// DecodeOption configures the behavior of DecodeConfiguration.
+type DecodeOption func(*decodeOptions)
+
+// WithFormat forces the format of the configuration file instead of detecting
+// it from the file extension. An empty Format keeps the detection.
+func WithFormat(format Format) DecodeOption {
+	return func(o *decodeOptions) {
+		o.format = format
 	}
+}
 
-	return nil
+// DecodeConfiguration decodes file into config. The format is detected from
+// the file extension (see FormatFromPath) unless WithFormat is given. Every
+// format is decoded using the `toml` struct tags and rejects unknown fields.
+func DecodeConfiguration(file string, config any, opts ...DecodeOption) error {
+	return DecodeConfigurationFiles([]string{file}, config, opts...)
 }
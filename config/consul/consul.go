@@ -1,27 +1,38 @@
 package consul
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
+	"net/http"
+	"strings"
 	"sync"
 
 	"github.com/hashicorp/consul/api"
 
-	"github.com/bloominlabs/baseplate-go/config/env"
+	"github.com/bloominlabs/baseplate-go/config"
 )
 
 type ConsulConfig struct {
 	sync.RWMutex
 
-	Address string `toml:"address"`
-	Token   string `toml:"token"`
-	SSL     bool   `toml:"use_ssl"`
+	Address string `toml:"address" flag:"addr" env:"CONSUL_HTTP_ADDR" default:"localhost:8500" usage:"hostname:port to connect to the consul server"`
+	Token   string `toml:"token" env:"CONSUL_HTTP_TOKEN" usage:"Token to use to authenticate to consul"`
+	SSL     bool   `toml:"use_ssl" flag:"ssl" env:"CONSUL_HTTP_SSL" usage:"use https to connect to the consul server"`
 	client  *api.Client
 }
 
 func (c *ConsulConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&c.Address, "consul.addr", env.GetEnvStrDefault("CONSUL_HTTP_ADDR", "localhost:8500"), "hostname:port to connect to the consul server")
-	f.StringVar(&c.Token, "consul.token", env.GetEnvStrDefault("CONSUL_HTTP_TOKEN", ""), "Token to use to authenticate to consul")
-	f.BoolVar(&c.SSL, "consul.ssl", env.GetEnvBoolDefault("CONSUL_HTTP_SSL", false), "Token to use to authenticate to consul")
+	config.RegisterStructFlags(f, "consul", c)
+}
+
+func (c *ConsulConfig) Validate() error {
+	if c.Address == "" {
+		return config.FieldError("address", "no consul address provided. did you specify '-consul.addr' or 'CONSUL_HTTP_ADDR'?")
+	}
+
+	return nil
 }
 
 func (c *ConsulConfig) Merge(other *ConsulConfig) error {
@@ -38,6 +49,46 @@ func (c *ConsulConfig) Merge(other *ConsulConfig) error {
 	return nil
 }
 
+// Preflight checks that consul accepts the address and token of other before
+// Merge swaps them in, by reading the token itself. Clusters without ACLs
+// pass the check as long as they can be reached.
+func (c *ConsulConfig) Preflight(ctx context.Context, other *ConsulConfig) error {
+	c.RLock()
+	candidate := &ConsulConfig{Address: other.Address, Token: other.Token, SSL: c.SSL}
+	c.RUnlock()
+
+	client, err := candidate.CreateClient()
+	if err != nil {
+		return fmt.Errorf("failed to create consul client: %w", err)
+	}
+
+	_, _, err = client.ACL().TokenReadSelf((&api.QueryOptions{}).WithContext(ctx))
+	var statusErr api.StatusError
+	if errors.As(err, &statusErr) && statusErr.Code == http.StatusUnauthorized && strings.Contains(statusErr.Body, "ACL support disabled") {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("consul at %s rejected the token: %w", candidate.Address, err)
+	}
+
+	return nil
+}
+
+// Snapshot captures the address, token and client so a composite
+// configuration can restore them when a later step of its Merge fails.
+func (c *ConsulConfig) Snapshot() (config.Snapshot, error) {
+	c.RLock()
+	address, token, client := c.Address, c.Token, c.client
+	c.RUnlock()
+
+	return config.SnapshotFunc(func() error {
+		c.Lock()
+		c.Address, c.Token, c.client = address, token, client
+		c.Unlock()
+		return nil
+	}), nil
+}
+
 func (c *ConsulConfig) CreateClient() (*api.Client, error) {
 	config := api.DefaultConfig()
 	config.Address = c.Address
@@ -0,0 +1,145 @@
+package consul
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config"
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+func TestConsulConfigInvalidSSL(t *testing.T) {
+	t.Setenv("CONSUL_HTTP_SSL", "sometimes")
+
+	var c ConsulConfig
+	c.RegisterFlags(flag.NewFlagSet("test", flag.ContinueOnError))
+	if c.SSL {
+		t.Error("SSL = true, want an invalid CONSUL_HTTP_SSL to fall back to false")
+	}
+}
+
+// newACLServer returns a consul server that only knows the "valid" token,
+// and has ACLs disabled for requests without one.
+func newACLServer(t *testing.T) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/acl/token/self" {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Header.Get("X-Consul-Token") {
+		case "valid":
+			_, _ = w.Write([]byte(`{"AccessorID": "6a1253d2-1785-24fd-91c2-f8e78c745511"}`))
+		case "":
+			http.Error(w, "ACL support disabled", http.StatusUnauthorized)
+		default:
+			http.Error(w, "ACL not found", http.StatusForbidden)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	return srv
+}
+
+func TestConsulConfigPreflight(t *testing.T) {
+	address := strings.TrimPrefix(newACLServer(t).URL, "http://")
+	c := &ConsulConfig{Address: address, Token: "valid"}
+
+	for token, ok := range map[string]bool{"valid": true, "": true, "revoked": false} {
+		err := c.Preflight(context.Background(), &ConsulConfig{Address: address, Token: token})
+		if ok && err != nil {
+			t.Errorf("Preflight(%q) error: %v", token, err)
+		}
+		if !ok && err == nil {
+			t.Errorf("Preflight(%q) accepted a rejected token", token)
+		}
+	}
+}
+
+type preflightedConfig struct {
+	Consul ConsulConfig `toml:"consul"`
+}
+
+func (c *preflightedConfig) RegisterFlags(f *flag.FlagSet) {
+	c.Consul.RegisterFlags(f)
+}
+
+func (c *preflightedConfig) Validate() error {
+	return c.Consul.Validate()
+}
+
+func (c *preflightedConfig) Merge(o config.WatchableConfiguration) error {
+	return c.Consul.Merge(&o.(*preflightedConfig).Consul)
+}
+
+func (c *preflightedConfig) Preflight(ctx context.Context, o config.WatchableConfiguration) error {
+	return config.PreflightFields(ctx, c, o)
+}
+
+type fakeWatcher struct {
+	eventsCh chan *filesystem.FileWatcherEvent
+}
+
+func (w *fakeWatcher) Start(context.Context)                       {}
+func (w *fakeWatcher) Stop() error                                 { return nil }
+func (w *fakeWatcher) Add(string) error                            { return nil }
+func (w *fakeWatcher) Remove(string)                               {}
+func (w *fakeWatcher) Replace(string, string) error                { return nil }
+func (w *fakeWatcher) EventsCh() chan *filesystem.FileWatcherEvent { return w.eventsCh }
+
+func TestParserPreflightsConsulConfig(t *testing.T) {
+	address := strings.TrimPrefix(newACLServer(t).URL, "http://")
+	file := filepath.Join(t.TempDir(), "config.toml")
+	write := func(token string) {
+		content := fmt.Sprintf("[consul]\naddress = %q\ntoken = %q\n", address, token)
+		if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("valid")
+
+	w := &fakeWatcher{eventsCh: make(chan *filesystem.FileWatcherEvent)}
+	events := make(chan config.ReloadEvent, 1)
+	p := config.NewParser(config.WithReloadHook(func(e config.ReloadEvent) {
+		events <- e
+	}))
+	p.Args = []string{"-config.file", file}
+	p.FlagSet = flag.NewFlagSet("test", flag.ContinueOnError)
+	p.Logger = slog.New(slog.NewTextHandler(io.Discard, nil))
+	p.NewWatcher = func([]string) (filesystem.Watcher, error) {
+		return w, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &preflightedConfig{}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	write("revoked")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{file}}
+
+	select {
+	case e := <-events:
+		if e.Err == nil || e.Stage != config.ReloadStagePreflight || !strings.Contains(e.Err.Error(), "consul: consul at "+address+" rejected the token") {
+			t.Errorf("event = %+v, want a failed preflight of the consul token", e)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload hook was not called")
+	}
+	if cfg.Consul.Token != "valid" {
+		t.Errorf("Token = %q, want the previous token", cfg.Consul.Token)
+	}
+}
@@ -2,16 +2,27 @@ module github.com/bloominlabs/baseplate-go/config/consul
 
 go 1.20
 
+replace github.com/bloominlabs/baseplate-go/config => ../
+
 replace github.com/bloominlabs/baseplate-go/config/env => ../env/
 
+replace github.com/bloominlabs/baseplate-go/config/filesystem => ../filesystem/
+
+replace github.com/bloominlabs/baseplate-go/tlsutil => ../../tlsutil/
+
 require (
-	github.com/bloominlabs/baseplate-go/config/env v0.0.0-20230419034715-89fcb81782b1
+	github.com/bloominlabs/baseplate-go/config v0.0.0-20230503052152-c8c9a5e78cd3
+	github.com/bloominlabs/baseplate-go/config/filesystem v0.0.0-20230419034715-89fcb81782b1
 	github.com/hashicorp/consul/api v1.28.2
 )
 
 require (
 	github.com/armon/go-metrics v0.4.1 // indirect
+	github.com/bloominlabs/baseplate-go/config/env v0.0.0-20230503052152-c8c9a5e78cd3 // indirect
 	github.com/fatih/color v1.15.0 // indirect
+	github.com/fsnotify/fsnotify v1.7.0 // indirect
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
 	github.com/hashicorp/errwrap v1.1.0 // indirect
 	github.com/hashicorp/go-cleanhttp v0.5.2 // indirect
 	github.com/hashicorp/go-hclog v1.5.0 // indirect
@@ -21,9 +32,15 @@ require (
 	github.com/hashicorp/golang-lru v0.5.4 // indirect
 	github.com/hashicorp/serf v0.10.1 // indirect
 	github.com/mattn/go-colorable v0.1.13 // indirect
-	github.com/mattn/go-isatty v0.0.18 // indirect
+	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mitchellh/go-homedir v1.1.0 // indirect
 	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/pelletier/go-toml/v2 v2.0.7 // indirect
+	github.com/rs/zerolog v1.33.0 // indirect
+	go.opentelemetry.io/otel v1.24.0 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	go.opentelemetry.io/otel/trace v1.24.0 // indirect
 	golang.org/x/exp v0.0.0-20230817173708-d852ddb80c63 // indirect
-	golang.org/x/sys v0.15.0 // indirect
+	golang.org/x/sys v0.24.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
@@ -0,0 +1,239 @@
+package consul
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/consul/api"
+
+	"github.com/bloominlabs/baseplate-go/config"
+)
+
+// ConfigKeyFlag is the parameter WithKVSource reads the Consul KV key from.
+const ConfigKeyFlag = "config.consul-key"
+
+// KVSource is a config.RemoteSource reading the configuration from a key in
+// Consul KV. The key is watched with blocking queries. When Consul cannot be
+// reached, the last document that was fetched successfully is used so the
+// configuration survives Consul outages.
+type KVSource struct {
+	config *ConsulConfig
+	key    string
+	logger *slog.Logger
+
+	waitTime     time.Duration
+	fetchTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	mu        sync.Mutex
+	last      []byte
+	lastIndex uint64
+}
+
+type KVSourceOption func(*KVSource)
+
+// WithLogger sets the logger reporting Consul errors. Defaults to
+// slog.Default().
+func WithLogger(logger *slog.Logger) KVSourceOption {
+	return func(s *KVSource) {
+		s.logger = logger
+	}
+}
+
+// WithWaitTime bounds how long a blocking query waits for a change. Defaults
+// to 5 minutes.
+func WithWaitTime(d time.Duration) KVSourceOption {
+	return func(s *KVSource) {
+		s.waitTime = d
+	}
+}
+
+// WithFetchTimeout bounds how long reading the key may take, so an
+// unreachable Consul agent cannot stall a reload. Blocking queries are given
+// the same time on top of their wait time. Defaults to 10 seconds.
+func WithFetchTimeout(d time.Duration) KVSourceOption {
+	return func(s *KVSource) {
+		s.fetchTimeout = d
+	}
+}
+
+// WithRetryBackoff sets the minimum and maximum delay between attempts to
+// watch the key while Consul is failing. Defaults to 1 second and 1 minute.
+func WithRetryBackoff(min, max time.Duration) KVSourceOption {
+	return func(s *KVSource) {
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// NewKVSource returns a source reading key with the client of c. The format
+// of the document is detected from the extension of the key, see
+// config.FormatFromPath.
+func NewKVSource(c *ConsulConfig, key string, opts ...KVSourceOption) *KVSource {
+	s := &KVSource{
+		config:       c,
+		key:          key,
+		logger:       slog.Default(),
+		waitTime:     5 * time.Minute,
+		fetchTimeout: 10 * time.Second,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// WithKVSource makes ParseConfiguration read the Consul KV key given by
+// -config.consul-key on top of the config files, and reload the configuration
+// when the key changes. Since the key is read before the command line is
+// parsed, c is used as is: a nil c connects with the defaults and the
+// CONSUL_HTTP_* environment variables.
+func WithKVSource(c *ConsulConfig, opts ...KVSourceOption) config.ParseOption {
+	if c == nil {
+		c = &ConsulConfig{}
+		c.RegisterFlags(flag.NewFlagSet("consul", flag.ContinueOnError))
+	}
+
+	return config.WithRemoteSourceFlag(
+		ConfigKeyFlag,
+		"Consul KV key to read the configuration from, e.g. services/api/config.toml. Changes to it are watched.",
+		func(key string) (config.RemoteSource, error) {
+			return NewKVSource(c, key, opts...), nil
+		},
+	)
+}
+
+func (s *KVSource) Name() string {
+	return "consul://" + s.key
+}
+
+// Fetch returns the current value of the key, or the last value fetched
+// successfully when Consul cannot be reached.
+func (s *KVSource) Fetch(ctx context.Context) ([]byte, config.Format, error) {
+	format := config.FormatFromPath(s.key)
+
+	pair, meta, err := s.get(ctx, 0)
+	if err != nil {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		if s.last == nil {
+			return nil, "", err
+		}
+
+		s.logger.Warn("failed to fetch configuration from consul, using the last known configuration",
+			"key", s.key,
+			"error", err,
+		)
+		return s.last, format, nil
+	}
+	if pair == nil {
+		return nil, "", fmt.Errorf("consul key %s does not exist", s.key)
+	}
+
+	s.mu.Lock()
+	s.last = pair.Value
+	if meta.LastIndex > s.lastIndex {
+		s.lastIndex = meta.LastIndex
+	}
+	s.mu.Unlock()
+
+	return pair.Value, format, nil
+}
+
+// Watch signals changes to the key until ctx is canceled. Errors are logged
+// and retried with an exponential backoff.
+func (s *KVSource) Watch(ctx context.Context) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changed)
+
+		s.mu.Lock()
+		index := s.lastIndex
+		s.mu.Unlock()
+
+		backoff := s.minBackoff
+		for {
+			pair, meta, err := s.get(ctx, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Warn("failed to watch consul key, retrying",
+					"key", s.key,
+					"backoff", backoff,
+					"error", err,
+				)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+				if backoff > s.maxBackoff {
+					backoff = s.maxBackoff
+				}
+				continue
+			}
+			backoff = s.minBackoff
+
+			// the index going backwards means consul's state was reset, start
+			// over as recommended by the blocking query documentation.
+			if meta.LastIndex < index {
+				index = 0
+				continue
+			}
+			if meta.LastIndex == index {
+				continue
+			}
+			index = meta.LastIndex
+
+			s.mu.Lock()
+			unchanged := pair != nil && s.last != nil && string(pair.Value) == string(s.last)
+			s.mu.Unlock()
+			if unchanged {
+				continue
+			}
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
+
+func (s *KVSource) get(ctx context.Context, index uint64) (*api.KVPair, *api.QueryMeta, error) {
+	client, err := s.config.GetClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create consul client: %w", err)
+	}
+
+	timeout := s.fetchTimeout
+	q := &api.QueryOptions{WaitIndex: index}
+	if index > 0 {
+		q.WaitTime = s.waitTime
+		// consul adds up to WaitTime/16 of jitter to blocking queries.
+		timeout += s.waitTime + s.waitTime/16
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	pair, meta, err := client.KV().Get(s.key, q.WithContext(ctx))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read consul key %s: %w", s.key, err)
+	}
+
+	return pair, meta, nil
+}
@@ -0,0 +1,210 @@
+package consul
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config"
+)
+
+// kvServer is a stand-in for the Consul KV HTTP API serving a single key.
+type kvServer struct {
+	sync.Mutex
+	key     string
+	value   []byte
+	index   uint64
+	failing bool
+	changed chan struct{}
+}
+
+func newKVServer(t *testing.T, key, value string) (*kvServer, *httptest.Server) {
+	s := &kvServer{key: key, value: []byte(value), index: 1, changed: make(chan struct{})}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+
+	return s, srv
+}
+
+func (s *kvServer) set(value string) {
+	s.Lock()
+	defer s.Unlock()
+	s.value = []byte(value)
+	s.index++
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *kvServer) setFailing(failing bool) {
+	s.Lock()
+	defer s.Unlock()
+	s.failing = failing
+}
+
+func (s *kvServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/kv/"+s.key {
+		http.NotFound(w, r)
+		return
+	}
+
+	s.Lock()
+	if s.failing {
+		s.Unlock()
+		http.Error(w, "no cluster leader", http.StatusInternalServerError)
+		return
+	}
+
+	// emulate a blocking query.
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 && index == s.index {
+		changed := s.changed
+		s.Unlock()
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		case <-time.After(time.Second):
+		}
+		s.Lock()
+	}
+	index, value := s.index, s.value
+	s.Unlock()
+
+	w.Header().Set("X-Consul-Index", strconv.FormatUint(index, 10))
+	_ = json.NewEncoder(w).Encode([]map[string]any{{
+		"Key":         s.key,
+		"Value":       value,
+		"ModifyIndex": index,
+	}})
+}
+
+type appConfig struct {
+	sync.RWMutex
+
+	Name   string `toml:"name"`
+	Region string `toml:"region"`
+
+	merged chan struct{}
+}
+
+func (c *appConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Name, "app.name", "", "name")
+	f.StringVar(&c.Region, "app.region", "", "region")
+}
+
+func (c *appConfig) Validate() error {
+	return nil
+}
+
+func (c *appConfig) Merge(o config.WatchableConfiguration) error {
+	other := o.(*appConfig)
+
+	c.Lock()
+	c.Name = other.Name
+	c.Region = other.Region
+	c.Unlock()
+
+	c.merged <- struct{}{}
+	return nil
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestKVSourceReload(t *testing.T) {
+	kv, srv := newKVServer(t, "services/api/config.toml", "name = \"api\"\n")
+
+	c := &ConsulConfig{Address: strings.TrimPrefix(srv.URL, "http://")}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	p := config.NewParser(WithKVSource(c, WithLogger(testLogger()), WithRetryBackoff(10*time.Millisecond, 10*time.Millisecond)))
+	p.Args = []string{"-config.consul-key", "services/api/config.toml", "-app.region", "us-east-1"}
+	p.FlagSet = fs
+	p.Logger = testLogger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &appConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if cfg.Name != "api" || cfg.Region != "us-east-1" {
+		t.Fatalf("parsed = %s %s, want api us-east-1", cfg.Name, cfg.Region)
+	}
+
+	kv.set("name = \"worker\"\nregion = \"eu-west-1\"\n")
+	select {
+	case <-cfg.merged:
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration was not reloaded after the key changed")
+	}
+
+	cfg.RLock()
+	if cfg.Name != "worker" || cfg.Region != "us-east-1" {
+		t.Errorf("reloaded = %s %s, want worker us-east-1", cfg.Name, cfg.Region)
+	}
+	cfg.RUnlock()
+}
+
+func TestKVSourceFetchKeepsLastGoodDocument(t *testing.T) {
+	kv, srv := newKVServer(t, "services/api/config.yaml", "name: api\n")
+
+	c := &ConsulConfig{Address: strings.TrimPrefix(srv.URL, "http://")}
+	s := NewKVSource(c, "services/api/config.yaml", WithLogger(testLogger()))
+
+	if _, _, err := NewKVSource(c, "services/api/missing.toml").Fetch(context.Background()); err == nil {
+		t.Error("expected an error for a missing key")
+	}
+
+	kv.setFailing(true)
+	if _, _, err := s.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error before any document was fetched")
+	}
+
+	kv.setFailing(false)
+	data, format, err := s.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+	if string(data) != "name: api\n" || format != config.FormatYAML {
+		t.Errorf("Fetch() = %q %s", data, format)
+	}
+
+	kv.setFailing(true)
+	data, _, err = s.Fetch(context.Background())
+	if err != nil {
+		t.Fatalf("Fetch() during an outage error: %v", err)
+	}
+	if string(data) != "name: api\n" {
+		t.Errorf("Fetch() during an outage = %q, want the last good document", data)
+	}
+}
+
+func TestKVSourceFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	c := &ConsulConfig{Address: strings.TrimPrefix(srv.URL, "http://")}
+	s := NewKVSource(c, "services/api/config.toml", WithLogger(testLogger()), WithFetchTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	if _, _, err := s.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error from an unresponsive agent")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Fetch() took %s, want it bounded by the fetch timeout", elapsed)
+	}
+}
@@ -1,6 +1,8 @@
 package database
 
 import (
+	"context"
+	stdsql "database/sql"
 	"flag"
 	"fmt"
 	"sync"
@@ -45,11 +47,11 @@ func (c *DatabaseConfig[T]) WithClient(client *T) {
 }
 
 func (c *DatabaseConfig[T]) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&c.Host, "database.host", env.GetEnvStrDefault("DATABASE_HOST", ""), "database host to connect to")
-	f.StringVar(&c.Database, "database.database", env.GetEnvStrDefault("DATABASE_DATABASE", ""), "the database to connect to")
-	f.StringVar(&c.Port, "database.port", env.GetEnvStrDefault("DATABASE_PORT", ""), "the port of the database host to connect to. NOTE: this is currently unused")
-	f.StringVar(&c.Username, "database.username", env.GetEnvStrDefault("DATABASE_USERNAME", ""), "the username to authenticate to the database with")
-	f.StringVar(&c.Password, "database.password", env.GetEnvStrDefault("DATABASE_PASSWORD", ""), "the password to authenticate to the database with")
+	env.StringVar(f, &c.Host, "database.host", "DATABASE_HOST", "", "database host to connect to")
+	env.StringVar(f, &c.Database, "database.database", "DATABASE_DATABASE", "", "the database to connect to")
+	env.StringVar(f, &c.Port, "database.port", "DATABASE_PORT", "", "the port of the database host to connect to. NOTE: this is currently unused")
+	env.StringVar(f, &c.Username, "database.username", "DATABASE_USERNAME", "", "the username to authenticate to the database with")
+	env.StringVar(f, &c.Password, "database.password", "DATABASE_PASSWORD", "", "the password to authenticate to the database with")
 }
 
 func (c *DatabaseConfig[T]) Validate() error {
@@ -97,7 +99,23 @@ func (c *DatabaseConfig[T]) Merge(o *DatabaseConfig[T]) error {
 	return nil
 }
 
-func (c *DatabaseConfig[T]) CreateClient() (*T, error) {
+// Preflight checks that the database accepts the host and credentials of o
+// before Merge swaps them in, by opening a connection and pinging it.
+func (c *DatabaseConfig[T]) Preflight(ctx context.Context, o *DatabaseConfig[T]) error {
+	db, err := stdsql.Open("mysql", o.mysqlConfig().FormatDSN())
+	if err != nil {
+		return fmt.Errorf("invalid database configuration: %w", err)
+	}
+	defer db.Close()
+
+	if err := db.PingContext(ctx); err != nil {
+		return fmt.Errorf("failed to connect to database %s on %s as %s: %w", o.Database, o.Host, o.Username, err)
+	}
+
+	return nil
+}
+
+func (c *DatabaseConfig[T]) mysqlConfig() *mysql.Config {
 	params := map[string]string{
 		"parseTime": "true",
 		"charset":   "utf8mb4",
@@ -105,7 +123,7 @@ func (c *DatabaseConfig[T]) CreateClient() (*T, error) {
 		"tls":       "true",
 	}
 
-	mc := mysql.Config{
+	return &mysql.Config{
 		User:                 c.Username,
 		Passwd:               c.Password,
 		Net:                  "tcp",
@@ -114,6 +132,10 @@ func (c *DatabaseConfig[T]) CreateClient() (*T, error) {
 		AllowNativePasswords: true,
 		Params:               params,
 	}
+}
+
+func (c *DatabaseConfig[T]) CreateClient() (*T, error) {
+	mc := c.mysqlConfig()
 
 	db, err := otelsql.Open(dialect.MySQL, mc.FormatDSN(), otelsql.WithAttributes(
 		semconv.DBSystemMySQL,
@@ -1,6 +1,6 @@
 module github.com/bloominlabs/baseplate-go/config/database
 
-go 1.20
+go 1.21
 
 replace github.com/bloominlabs/baseplate-go/config/env => ../env/
 
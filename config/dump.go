@@ -0,0 +1,135 @@
+package config
+
+import (
+	"encoding"
+	"fmt"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+)
+
+// Dump renders the effective configuration as TOML, using the same keys as
+// the config files. Secrets that are set are replaced by <redacted>: fields
+// tagged `redact:"true"`, and fields whose name looks like a secret, e.g.
+// Token, SecretKey or Password, unless they are tagged `redact:"false"`. If
+// cfg, or a struct nested in it, has an RLock method, e.g. because it embeds
+// a sync.RWMutex, it is held while its fields are read. A *Value dumps its
+// current snapshot.
+func Dump(cfg any) ([]byte, error) {
+	if v, ok := cfg.(interface{ snapshot() any }); ok {
+		cfg = v.snapshot()
+	}
+
+	doc := map[string]any{}
+	walkFieldsRLocked(cfg, dumpField(doc))
+
+	out, err := toml.Marshal(doc)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode configuration: %w", err)
+	}
+
+	return out, nil
+}
+
+// dumpField returns the function adding the fields walked to doc, with their
+// secrets redacted.
+func dumpField(doc map[string]any) func(field) {
+	return func(f field) {
+		value, ok := dumpValue(f.value)
+		if !ok {
+			return
+		}
+		if isSecret(f) && !f.value.IsZero() {
+			value = redactedValue
+		}
+
+		table := doc
+		for _, part := range f.path[:len(f.path)-1] {
+			next, ok := table[part].(map[string]any)
+			if !ok {
+				next = map[string]any{}
+				table[part] = next
+			}
+			table = next
+		}
+		table[f.path[len(f.path)-1]] = value
+	}
+}
+
+// dumpValue returns the value to render for v, formatting text marshalers
+// the way they are written in config files and URLs without their password.
+// Structs in slices and maps, e.g. [[databases]] tables, are rendered field
+// by field so their secrets are redacted too. Nil pointers and values toml cannot encode are skipped.
+func dumpValue(v reflect.Value) (any, bool) {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil, false
+		}
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Func, reflect.Chan, reflect.UnsafePointer:
+		return nil, false
+	}
+
+	if !v.CanInterface() {
+		return nil, false
+	}
+
+	if redacted, ok := redactedURL(v.Interface()); ok {
+		return redacted, true
+	}
+	switch value := v.Interface().(type) {
+	case time.Time:
+		return value, true
+	case encoding.TextMarshaler:
+		text, err := value.MarshalText()
+		if err != nil {
+			return nil, false
+		}
+		return string(text), true
+	}
+
+	switch {
+	case isStruct(v.Type()):
+		table := map[string]any{}
+		walkStruct(v, nil, true, dumpField(table))
+		return table, true
+	case (v.Kind() == reflect.Slice || v.Kind() == reflect.Array) && v.Type().Elem().Kind() != reflect.Uint8:
+		out := make([]any, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if e, ok := dumpValue(v.Index(i)); ok {
+				out = append(out, e)
+			}
+		}
+		return out, true
+	case v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String:
+		out := make(map[string]any, v.Len())
+		iter := v.MapRange()
+		for iter.Next() {
+			if e, ok := dumpValue(iter.Value()); ok {
+				out[iter.Key().String()] = e
+			}
+		}
+		return out, true
+	}
+
+	return v.Interface(), true
+}
+
+// DumpHandler serves Dump(cfg) as text/plain, e.g. on /debug/config.
+func DumpHandler(cfg any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		out, err := Dump(cfg)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write(out)
+	})
+}
@@ -0,0 +1,358 @@
+package env
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvFileVariable lists the dotenv files to load, separated by commas, when
+// none is given on the command line, e.g. BASEPLATE_ENV_FILE=.env,.env.local.
+const EnvFileVariable = "BASEPLATE_ENV_FILE"
+
+// dotEnvFiles maps the variables set by LoadFiles to the file they were
+// read from. It is guarded by lookupsMu.
+var dotEnvFiles = map[string]string{}
+
+// LoadFiles loads the dotenv files into the process environment, in order,
+// so the variables they define are read by this package like real ones.
+// Variables already set in the environment always win over the files, and a
+// variable defined in several files takes the value of the last one. See
+// ParseDotEnv for the syntax.
+func LoadFiles(paths ...string) error {
+	values := map[string]string{}
+	files := map[string]string{}
+	var keys []string
+
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read env file: %w", err)
+		}
+
+		// references resolve to the value the variable ends up with, so the
+		// real environment wins there as well.
+		parsed, err := parseDotEnv(data, values, os.LookupEnv)
+		if err != nil {
+			return fmt.Errorf("%s: line %w", path, err)
+		}
+		for _, kv := range parsed {
+			if _, ok := files[kv.key]; !ok {
+				keys = append(keys, kv.key)
+			}
+			files[kv.key] = path
+		}
+	}
+
+	for _, key := range keys {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+		if err := os.Setenv(key, values[key]); err != nil {
+			return fmt.Errorf("failed to set %s from %s: %w", key, files[key], err)
+		}
+
+		lookupsMu.Lock()
+		dotEnvFiles[key] = files[key]
+		lookupsMu.Unlock()
+	}
+
+	return nil
+}
+
+// ParseDotEnv parses a dotenv document into its variables:
+//
+//	# comments and blank lines are skipped
+//	export LOG_LEVEL=debug
+//	S3_BUCKET = assets # trailing comments too
+//	GREETING="hello\n${USER:-world}"
+//	PATTERN='literal $text, may span lines'
+//	OTLP_ADDR=${OTLP_HOST}:4317
+//
+// Unquoted and double quoted values expand $VAR, ${VAR} and ${VAR:-default}
+// references with lookup, which may be nil, or else with the variables
+// defined earlier in the document. Double quoted values also understand the
+// \n, \r, \t, \", \$ and \\ escapes. Single quoted values are taken
+// literally. Unquoted values are trimmed.
+func ParseDotEnv(data []byte, lookup func(key string) (string, bool)) (map[string]string, error) {
+	values := map[string]string{}
+	if _, err := parseDotEnv(data, values, lookup); err != nil {
+		return nil, fmt.Errorf("line %w", err)
+	}
+
+	return values, nil
+}
+
+type dotEnvVar struct {
+	key, value string
+}
+
+// dotEnvParser parses a dotenv document into values, which references fall
+// back to.
+type dotEnvParser struct {
+	src    string
+	pos    int
+	line   int
+	values map[string]string
+	lookup func(string) (string, bool)
+}
+
+// parseDotEnv parses data into values, and returns the variables it defines
+// in order. Errors are prefixed with the line they happened on, e.g. "3: ...".
+func parseDotEnv(data []byte, values map[string]string, lookup func(string) (string, bool)) ([]dotEnvVar, error) {
+	p := &dotEnvParser{
+		src:    strings.ReplaceAll(string(data), "\r\n", "\n"),
+		line:   1,
+		values: values,
+		lookup: lookup,
+	}
+
+	var out []dotEnvVar
+	for {
+		p.skipBlank()
+		if p.pos >= len(p.src) {
+			return out, nil
+		}
+
+		line := p.line
+		kv, err := p.variable()
+		if err != nil {
+			return nil, fmt.Errorf("%d: %w", line, err)
+		}
+		p.values[kv.key] = kv.value
+		out = append(out, kv)
+	}
+}
+
+// skipBlank skips whitespace, blank lines and comment lines.
+func (p *dotEnvParser) skipBlank() {
+	for p.pos < len(p.src) {
+		switch c := p.src[p.pos]; {
+		case c == '\n':
+			p.line++
+			p.pos++
+		case c == ' ' || c == '\t':
+			p.pos++
+		case c == '#':
+			p.skipLine()
+		default:
+			return
+		}
+	}
+}
+
+func (p *dotEnvParser) skipLine() {
+	if i := strings.IndexByte(p.src[p.pos:], '\n'); i >= 0 {
+		p.pos += i
+	} else {
+		p.pos = len(p.src)
+	}
+}
+
+func (p *dotEnvParser) skipSpaces() {
+	for p.pos < len(p.src) && (p.src[p.pos] == ' ' || p.src[p.pos] == '\t') {
+		p.pos++
+	}
+}
+
+// variable parses a single KEY=value assignment.
+func (p *dotEnvParser) variable() (dotEnvVar, error) {
+	if rest := p.src[p.pos:]; strings.HasPrefix(rest, "export ") || strings.HasPrefix(rest, "export\t") {
+		p.pos += len("export")
+		p.skipSpaces()
+	}
+
+	start := p.pos
+	for p.pos < len(p.src) && isKeyByte(p.src[p.pos], p.pos > start) {
+		p.pos++
+	}
+	key := p.src[start:p.pos]
+	if key == "" {
+		return dotEnvVar{}, fmt.Errorf("expected a variable name, got %q", p.rest())
+	}
+
+	p.skipSpaces()
+	if p.pos >= len(p.src) || p.src[p.pos] != '=' {
+		return dotEnvVar{}, fmt.Errorf("expected = after %s", key)
+	}
+	p.pos++
+	p.skipSpaces()
+
+	var (
+		value string
+		err   error
+	)
+	switch {
+	case p.pos < len(p.src) && p.src[p.pos] == '\'':
+		value, err = p.singleQuoted()
+	case p.pos < len(p.src) && p.src[p.pos] == '"':
+		value, err = p.doubleQuoted()
+	default:
+		value, err = p.unquoted()
+	}
+	if err != nil {
+		return dotEnvVar{}, fmt.Errorf("%s: %w", key, err)
+	}
+
+	// only a comment may follow a quoted value.
+	p.skipSpaces()
+	if p.pos < len(p.src) && p.src[p.pos] != '\n' {
+		if p.src[p.pos] != '#' {
+			return dotEnvVar{}, fmt.Errorf("%s: unexpected %q after the value", key, p.rest())
+		}
+		p.skipLine()
+	}
+
+	return dotEnvVar{key: key, value: value}, nil
+}
+
+// rest returns the remainder of the current line, for errors.
+func (p *dotEnvParser) rest() string {
+	rest, _, _ := strings.Cut(p.src[p.pos:], "\n")
+	return rest
+}
+
+func isKeyByte(c byte, inside bool) bool {
+	switch {
+	case c == '_', c >= 'A' && c <= 'Z', c >= 'a' && c <= 'z':
+		return true
+	case inside && (c >= '0' && c <= '9' || c == '.'):
+		return true
+	default:
+		return false
+	}
+}
+
+func (p *dotEnvParser) singleQuoted() (string, error) {
+	end := strings.IndexByte(p.src[p.pos+1:], '\'')
+	if end < 0 {
+		return "", fmt.Errorf("unterminated single quoted value")
+	}
+
+	value := p.src[p.pos+1 : p.pos+1+end]
+	p.line += strings.Count(value, "\n")
+	p.pos += end + 2
+
+	return value, nil
+}
+
+func (p *dotEnvParser) doubleQuoted() (string, error) {
+	var b strings.Builder
+	for i := p.pos + 1; i < len(p.src); i++ {
+		switch c := p.src[i]; c {
+		case '"':
+			p.pos = i + 1
+			return b.String(), nil
+		case '\\':
+			if i+1 >= len(p.src) {
+				continue
+			}
+			i++
+			switch e := p.src[i]; e {
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			case '"', '\\', '$':
+				b.WriteByte(e)
+			default:
+				if e == '\n' {
+					p.line++
+				}
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+		case '$':
+			n, err := p.expand(&b, p.src[i:])
+			if err != nil {
+				return "", err
+			}
+			i += n - 1
+		default:
+			if c == '\n' {
+				p.line++
+			}
+			b.WriteByte(c)
+		}
+	}
+
+	return "", fmt.Errorf("unterminated double quoted value")
+}
+
+func (p *dotEnvParser) unquoted() (string, error) {
+	start := p.pos
+	p.skipLine()
+	raw := p.src[start:p.pos]
+
+	// a # starts a comment when it follows whitespace.
+	for i := 1; i < len(raw); i++ {
+		if raw[i] == '#' && (raw[i-1] == ' ' || raw[i-1] == '\t') {
+			raw = raw[:i]
+			break
+		}
+	}
+	raw = strings.TrimSpace(raw)
+
+	var b strings.Builder
+	for i := 0; i < len(raw); i++ {
+		if raw[i] != '$' {
+			b.WriteByte(raw[i])
+			continue
+		}
+
+		n, err := p.expand(&b, raw[i:])
+		if err != nil {
+			return "", err
+		}
+		i += n - 1
+	}
+
+	return b.String(), nil
+}
+
+// expand writes the value of the reference s starts with to b, and returns
+// the length of the reference. A $ that does not start a reference is
+// written as is.
+func (p *dotEnvParser) expand(b *strings.Builder, s string) (int, error) {
+	var name, def string
+	n := 0
+	switch {
+	case strings.HasPrefix(s, "${"):
+		end := strings.IndexAny(s, "}\n")
+		if end < 0 || s[end] != '}' {
+			return 0, fmt.Errorf("unterminated reference %s", strings.SplitN(s, "\n", 2)[0])
+		}
+		name, def, _ = strings.Cut(s[2:end], ":-")
+		n = end + 1
+	default:
+		end := 1
+		for end < len(s) && isKeyByte(s[end], end > 1) && s[end] != '.' {
+			end++
+		}
+		if end == 1 {
+			b.WriteByte('$')
+			return 1, nil
+		}
+		name = s[1:end]
+		n = end
+	}
+
+	var (
+		value string
+		ok    bool
+	)
+	if p.lookup != nil {
+		value, ok = p.lookup(name)
+	}
+	if !ok {
+		value, ok = p.values[name]
+	}
+	if !ok || value == "" {
+		value = def
+	}
+	b.WriteString(value)
+
+	return n, nil
+}
@@ -0,0 +1,117 @@
+package env
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDotEnv(t *testing.T) {
+	data := `# comment
+export LOG_LEVEL=debug
+S3_BUCKET = assets # trailing comment
+EMPTY=
+HASH=a#b
+SINGLE='literal $LOG_LEVEL # not a comment'
+DOUBLE="line\n${LOG_LEVEL} \"quoted\" \$LOG_LEVEL"
+MULTI="first
+second"
+OTLP_ADDR=${OTLP_HOST:-localhost}:4317
+REF=$LOG_LEVEL-$HOST
+`
+	lookup := func(key string) (string, bool) {
+		if key == "HOST" {
+			return "example.com", true
+		}
+		return "", false
+	}
+
+	got, err := ParseDotEnv([]byte(data), lookup)
+	if err != nil {
+		t.Fatalf("ParseDotEnv() error: %v", err)
+	}
+
+	want := map[string]string{
+		"LOG_LEVEL": "debug",
+		"S3_BUCKET": "assets",
+		"EMPTY":     "",
+		"HASH":      "a#b",
+		"SINGLE":    "literal $LOG_LEVEL # not a comment",
+		"DOUBLE":    "line\ndebug \"quoted\" $LOG_LEVEL",
+		"MULTI":     "first\nsecond",
+		"OTLP_ADDR": "localhost:4317",
+		"REF":       "debug-example.com",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseDotEnv() = %#v, want %#v", got, want)
+	}
+}
+
+func TestParseDotEnvErrors(t *testing.T) {
+	for data, want := range map[string]string{
+		"A=1\nB\n":                "line 2: expected = after B",
+		"A=1\n\nB=\"unterminated": "line 3: B: unterminated double quoted value",
+		"A='x' y\n":               "line 1: A: unexpected \"y\" after the value",
+		"=1\n":                    "line 1: expected a variable name",
+	} {
+		_, err := ParseDotEnv([]byte(data), nil)
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("ParseDotEnv(%q) error = %v, want %q", data, err, want)
+		}
+	}
+}
+
+func TestLoadFiles(t *testing.T) {
+	for _, key := range []string{"TEST_DOTENV_A", "TEST_DOTENV_B", "TEST_DOTENV_C"} {
+		// restores the variables LoadFiles sets once the test is done.
+		t.Setenv(key, "")
+		os.Unsetenv(key)
+	}
+	t.Setenv("TEST_DOTENV_REAL", "real")
+
+	dir := t.TempDir()
+	base := filepath.Join(dir, ".env")
+	local := filepath.Join(dir, ".env.local")
+	if err := os.WriteFile(base, []byte("TEST_DOTENV_A=base\nTEST_DOTENV_B=base\nTEST_DOTENV_REAL=file\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(local, []byte("TEST_DOTENV_B=local\nTEST_DOTENV_C=${TEST_DOTENV_REAL}-${TEST_DOTENV_A}\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := LoadFiles(base, local); err != nil {
+		t.Fatalf("LoadFiles() error: %v", err)
+	}
+	for key, want := range map[string]string{
+		"TEST_DOTENV_A":    "base",
+		"TEST_DOTENV_B":    "local",
+		"TEST_DOTENV_C":    "real-base",
+		"TEST_DOTENV_REAL": "real",
+	} {
+		if got := GetEnvStrDefault(key, ""); got != want {
+			t.Errorf("%s = %q, want %q", key, got, want)
+		}
+	}
+	for _, l := range Lookups() {
+		if l.Key == "TEST_DOTENV_B" && l.DotEnvFile != local {
+			t.Errorf("Lookup = %+v, want DotEnvFile %s", l, local)
+		}
+		if l.Key == "TEST_DOTENV_REAL" && l.DotEnvFile != "" {
+			t.Errorf("Lookup = %+v, want no DotEnvFile", l)
+		}
+	}
+
+	if err := LoadFiles(filepath.Join(dir, "missing")); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+
+	invalid := filepath.Join(dir, ".env.invalid")
+	if err := os.WriteFile(invalid, []byte("TEST_DOTENV_A=1\nTEST_DOTENV_B\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := LoadFiles(invalid); err == nil || err.Error() != invalid+": line 2: expected = after TEST_DOTENV_B" {
+		t.Errorf("LoadFiles() error = %v, want the file and line", err)
+	}
+}
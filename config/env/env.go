@@ -2,21 +2,27 @@ package env
 
 import (
 	"fmt"
-	"os"
 	"strconv"
 	"time"
 )
 
 func GetEnvStr(key string) (string, error) {
-	value := os.Getenv(key)
+	value, _, err := lookup(key)
+	if err != nil {
+		return "", err
+	}
 	if value == "" {
 		return "", fmt.Errorf("getenv: environment variable empty - %s", key)
 	}
 	return value, nil
 }
 
+// GetEnvStrDefault returns the environment variable key, or def when it is
+// unset or empty. When the FileSuffix companion of key cannot be used, e.g.
+// because the file cannot be read, def is returned as well and the error is
+// recorded for Err. Use Default to get the error instead.
 func GetEnvStrDefault(key string, def string) string {
-	value := os.Getenv(key)
+	value, _ := lookupDefault(key, def)
 	if value == "" {
 		return def
 	}
@@ -32,7 +38,11 @@ func MustGetEnvStr(key string) string {
 }
 
 func GetEnvInt(key string, def int) (int, error) {
-	strValue := os.Getenv(key)
+	recordDefault(key, strconv.Itoa(def))
+	strValue, _, err := lookup(key)
+	if err != nil {
+		return 0, err
+	}
 	if strValue == "" {
 		return def, nil
 	}
@@ -44,7 +54,11 @@ func GetEnvInt(key string, def int) (int, error) {
 }
 
 func GetEnvInt64(key string, def int64) (int64, error) {
-	strValue := os.Getenv(key)
+	recordDefault(key, strconv.FormatInt(def, 10))
+	strValue, _, err := lookup(key)
+	if err != nil {
+		return 0, err
+	}
 	if strValue == "" {
 		return def, nil
 	}
@@ -56,7 +70,11 @@ func GetEnvInt64(key string, def int64) (int64, error) {
 }
 
 func GetEnvFloat64(key string, def float64) (float64, error) {
-	strValue := os.Getenv(key)
+	recordDefault(key, strconv.FormatFloat(def, 'g', -1, 64))
+	strValue, _, err := lookup(key)
+	if err != nil {
+		return 0, err
+	}
 	if strValue == "" {
 		return def, nil
 	}
@@ -68,7 +86,10 @@ func GetEnvFloat64(key string, def float64) (float64, error) {
 }
 
 func GetEnvBool(key string) (bool, error) {
-	strValue := os.Getenv(key)
+	strValue, _, err := lookup(key)
+	if err != nil {
+		return false, err
+	}
 	if strValue == "" {
 		return false, fmt.Errorf("environment varialbe empty - %s", key)
 	}
@@ -79,13 +100,18 @@ func GetEnvBool(key string) (bool, error) {
 	return v, nil
 }
 
+// GetEnvBoolDefault returns the environment variable key parsed as a bool, or
+// def when it is unset, empty or unparsable. Like GetEnvStrDefault, it returns
+// def when the FileSuffix companion of key cannot be used and records the
+// error for Err.
 func GetEnvBoolDefault(key string, def bool) bool {
-	value, err := GetEnvBool(key)
+	value, _ := lookupDefault(key, strconv.FormatBool(def))
+	v, err := strconv.ParseBool(value)
 	if err != nil {
 		return def
 	}
 
-	return value
+	return v
 }
 
 func MustGetEnvBool(key string) bool {
@@ -96,8 +122,12 @@ func MustGetEnvBool(key string) bool {
 	return v
 }
 
+// GetEnvDurDefault returns the environment variable key parsed as a
+// duration, or def when it is unset, and panics when it is unparsable. Like
+// GetEnvStrDefault, it returns def when the FileSuffix companion of key cannot
+// be used and records the error for Err.
 func GetEnvDurDefault(key string, def time.Duration) time.Duration {
-	if val, ok := os.LookupEnv(key); ok {
+	if val, ok := lookupDefault(key, def.String()); ok {
 		dur, err := time.ParseDuration(val)
 		if err != nil {
 			panic(err)
@@ -108,3 +138,27 @@ func GetEnvDurDefault(key string, def time.Duration) time.Duration {
 
 	return def
 }
+
+// Value is a value that can be parsed from a string, such as a flag.Value or
+// one of the value types of the config package.
+type Value interface {
+	Set(string) error
+}
+
+// GetEnvValueDefault sets v from the environment variable key, or from def
+// when the variable is empty, e.g. to default a config.ByteSize before
+// registering it with f.Var. An unparsable value panics, like it does for
+// GetEnvDurDefault.
+func GetEnvValueDefault(key string, v Value, def string) {
+	value, _ := lookupDefault(key, def)
+	if value == "" {
+		value = def
+	}
+	if value == "" {
+		return
+	}
+
+	if err := v.Set(value); err != nil {
+		panic(fmt.Sprintf("invalid value for environment variable %s: %s", key, err))
+	}
+}
@@ -0,0 +1,60 @@
+package env
+
+import (
+	"flag"
+	"strings"
+	"time"
+)
+
+// StringVar defines a string flag like f.StringVar, defaulting to the first
+// non-empty variable of keys, a comma separated list like the env tag of
+// config.RegisterStructFlags, or to def when none is set. The variables are
+// bound to the flag, see Bind, so registering a flag and the variables it is
+// read from takes a single call:
+//
+//	env.StringVar(f, &c.Address, "nomad.addr", "NOMAD_ADDR", "localhost:4646", "...")
+func StringVar(f *flag.FlagSet, p *string, name, keys, def, usage string) {
+	if !Isolated(f) {
+		for _, key := range reverseKeys(name, keys) {
+			def = GetEnvStrDefault(key, def)
+		}
+	}
+	f.StringVar(p, name, def, usage)
+}
+
+// BoolVar is StringVar for bool flags. Variables that cannot be parsed are
+// ignored, like GetEnvBoolDefault does.
+func BoolVar(f *flag.FlagSet, p *bool, name, keys string, def bool, usage string) {
+	if !Isolated(f) {
+		for _, key := range reverseKeys(name, keys) {
+			def = GetEnvBoolDefault(key, def)
+		}
+	}
+	f.BoolVar(p, name, def, usage)
+}
+
+// DurationVar is StringVar for time.Duration flags. Variables that cannot be
+// parsed panic, like GetEnvDurDefault does.
+func DurationVar(f *flag.FlagSet, p *time.Duration, name, keys string, def time.Duration, usage string) {
+	if !Isolated(f) {
+		for _, key := range reverseKeys(name, keys) {
+			def = GetEnvDurDefault(key, def)
+		}
+	}
+	f.DurationVar(p, name, def, usage)
+}
+
+// reverseKeys binds the comma separated keys to the flag name and returns
+// them last first, so folding the GetEnv*Default helpers over them lets the
+// first set variable win.
+func reverseKeys(name, keys string) []string {
+	var out []string
+	for _, key := range strings.Split(keys, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			Bind(key, name)
+			out = append([]string{key}, out...)
+		}
+	}
+
+	return out
+}
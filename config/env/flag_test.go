@@ -0,0 +1,45 @@
+package env
+
+import (
+	"flag"
+	"testing"
+	"time"
+)
+
+func TestStringVar(t *testing.T) {
+	t.Setenv("TEST_FLAG_FALLBACK", "fallback")
+	t.Setenv("TEST_FLAG_DEBUG", "true")
+	t.Setenv("TEST_FLAG_INTERVAL", "5s")
+
+	var (
+		fs       = flag.NewFlagSet("test", flag.ContinueOnError)
+		address  string
+		debug    bool
+		interval time.Duration
+	)
+	StringVar(fs, &address, "test.addr", "TEST_FLAG_ADDR, TEST_FLAG_FALLBACK", "localhost", "address")
+	BoolVar(fs, &debug, "test.debug", "TEST_FLAG_DEBUG", false, "debug")
+	DurationVar(fs, &interval, "test.interval", "TEST_FLAG_INTERVAL", time.Minute, "interval")
+
+	if address != "fallback" || !debug || interval != 5*time.Second {
+		t.Errorf("got address=%q debug=%v interval=%s, want the environment values", address, debug, interval)
+	}
+
+	t.Setenv("TEST_FLAG_ADDR", "primary")
+	StringVar(flag.NewFlagSet("test", flag.ContinueOnError), &address, "test.addr", "TEST_FLAG_ADDR,TEST_FLAG_FALLBACK", "localhost", "address")
+	if address != "primary" {
+		t.Errorf("address = %q, want the first set variable", address)
+	}
+
+	bound := map[string]bool{}
+	for _, l := range Lookups() {
+		for _, f := range l.Flags {
+			if f == "test.addr" {
+				bound[l.Key] = true
+			}
+		}
+	}
+	if !bound["TEST_FLAG_ADDR"] || !bound["TEST_FLAG_FALLBACK"] {
+		t.Errorf("expected both variables bound to -test.addr, got %v", bound)
+	}
+}
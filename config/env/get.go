@@ -0,0 +1,323 @@
+package env
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Get, Default and Must read typed values from the environment with the same
+// rules for every type, unlike the GetEnv* functions which predate them:
+//
+//   - an empty variable is treated like an unset one;
+//   - an unparsable value is always an *Error, never silently replaced by the
+//     default;
+//   - only Must panics.
+//
+// Supported types are strings, bools, integers, floats, time.Duration,
+// url.URL, types implementing encoding.TextUnmarshaler or Value through a
+// pointer, and slices and string keyed maps of those. Slices are comma
+// separated values, e.g. "a,b", and maps comma separated key=value pairs,
+// e.g. "a=1,b=2". Named types are parsed like their underlying type. The
+// Func variants take a parser for anything else.
+
+// ParseFunc parses the value of an environment variable.
+type ParseFunc[T any] func(value string) (T, error)
+
+// ErrNotSet is returned by Get when the variable is unset or empty.
+var ErrNotSet = errors.New("environment variable is not set")
+
+// Error is an environment variable that is unset when required, that could
+// not be parsed, or whose FileSuffix companion could not be read. The value
+// is left out of the message since it may be a secret.
+type Error struct {
+	Key string
+	Err error
+}
+
+func (e *Error) Error() string {
+	if errors.Is(e.Err, ErrNotSet) {
+		return fmt.Sprintf("environment variable %s is not set", e.Key)
+	}
+
+	return fmt.Sprintf("invalid environment variable %s: %s", e.Key, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Get parses the environment variable key as a T. The returned error wraps
+// ErrNotSet when the variable is unset or empty.
+func Get[T any](key string) (T, error) {
+	return GetFunc(key, Parse[T])
+}
+
+// Default parses the environment variable key as a T, and returns def when
+// it is unset or empty. An unparsable value returns def and an error.
+func Default[T any](key string, def T) (T, error) {
+	return DefaultFunc(key, def, Parse[T])
+}
+
+// Must parses the environment variable key as a T, and panics when it is
+// unset, empty or unparsable. It is meant for values a program cannot start
+// without; prefer a Collector to report every bad variable at once.
+func Must[T any](key string) T {
+	return MustFunc(key, Parse[T])
+}
+
+// GetFunc is Get with a custom parser.
+func GetFunc[T any](key string, parse ParseFunc[T]) (T, error) {
+	var zero T
+
+	value, _, err := lookup(key)
+	if err != nil {
+		return zero, err
+	}
+	if value == "" {
+		return zero, &Error{Key: key, Err: ErrNotSet}
+	}
+
+	v, err := parse(value)
+	if err != nil {
+		return zero, &Error{Key: key, Err: err}
+	}
+
+	return v, nil
+}
+
+// DefaultFunc is Default with a custom parser.
+func DefaultFunc[T any](key string, def T, parse ParseFunc[T]) (T, error) {
+	recordDefault(key, fmt.Sprint(def))
+	v, err := GetFunc(key, parse)
+	if errors.Is(err, ErrNotSet) {
+		return def, nil
+	}
+	if err != nil {
+		return def, err
+	}
+
+	return v, nil
+}
+
+// MustFunc is Must with a custom parser.
+func MustFunc[T any](key string, parse ParseFunc[T]) T {
+	v, err := GetFunc(key, parse)
+	if err != nil {
+		panic(err)
+	}
+
+	return v
+}
+
+// Parse parses value as a T, following the rules of Get.
+func Parse[T any](value string) (T, error) {
+	var v T
+	if err := parseInto(reflect.ValueOf(&v).Elem(), value); err != nil {
+		return v, err
+	}
+
+	return v, nil
+}
+
+var (
+	durationType = reflect.TypeOf(time.Duration(0))
+	urlType      = reflect.TypeOf(url.URL{})
+)
+
+func parseInto(v reflect.Value, value string) error {
+	if v.CanAddr() {
+		switch p := v.Addr().Interface().(type) {
+		case encoding.TextUnmarshaler:
+			return p.UnmarshalText([]byte(value))
+		case Value:
+			return p.Set(value)
+		}
+	}
+
+	switch v.Type() {
+	case durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return errors.New("invalid duration, e.g. 1m30s")
+		}
+		v.SetInt(int64(d))
+		return nil
+	case urlType:
+		u, err := url.Parse(value)
+		if err != nil {
+			return redact(err)
+		}
+		v.Set(reflect.ValueOf(*u))
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(value)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return redact(err)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(value, 10, v.Type().Bits())
+		if err != nil {
+			return redact(err)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(value, 10, v.Type().Bits())
+		if err != nil {
+			return redact(err)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(value, v.Type().Bits())
+		if err != nil {
+			return redact(err)
+		}
+		v.SetFloat(f)
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := parseInto(elem.Elem(), value); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.Slice:
+		out := reflect.MakeSlice(v.Type(), 0, 0)
+		for i, part := range splitList(value) {
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := parseInto(elem, part); err != nil {
+				return fmt.Errorf("element %d: %w", i, err)
+			}
+			out = reflect.Append(out, elem)
+		}
+		v.Set(out)
+	case reflect.Map:
+		if v.Type().Key().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s, map keys must be strings", v.Type())
+		}
+		out := reflect.MakeMap(v.Type())
+		for _, pair := range splitList(value) {
+			k, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value pairs")
+			}
+			elem := reflect.New(v.Type().Elem()).Elem()
+			if err := parseInto(elem, strings.TrimSpace(val)); err != nil {
+				return fmt.Errorf("key %q: %w", strings.TrimSpace(k), err)
+			}
+			out.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)).Convert(v.Type().Key()), elem)
+		}
+		v.Set(out)
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+
+	return nil
+}
+
+// redact drops the value from strconv and url errors, since it may be a
+// secret.
+func redact(err error) error {
+	var numErr *strconv.NumError
+	if errors.As(err, &numErr) {
+		return numErr.Err
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return urlErr.Err
+	}
+
+	return err
+}
+
+// splitList splits a comma separated list, trimming the elements and
+// dropping empty ones.
+func splitList(value string) []string {
+	var out []string
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+
+	return out
+}
+
+// Collector gathers the errors of the environment variables read through it,
+// so a program can report every bad variable at once instead of stopping at
+// the first:
+//
+//	var c env.Collector
+//	addr := env.Collect(&c, "LISTEN_ADDR", ":8080")
+//	timeout := env.Collect(&c, "TIMEOUT", 5*time.Second)
+//	token := env.Require[string](&c, "API_TOKEN")
+//	if err := c.Err(); err != nil {
+//		log.Fatal(err)
+//	}
+//
+// It is safe for concurrent use.
+type Collector struct {
+	mu   sync.Mutex
+	errs []error
+}
+
+// Add records err, if it is not nil.
+func (c *Collector) Add(err error) {
+	if err == nil {
+		return
+	}
+
+	c.mu.Lock()
+	c.errs = append(c.errs, err)
+	c.mu.Unlock()
+}
+
+// Errors returns the errors recorded so far.
+func (c *Collector) Errors() []error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]error(nil), c.errs...)
+}
+
+// Err joins the errors recorded so far, or returns nil when there are none.
+func (c *Collector) Err() error {
+	return errors.Join(c.Errors()...)
+}
+
+// Collect is Default, recording the error in c.
+func Collect[T any](c *Collector, key string, def T) T {
+	return CollectFunc(c, key, def, Parse[T])
+}
+
+// CollectFunc is DefaultFunc, recording the error in c.
+func CollectFunc[T any](c *Collector, key string, def T, parse ParseFunc[T]) T {
+	v, err := DefaultFunc(key, def, parse)
+	c.Add(err)
+
+	return v
+}
+
+// Require is Get, recording the error in c, including when the variable is
+// unset or empty.
+func Require[T any](c *Collector, key string) T {
+	return RequireFunc(c, key, Parse[T])
+}
+
+// RequireFunc is GetFunc, recording the error in c.
+func RequireFunc[T any](c *Collector, key string, parse ParseFunc[T]) T {
+	v, err := GetFunc(key, parse)
+	c.Add(err)
+
+	return v
+}
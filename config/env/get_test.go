@@ -0,0 +1,133 @@
+package env
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type level string
+
+func TestGet(t *testing.T) {
+	t.Setenv("TEST_ENV_INT", "42")
+	t.Setenv("TEST_ENV_BOOL", "true")
+	t.Setenv("TEST_ENV_DURATION", "1m30s")
+	t.Setenv("TEST_ENV_SLICE", "a, b,,c")
+	t.Setenv("TEST_ENV_INTS", "1,2")
+	t.Setenv("TEST_ENV_MAP", "a=1, b = 2")
+	t.Setenv("TEST_ENV_URL", "https://example.com/v1")
+	t.Setenv("TEST_ENV_LEVEL", "debug")
+	t.Setenv("TEST_ENV_EMPTY", "")
+
+	if v, err := Get[int]("TEST_ENV_INT"); err != nil || v != 42 {
+		t.Errorf("Get[int]() = %v, %v", v, err)
+	}
+	if v, err := Get[bool]("TEST_ENV_BOOL"); err != nil || !v {
+		t.Errorf("Get[bool]() = %v, %v", v, err)
+	}
+	if v, err := Get[time.Duration]("TEST_ENV_DURATION"); err != nil || v != 90*time.Second {
+		t.Errorf("Get[time.Duration]() = %v, %v", v, err)
+	}
+	if v, err := Get[[]string]("TEST_ENV_SLICE"); err != nil || !reflect.DeepEqual(v, []string{"a", "b", "c"}) {
+		t.Errorf("Get[[]string]() = %v, %v", v, err)
+	}
+	if v, err := Get[[]int]("TEST_ENV_INTS"); err != nil || !reflect.DeepEqual(v, []int{1, 2}) {
+		t.Errorf("Get[[]int]() = %v, %v", v, err)
+	}
+	if v, err := Get[map[string]int]("TEST_ENV_MAP"); err != nil || !reflect.DeepEqual(v, map[string]int{"a": 1, "b": 2}) {
+		t.Errorf("Get[map[string]int]() = %v, %v", v, err)
+	}
+	if v, err := Get[level]("TEST_ENV_LEVEL"); err != nil || v != "debug" {
+		t.Errorf("Get[level]() = %v, %v", v, err)
+	}
+	if v, err := Get[*struct{ X int }]("TEST_ENV_LEVEL"); err == nil {
+		t.Errorf("Get[*struct]() = %v, expected an unsupported type error", v)
+	}
+	if v, err := Get[string]("TEST_ENV_EMPTY"); !errors.Is(err, ErrNotSet) {
+		t.Errorf("Get[string]() of an empty variable = %q, %v", v, err)
+	}
+
+	u, err := Get[urlValue]("TEST_ENV_URL")
+	if err != nil || u.Host != "example.com" {
+		t.Errorf("Get[urlValue]() = %v, %v", u, err)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	t.Setenv("TEST_ENV_INT", "forty-two")
+
+	v, err := Default("TEST_ENV_INT", 7)
+	var envErr *Error
+	if !errors.As(err, &envErr) || envErr.Key != "TEST_ENV_INT" || v != 7 {
+		t.Errorf("Default() of an invalid value = %v, %v", v, err)
+	}
+	if strings.Contains(err.Error(), "forty-two") {
+		t.Errorf("error %q leaks the value", err)
+	}
+
+	if v, err := Default("TEST_ENV_UNSET", 7); err != nil || v != 7 {
+		t.Errorf("Default() of an unset variable = %v, %v", v, err)
+	}
+
+	upper := func(s string) (string, error) { return strings.ToUpper(s), nil }
+	t.Setenv("TEST_ENV_STR", "abc")
+	if v, err := DefaultFunc("TEST_ENV_STR", "", upper); err != nil || v != "ABC" {
+		t.Errorf("DefaultFunc() = %v, %v", v, err)
+	}
+}
+
+func TestMust(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("expected Must to panic on an unset variable")
+		}
+	}()
+	Must[string]("TEST_ENV_UNSET")
+}
+
+func TestCollector(t *testing.T) {
+	t.Setenv("TEST_ENV_PORT", "http")
+	t.Setenv("TEST_ENV_TIMEOUT", "soon")
+	t.Setenv("TEST_ENV_NAME", "api")
+
+	var c Collector
+	port := Collect(&c, "TEST_ENV_PORT", 8080)
+	timeout := Collect(&c, "TEST_ENV_TIMEOUT", time.Second)
+	name := Require[string](&c, "TEST_ENV_NAME")
+	Require[string](&c, "TEST_ENV_TOKEN")
+
+	if port != 8080 || timeout != time.Second || name != "api" {
+		t.Errorf("collected %v, %v, %v", port, timeout, name)
+	}
+
+	errs := c.Errors()
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 errors, got %v", errs)
+	}
+	for _, key := range []string{"TEST_ENV_PORT", "TEST_ENV_TIMEOUT", "TEST_ENV_TOKEN is not set"} {
+		if !strings.Contains(c.Err().Error(), key) {
+			t.Errorf("Err() = %q does not mention %s", c.Err(), key)
+		}
+	}
+
+	var empty Collector
+	if err := empty.Err(); err != nil {
+		t.Errorf("Err() of an empty Collector = %v", err)
+	}
+}
+
+// urlValue implements Value, like the value types of the config package.
+type urlValue struct {
+	Host string
+}
+
+func (u *urlValue) Set(value string) error {
+	_, rest, ok := strings.Cut(value, "://")
+	if !ok {
+		return errors.New("not a URL")
+	}
+	u.Host, _, _ = strings.Cut(rest, "/")
+	return nil
+}
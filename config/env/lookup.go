@@ -0,0 +1,269 @@
+package env
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// FileSuffix is appended to the name of a variable to read its value from a
+// file instead, e.g. DATABASE_PASSWORD_FILE=/secrets/db for
+// DATABASE_PASSWORD, as exposed by Docker secrets and Nomad templates. The
+// contents are trimmed of surrounding whitespace. Setting both the variable
+// and its file companion is an error.
+const FileSuffix = "_FILE"
+
+// Lookup describes an environment variable that was consulted through this
+// package.
+type Lookup struct {
+	Key   string
+	Value string
+	// Found is true when the variable was present in the environment.
+	Found bool
+	// File is the path the value was read from when it was given with the
+	// FileSuffix companion variable.
+	File string
+	// DotEnvFile is the dotenv file the variable was loaded from, see
+	// LoadFiles.
+	DotEnvFile string
+	// Default is the value used when the variable is unset, as given to the
+	// *Default helpers or Describe.
+	Default string
+	// Flags are the names of the flags the variable provides the default of,
+	// as recorded with Bind or Describe. A variable shared by several
+	// configurations, e.g. AWS_ACCESS_KEY_ID, may be bound to several flags.
+	Flags []string
+	// Usage is the description of the variable, when recorded with Describe.
+	Usage string
+	// Err is the *Error of the lookup when the FileSuffix companion could not
+	// be used, see Err.
+	Err error
+}
+
+var (
+	lookupsMu sync.Mutex
+	lookups   = map[string]Lookup{}
+	// isolated are the flag sets of the running Isolate calls.
+	isolated = map[*flag.FlagSet]int{}
+)
+
+// Isolate makes the flags registered on f with StringVar, BoolVar and
+// DurationVar default to the default given to them, without reading or
+// binding their variables, until the returned function is called, e.g. to
+// register flags only to describe them. Lookups made otherwise, including by
+// other goroutines, are not affected.
+//
+//	defer env.Isolate(fs)()
+func Isolate(f *flag.FlagSet) func() {
+	lookupsMu.Lock()
+	isolated[f]++
+	lookupsMu.Unlock()
+
+	return func() {
+		lookupsMu.Lock()
+		defer lookupsMu.Unlock()
+		isolated[f]--
+		if isolated[f] <= 0 {
+			delete(isolated, f)
+		}
+	}
+}
+
+// Isolated reports whether f is isolated with Isolate, for helpers other
+// than StringVar, BoolVar and DurationVar reading the defaults of the flags
+// they register from the environment.
+func Isolated(f *flag.FlagSet) bool {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+
+	return isolated[f] > 0
+}
+
+// lookup wraps os.LookupEnv, honouring the FileSuffix companion of key, and
+// records the lookup so callers can later tell which values came from the
+// environment. Errors reading the companion are *Error.
+func lookup(key string) (string, bool, error) {
+	value, ok := os.LookupEnv(key)
+	l := Lookup{Key: key, Value: value, Found: ok}
+
+	var err error
+	if path := os.Getenv(key + FileSuffix); path != "" {
+		if value != "" {
+			err = &Error{Key: key, Err: fmt.Errorf("both %s and %s are set, unset one of them", key, key+FileSuffix)}
+		} else if contents, readErr := os.ReadFile(path); readErr != nil {
+			err = &Error{Key: key, Err: fmt.Errorf("failed to read %s: %w", key+FileSuffix, readErr)}
+		} else {
+			value, ok = strings.TrimSpace(string(contents)), true
+			l = Lookup{Key: key, Value: value, Found: true, File: path}
+		}
+	}
+
+	lookupsMu.Lock()
+	if ok {
+		l.DotEnvFile = dotEnvFiles[key]
+	}
+	prev := lookups[key]
+	l.Default, l.Flags, l.Usage, l.Err = prev.Default, prev.Flags, prev.Usage, err
+	lookups[key] = l
+	lookupsMu.Unlock()
+
+	if err != nil {
+		return "", false, err
+	}
+
+	return value, ok, nil
+}
+
+// LookupEnv is os.LookupEnv for variables read outside of the helpers of
+// this package, e.g. referenced by a configuration file: it honours the
+// FileSuffix companion of key and records the lookup, so the variable is
+// listed by Lookups rather than Unused. Errors reading the companion are
+// *Error.
+func LookupEnv(key string) (string, bool, error) {
+	return lookup(key)
+}
+
+// lookupEnv is lookup for helpers that cannot return an error. A FileSuffix
+// companion that cannot be used leaves the variable unset, and the error is
+// recorded for Err.
+func lookupEnv(key string) (string, bool) {
+	value, ok, _ := lookup(key)
+
+	return value, ok
+}
+
+// lookupValue behaves like os.Getenv.
+func lookupValue(key string) string {
+	value, _ := lookupEnv(key)
+	return value
+}
+
+// lookupDefault is lookupEnv for helpers with a default, which is recorded
+// with the lookup.
+func lookupDefault(key, def string) (string, bool) {
+	recordDefault(key, def)
+	return lookupEnv(key)
+}
+
+func recordDefault(key, def string) {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+
+	l := lookups[key]
+	l.Key, l.Default = key, def
+	lookups[key] = l
+}
+
+// Describe binds the variable key to flag like Bind, and records the default
+// used when it is unset and its description, for variables read outside of
+// RegisterFlags or to document them better in Lookups. It does not read the
+// variable.
+func Describe(key, flag, def, usage string) {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+
+	l := lookups[key]
+	l.Key, l.Flags, l.Default, l.Usage = key, appendFlag(l.Flags, flag), def, usage
+	lookups[key] = l
+}
+
+// Bind records that the variable key provides the default of the flag name,
+// so the configuration can tell which flags were set from the environment.
+// StringVar, BoolVar and DurationVar bind the variables they read; flags
+// whose default is read otherwise should bind every variable they read.
+func Bind(key, flag string) {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+
+	l := lookups[key]
+	l.Key, l.Flags = key, appendFlag(l.Flags, flag)
+	lookups[key] = l
+}
+
+// appendFlag adds flag to flags unless it is empty or already there. flags
+// is copied since it may be shared with a Lookup returned by Lookups.
+func appendFlag(flags []string, flag string) []string {
+	if flag == "" {
+		return flags
+	}
+	for _, f := range flags {
+		if f == flag {
+			return flags
+		}
+	}
+
+	return append(append([]string(nil), flags...), flag)
+}
+
+// Err returns the errors of the variables whose most recent lookup failed
+// because their FileSuffix companion could not be used, e.g. when both
+// DATABASE_PASSWORD and DATABASE_PASSWORD_FILE are set, sorted by key and
+// joined, or nil. The GetEnv*Default helpers cannot return those errors and
+// treat the variable as unset instead, so programs must check Err once they
+// are done reading the environment, like config.ParseConfiguration does
+// after RegisterFlags, or use Default.
+func Err() error {
+	var errs []error
+	for _, l := range Lookups() {
+		if l.Err != nil {
+			errs = append(errs, l.Err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Unused returns the variables of the environment starting with one of
+// prefixes, e.g. "S3_", that were never consulted through this package,
+// sorted. Companions of consulted variables, see FileSuffix, are not
+// reported. They are most likely typos of a consulted variable.
+func Unused(prefixes ...string) []string {
+	lookupsMu.Lock()
+	defer lookupsMu.Unlock()
+
+	var out []string
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+
+		matched := false
+		for _, prefix := range prefixes {
+			matched = matched || strings.HasPrefix(key, prefix)
+		}
+		if !matched {
+			continue
+		}
+
+		if _, ok := lookups[key]; ok {
+			continue
+		}
+		if _, ok := lookups[strings.TrimSuffix(key, FileSuffix)]; ok {
+			continue
+		}
+		out = append(out, key)
+	}
+	sort.Strings(out)
+
+	return out
+}
+
+// Lookups returns every environment variable consulted through this package
+// so far, or bound with Bind or Describe, sorted by key. Only the most recent
+// lookup of each key is kept.
+func Lookups() []Lookup {
+	lookupsMu.Lock()
+	out := make([]Lookup, 0, len(lookups))
+	for _, l := range lookups {
+		out = append(out, l)
+	}
+	lookupsMu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Key < out[j].Key
+	})
+
+	return out
+}
@@ -0,0 +1,171 @@
+package env
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFileSuffix(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "db")
+	if err := os.WriteFile(secret, []byte("hunter2\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TEST_ENV_PASSWORD_FILE", secret)
+	if v := GetEnvStrDefault("TEST_ENV_PASSWORD", "default"); v != "hunter2" {
+		t.Errorf("GetEnvStrDefault() = %q, want the trimmed file contents", v)
+	}
+	if v, err := Get[string]("TEST_ENV_PASSWORD"); err != nil || v != "hunter2" {
+		t.Errorf("Get[string]() = %q, %v", v, err)
+	}
+	for _, l := range Lookups() {
+		if l.Key == "TEST_ENV_PASSWORD" && l.File != secret {
+			t.Errorf("Lookup = %+v, want File %s", l, secret)
+		}
+	}
+
+	t.Setenv("TEST_ENV_PASSWORD", "hunter3")
+	if _, err := GetEnvStr("TEST_ENV_PASSWORD"); err == nil || !strings.Contains(err.Error(), "both TEST_ENV_PASSWORD and TEST_ENV_PASSWORD_FILE are set") {
+		t.Errorf("GetEnvStr() with both set error = %v", err)
+	}
+
+	t.Setenv("TEST_ENV_PASSWORD", "")
+	t.Setenv("TEST_ENV_PASSWORD_FILE", filepath.Join(dir, "missing"))
+	_, err := Default("TEST_ENV_PASSWORD", "default")
+	var envErr *Error
+	if !errors.As(err, &envErr) || !errors.Is(err, os.ErrNotExist) || !strings.Contains(err.Error(), "failed to read TEST_ENV_PASSWORD_FILE") {
+		t.Errorf("Default() with a missing file error = %v", err)
+	}
+
+	if v := GetEnvStrDefault("TEST_ENV_PASSWORD", "default"); v != "default" {
+		t.Errorf("GetEnvStrDefault() with a missing file = %q, want the default", v)
+	}
+	if err := Err(); !errors.As(err, &envErr) || !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Err() with a missing file = %v", err)
+	}
+}
+
+func TestErr(t *testing.T) {
+	dir := t.TempDir()
+	secret := filepath.Join(dir, "token")
+	if err := os.WriteFile(secret, []byte("s3cr3t"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv("TEST_ENV_TOKEN", "inline")
+	t.Setenv("TEST_ENV_TOKEN_FILE", secret)
+	t.Setenv("TEST_ENV_DEBUG_FILE", filepath.Join(dir, "missing"))
+
+	if v := GetEnvStrDefault("TEST_ENV_TOKEN", "default"); v != "default" {
+		t.Errorf("GetEnvStrDefault() with both set = %q, want the default", v)
+	}
+	if v := GetEnvBoolDefault("TEST_ENV_DEBUG", true); !v {
+		t.Error("GetEnvBoolDefault() with a missing file = false, want the default")
+	}
+	if v := GetEnvDurDefault("TEST_ENV_DEBUG", time.Second); v != time.Second {
+		t.Errorf("GetEnvDurDefault() with a missing file = %s, want the default", v)
+	}
+
+	err := Err()
+	for _, want := range []string{"both TEST_ENV_TOKEN and TEST_ENV_TOKEN_FILE are set", "failed to read TEST_ENV_DEBUG_FILE"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("Err() = %v, want %q", err, want)
+		}
+	}
+
+	// the error is cleared once the variable is read successfully.
+	t.Setenv("TEST_ENV_TOKEN", "")
+	t.Setenv("TEST_ENV_DEBUG_FILE", "")
+	GetEnvStrDefault("TEST_ENV_TOKEN", "default")
+	GetEnvBoolDefault("TEST_ENV_DEBUG", true)
+	if err := Err(); err != nil && (strings.Contains(err.Error(), "TEST_ENV_TOKEN") || strings.Contains(err.Error(), "TEST_ENV_DEBUG")) {
+		t.Errorf("Err() = %v after fixing the variables", err)
+	}
+}
+
+func TestDefaultHelpersRecordFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	t.Setenv("TEST_ENV_SECRET", "inline")
+	t.Setenv("TEST_ENV_SECRET_FILE", filepath.Join(dir, "secret"))
+	t.Setenv("TEST_ENV_VERBOSE_FILE", filepath.Join(dir, "missing"))
+	t.Setenv("TEST_ENV_TIMEOUT_FILE", filepath.Join(dir, "missing"))
+
+	// the *Default helpers return the default and record the errors for Err.
+	if v := GetEnvStrDefault("TEST_ENV_SECRET", "default"); v != "default" {
+		t.Errorf("GetEnvStrDefault() = %q, want the default", v)
+	}
+	if v := GetEnvBoolDefault("TEST_ENV_VERBOSE", true); !v {
+		t.Error("GetEnvBoolDefault() = false, want the default")
+	}
+	if v := GetEnvDurDefault("TEST_ENV_TIMEOUT", time.Second); v != time.Second {
+		t.Errorf("GetEnvDurDefault() = %s, want the default", v)
+	}
+
+	err := Err()
+	if err == nil {
+		t.Fatal("Err() = nil, want the errors of the file companions")
+	}
+	for _, want := range []string{
+		"invalid environment variable TEST_ENV_SECRET: both TEST_ENV_SECRET and TEST_ENV_SECRET_FILE are set",
+		"invalid environment variable TEST_ENV_VERBOSE: failed to read TEST_ENV_VERBOSE_FILE",
+		"invalid environment variable TEST_ENV_TIMEOUT: failed to read TEST_ENV_TIMEOUT_FILE",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Err() = %v, want it to contain %q", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "inline") {
+		t.Errorf("Err() leaks the value of the variable: %v", err)
+	}
+
+	// Default returns the error instead.
+	if v, err := Default("TEST_ENV_SECRET", "default"); v != "default" || err == nil {
+		t.Errorf("Default() = %q, %v, want the default and an error", v, err)
+	}
+
+	// fixing the variables clears their errors.
+	t.Setenv("TEST_ENV_SECRET_FILE", "")
+	t.Setenv("TEST_ENV_VERBOSE_FILE", "")
+	t.Setenv("TEST_ENV_TIMEOUT_FILE", "")
+	GetEnvStrDefault("TEST_ENV_SECRET", "default")
+	GetEnvBoolDefault("TEST_ENV_VERBOSE", true)
+	GetEnvDurDefault("TEST_ENV_TIMEOUT", time.Second)
+}
+
+func TestIsolate(t *testing.T) {
+	t.Setenv("TEST_ENV_ISOLATED", "from-env")
+
+	isolated := flag.NewFlagSet("isolated", flag.ContinueOnError)
+	release := Isolate(isolated)
+	var value string
+	StringVar(isolated, &value, "isolated", "TEST_ENV_ISOLATED", "default", "")
+	if value != "default" {
+		t.Errorf("StringVar() on an isolated flag set = %q, want the default", value)
+	}
+	for _, l := range Lookups() {
+		if l.Key == "TEST_ENV_ISOLATED" {
+			t.Errorf("Lookups() recorded %+v from an isolated flag set", l)
+		}
+	}
+
+	// other flag sets and lookups still see the environment meanwhile.
+	other := flag.NewFlagSet("other", flag.ContinueOnError)
+	StringVar(other, &value, "other", "TEST_ENV_ISOLATED", "default", "")
+	if value != "from-env" {
+		t.Errorf("StringVar() on another flag set = %q, want from-env", value)
+	}
+	if v := GetEnvStrDefault("TEST_ENV_ISOLATED", "default"); v != "from-env" {
+		t.Errorf("GetEnvStrDefault() during Isolate = %q, want from-env", v)
+	}
+
+	release()
+	if Isolated(isolated) {
+		t.Error("Isolated() after release = true")
+	}
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+const EnvHelpFlag = "help.env"
+
+const EnvFileFlag = "env.file"
+
+// ParseEnvFileParameters returns the dotenv files to load: the -env.file
+// values in args, or else the comma separated files of the
+// BASEPLATE_ENV_FILE environment variable.
+func ParseEnvFileParameters(args []string) []string {
+	if files := parseRepeatedFlagParameter(args, EnvFileFlag); len(files) > 0 {
+		return files
+	}
+
+	var files []string
+	for _, file := range strings.Split(os.Getenv(env.EnvFileVariable), ",") {
+		if file = strings.TrimSpace(file); file != "" {
+			files = append(files, file)
+		}
+	}
+
+	return files
+}
+
+// ParseEnvHelpParameter reports whether -help.env was passed in args.
+func ParseEnvHelpParameter(args []string) bool {
+	return parseBoolParameter(args, EnvHelpFlag)
+}
+
+// envVariable is an environment variable read while registering the flags of
+// the configuration.
+type envVariable struct {
+	Key   string
+	Flags []string
+	// Default is the value used when the variable is unset.
+	Default string
+	Usage   string
+	// Set is true when the variable or its env.FileSuffix companion is set.
+	Set    bool
+	Secret bool
+}
+
+// envVariables lists every variable consulted through the env package, with
+// the flags of fs each provides the default of, as bound with env.Bind or
+// env.Describe. Variables read outside of RegisterFlags are listed without
+// flags.
+func envVariables(config any, fs *flag.FlagSet) []envVariable {
+	flagsByAddr := flagsByAddress(fs)
+	secretFlags := map[string]bool{}
+	walkFields(config, func(f field) {
+		if fl := f.flag(flagsByAddr); fl != nil && isSecret(f) {
+			secretFlags[fl.Name] = true
+		}
+	})
+
+	var vars []envVariable
+	for _, l := range env.Lookups() {
+		v := envVariable{
+			Key:     l.Key,
+			Default: l.Default,
+			Usage:   l.Usage,
+			Set:     l.Found && l.Value != "",
+			Secret:  isSecretName(l.Key),
+		}
+
+		// variables may be bound to flags of other flag sets, e.g. another
+		// configuration of the program, which are left out.
+		for _, name := range l.Flags {
+			fl := fs.Lookup(name)
+			if fl == nil {
+				continue
+			}
+			v.Flags = append(v.Flags, name)
+			if v.Usage == "" {
+				v.Usage = fl.Usage
+			}
+			v.Secret = v.Secret || secretFlags[name]
+		}
+
+		// defaults may be read from other variables, e.g. AWS_SECRET_ACCESS_KEY
+		// for S3_SECRET_ACCESS_KEY, so they are redacted like the values.
+		if v.Secret && v.Default != "" {
+			v.Default = redactedValue
+		}
+
+		vars = append(vars, v)
+	}
+
+	return vars
+}
+
+// envError returns the errors of the environment variables whose
+// env.FileSuffix companion could not be used, see env.Err. It covers every
+// variable consulted through the env package, whether it provides the default
+// of a flag or is read elsewhere, e.g. with env.GetEnvStrDefault in main. The
+// GetEnv* helpers fall back to the default instead of failing, so this is
+// checked once the flags are registered.
+func envError() error {
+	return env.Err()
+}
+
+// isSecretName reports whether the name of an environment variable matches
+// secretNameParts.
+func isSecretName(key string) bool {
+	normalized := strings.ToLower(strings.ReplaceAll(key, "_", ""))
+	for _, part := range secretNameParts {
+		if strings.Contains(normalized, part) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// writeEnvTable writes vars as an aligned table.
+func writeEnvTable(w io.Writer, vars []envVariable) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "VARIABLE\tFLAG\tDEFAULT\tSET\tDESCRIPTION")
+	for _, v := range vars {
+		flagNames := make([]string, len(v.Flags))
+		for i, name := range v.Flags {
+			flagNames[i] = "-" + name
+		}
+		set := "no"
+		if v.Set {
+			set = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", v.Key, strings.Join(flagNames, ","), v.Default, set, v.Usage)
+	}
+
+	return tw.Flush()
+}
+
+// sharedEnvPrefixes are prefixes of variables that are set by the platform,
+// e.g. NOMAD_ALLOC_ID, or read by libraries without the env package, e.g.
+// AWS_PROFILE. They are not checked for typos unless given to
+// WithEnvPrefixes.
+var sharedEnvPrefixes = []string{"AWS_", "CONSUL_", "NOMAD_", "OTEL_", "VAULT_"}
+
+// WithEnvPrefixes sets the prefixes of the environment variables that are
+// expected to be read by the configuration, e.g. "S3_". Once the flags are
+// registered, variables with one of the prefixes that were never read are
+// logged as likely typos. By default, the prefixes are the first segments of
+// the variables read, e.g. S3_ for S3_SECRET_ACCESS_KEY, except for
+// sharedEnvPrefixes. Passing no prefix disables the warning.
+func WithEnvPrefixes(prefixes ...string) ParseOption {
+	return func(o *Parser) {
+		o.envPrefixes = append([]string{}, prefixes...)
+	}
+}
+
+// unusedEnvPrefixes returns the prefixes of the variables checked for typos.
+func (p *Parser) unusedEnvPrefixes() []string {
+	if p.envPrefixes != nil {
+		return p.envPrefixes
+	}
+
+	seen := map[string]bool{}
+	var prefixes []string
+	for _, l := range env.Lookups() {
+		i := strings.Index(l.Key, "_")
+		if i <= 0 {
+			continue
+		}
+
+		prefix := l.Key[:i+1]
+		shared := false
+		for _, s := range sharedEnvPrefixes {
+			shared = shared || prefix == s
+		}
+		if !shared && !seen[prefix] {
+			seen[prefix] = true
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	sort.Strings(prefixes)
+
+	return prefixes
+}
+
+// warnUnusedEnv logs the environment variables that look like they are meant
+// for the configuration but were never read.
+func (p *Parser) warnUnusedEnv(logger *slog.Logger) {
+	prefixes := p.unusedEnvPrefixes()
+	if len(prefixes) == 0 {
+		return
+	}
+
+	lookups := env.Lookups()
+	for _, key := range env.Unused(prefixes...) {
+		attrs := []any{"key", key}
+		if suggestion, ok := closestEnvKey(key, lookups); ok {
+			attrs = append(attrs, "did_you_mean", suggestion)
+		}
+		logger.Warn("environment variable is set but never read by the configuration, check it for typos", attrs...)
+	}
+}
+
+// closestEnvKey returns the consulted variable closest to key, if it is close
+// enough to be a typo of it: at most one edit for every four characters of
+// key, and at least one.
+func closestEnvKey(key string, lookups []env.Lookup) (string, bool) {
+	maxDistance := len(key) / 4
+	if maxDistance < 1 {
+		maxDistance = 1
+	}
+
+	best, bestDistance := "", maxDistance+1
+	for _, l := range lookups {
+		if d := editDistance(key, l.Key); d < bestDistance {
+			best, bestDistance = l.Key, d
+		}
+	}
+
+	return best, best != ""
+}
+
+// editDistance is the Levenshtein distance between a and b.
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j-1] + cost
+			if prev[j]+1 < curr[j] {
+				curr[j] = prev[j] + 1
+			}
+			if curr[j-1]+1 < curr[j] {
+				curr[j] = curr[j-1] + 1
+			}
+		}
+		prev, curr = curr, prev
+	}
+
+	return prev[len(b)]
+}
@@ -0,0 +1,240 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type envHelpConfig struct {
+	sync.Mutex
+
+	Region  string `toml:"region"`
+	Secret  string `toml:"secret_access_key"`
+	Storage struct {
+		Bucket string `toml:"bucket" default:"assets" env:"ENVHELP_BUCKET" usage:"bucket to store assets in"`
+	} `toml:"storage"`
+}
+
+func (c *envHelpConfig) RegisterFlags(f *flag.FlagSet) {
+	env.Bind("ENVHELP_REGION", "envhelp.region")
+	f.StringVar(&c.Region, "envhelp.region", env.GetEnvStrDefault("ENVHELP_REGION", "us-east-1"), "region of the bucket")
+	env.Bind("ENVHELP_SECRET_ACCESS_KEY", "envhelp.secret-access-key")
+	env.Bind("ENVHELP_FALLBACK", "envhelp.secret-access-key")
+	f.StringVar(&c.Secret, "envhelp.secret-access-key", env.GetEnvStrDefault("ENVHELP_SECRET_ACCESS_KEY", env.GetEnvStrDefault("ENVHELP_FALLBACK", "")), "secret access key")
+	RegisterStructFlags(f, "envhelp", &c.Storage)
+}
+
+func (c *envHelpConfig) Validate() error {
+	return nil
+}
+
+func (c *envHelpConfig) Merge(WatchableConfiguration) error {
+	return nil
+}
+
+func TestParserEnvHelp(t *testing.T) {
+	t.Setenv("ENVHELP_REGION", "eu-west-1")
+	t.Setenv("ENVHELP_FALLBACK", "hunter2")
+
+	// bound to flags of this configuration and of another flag set.
+	env.Bind("ENVHELP_SHARED", "envhelp.region")
+	env.Bind("ENVHELP_SHARED", "other.region")
+	env.Bind("ENVHELP_SHARED", "envhelp.bucket")
+
+	var out bytes.Buffer
+	p, _ := newTestParser(nil, "-help.env")
+	p.Output = &out
+
+	if err := p.Parse(context.Background(), &envHelpConfig{}, nil); !errors.Is(err, ErrExplained) {
+		t.Fatalf("Parse() error = %v, want ErrExplained", err)
+	}
+
+	rows := map[string]string{}
+	for _, line := range strings.Split(out.String(), "\n") {
+		if key, _, ok := strings.Cut(line, " "); ok {
+			rows[key] = strings.Join(strings.Fields(line), " ")
+		}
+	}
+	for key, want := range map[string]string{
+		"ENVHELP_REGION":            "ENVHELP_REGION -envhelp.region us-east-1 yes region of the bucket",
+		"ENVHELP_SECRET_ACCESS_KEY": "ENVHELP_SECRET_ACCESS_KEY -envhelp.secret-access-key " + redactedValue + " no secret access key",
+		"ENVHELP_BUCKET":            "ENVHELP_BUCKET -envhelp.bucket assets no bucket to store assets in",
+		"ENVHELP_FALLBACK":          "ENVHELP_FALLBACK -envhelp.secret-access-key yes secret access key",
+		"ENVHELP_SHARED":            "ENVHELP_SHARED -envhelp.region,-envhelp.bucket no region of the bucket",
+	} {
+		if rows[key] != want {
+			t.Errorf("row %s = %q, want %q", key, rows[key], want)
+		}
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("-help.env output leaks a secret:\n%s", out.String())
+	}
+}
+
+func TestParserWarnsUnusedEnv(t *testing.T) {
+	t.Setenv("ENVHELP_SECERT_ACCESS_KEY", "hunter2")
+	t.Setenv("ENVHELP_SECRET_ACCESS_KEY_FILE", "")
+	t.Setenv("UNRELATED_VALUE", "1")
+
+	var logs bytes.Buffer
+	p, _ := newTestParser(nil, "-envhelp.bucket", "media")
+	p.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Parse(ctx, &envHelpConfig{}, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if !strings.Contains(logs.String(), "key=ENVHELP_SECERT_ACCESS_KEY did_you_mean=ENVHELP_SECRET_ACCESS_KEY") {
+		t.Errorf("expected a warning for the misspelled variable, got:\n%s", logs.String())
+	}
+	for _, key := range []string{"ENVHELP_SECRET_ACCESS_KEY_FILE", "UNRELATED_VALUE"} {
+		if strings.Contains(logs.String(), "key="+key) {
+			t.Errorf("unexpected warning for %s:\n%s", key, logs.String())
+		}
+	}
+
+	logs.Reset()
+	p, _ = newTestParser(nil, "-envhelp.bucket", "media")
+	p.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	WithEnvPrefixes()(p)
+	if err := p.Parse(ctx, &envHelpConfig{}, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if strings.Contains(logs.String(), "ENVHELP_SECERT_ACCESS_KEY") {
+		t.Errorf("expected WithEnvPrefixes() to disable the warning, got:\n%s", logs.String())
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"S3_SECERT_ACCESS_KEY", "S3_SECRET_ACCESS_KEY", 2},
+		{"kitten", "sitting", 3},
+	} {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestClosestEnvKey(t *testing.T) {
+	lookups := []env.Lookup{{Key: "S3_BUCKET"}, {Key: "S3_SECRET_ACCESS_KEY"}, {Key: "DB_HOST"}}
+	for key, want := range map[string]string{
+		"S3_BUKET":            "S3_BUCKET",
+		"S3_SECERT_ACESS_KEY": "S3_SECRET_ACCESS_KEY",
+		"S3_SECRET_ACCESS_KY": "S3_SECRET_ACCESS_KEY",
+		"DB_PORT":             "",
+		"S3_REGION":           "",
+		"S3_SESSION_TOKEN":    "",
+		"S3_ACCESS_KEY_ID":    "",
+		"OTHER_SECRET_ACCESS": "",
+		"S3_BUCKET_REGION":    "",
+	} {
+		got, ok := closestEnvKey(key, lookups)
+		if got != want || ok != (want != "") {
+			t.Errorf("closestEnvKey(%q) = %q, %v, want %q", key, got, ok, want)
+		}
+	}
+}
+
+func TestParserLoadsEnvFiles(t *testing.T) {
+	// restores ENVHELP_REGION once the test is done.
+	t.Setenv("ENVHELP_REGION", "")
+	os.Unsetenv("ENVHELP_REGION")
+
+	file := writeFile(t, t.TempDir(), ".env", "export ENVHELP_REGION=ap-south-1\n")
+	t.Setenv(env.EnvFileVariable, file)
+
+	p, _ := newTestParser(nil, "-envhelp.bucket", "media")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &envHelpConfig{}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if cfg.Region != "ap-south-1" {
+		t.Errorf("Region = %q, want the value of the env file", cfg.Region)
+	}
+
+	p, _ = newTestParser(nil, "-env.file", filepath.Join(t.TempDir(), "missing"))
+	if err := p.Parse(ctx, &envHelpConfig{}, nil); err == nil {
+		t.Error("expected a missing -env.file to fail")
+	}
+}
+
+func TestParseEnvFileParameters(t *testing.T) {
+	t.Setenv(env.EnvFileVariable, ".env, .env.local")
+
+	if got := ParseEnvFileParameters(nil); !reflect.DeepEqual(got, []string{".env", ".env.local"}) {
+		t.Errorf("ParseEnvFileParameters() = %v", got)
+	}
+	if got := ParseEnvFileParameters([]string{"-env.file", "a.env", "--env.file=b.env"}); !reflect.DeepEqual(got, []string{"a.env", "b.env"}) {
+		t.Errorf("ParseEnvFileParameters() = %v", got)
+	}
+}
+
+// setenvFile sets the env.FileSuffix companion of key to path for the test.
+// Once the environment is restored, key is read again so a failed lookup is
+// not reported by envError to the tests that follow.
+func setenvFile(t *testing.T, key, path string) {
+	t.Helper()
+	t.Cleanup(func() {
+		env.GetEnvStr(key)
+	})
+	t.Setenv(key+env.FileSuffix, path)
+}
+
+func TestParserEnvOutsideFlags(t *testing.T) {
+	t.Setenv("ENVHELP_WORKERS", "8")
+	if _, err := env.Default("ENVHELP_WORKERS", 4); err != nil {
+		t.Fatalf("Default() error: %v", err)
+	}
+
+	var out bytes.Buffer
+	p, _ := newTestParser(nil, "-help.env")
+	p.Output = &out
+	if err := p.Parse(context.Background(), &envHelpConfig{}, nil); !errors.Is(err, ErrExplained) {
+		t.Fatalf("Parse() error = %v, want ErrExplained", err)
+	}
+	if !strings.Contains(out.String(), "ENVHELP_WORKERS") {
+		t.Errorf("-help.env does not list a variable read outside of RegisterFlags:\n%s", out.String())
+	}
+
+	t.Setenv("ENVHELP_WORKERZ", "8")
+	var logs bytes.Buffer
+	p, _ = newTestParser(nil, "-envhelp.bucket", "media")
+	p.Logger = slog.New(slog.NewTextHandler(&logs, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if err := p.Parse(ctx, &envHelpConfig{}, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if !strings.Contains(logs.String(), "key=ENVHELP_WORKERZ did_you_mean=ENVHELP_WORKERS") {
+		t.Errorf("expected a suggestion of the variable read outside of RegisterFlags, got:\n%s", logs.String())
+	}
+
+	setenvFile(t, "ENVHELP_WORKERS", "/run/secrets/workers")
+	env.Default("ENVHELP_WORKERS", 4)
+	p, _ = newTestParser(nil, "-envhelp.bucket", "media")
+	if err := p.Parse(ctx, &envHelpConfig{}, nil); err == nil || !strings.Contains(err.Error(), "both ENVHELP_WORKERS and ENVHELP_WORKERS_FILE are set") {
+		t.Errorf("Parse() error = %v, want the error of the variable read outside of RegisterFlags", err)
+	}
+}
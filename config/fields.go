@@ -0,0 +1,142 @@
+package config
+
+import (
+	"encoding"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// field is a leaf value of a configuration struct, identified by the path of
+// toml keys leading to it.
+type field struct {
+	path        []string
+	value       reflect.Value
+	structField reflect.StructField
+}
+
+func (f field) key() string {
+	return strings.Join(f.path, ".")
+}
+
+var (
+	timeType            = reflect.TypeOf(time.Time{})
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// walkFields calls fn for every exported leaf field reachable from config,
+// which must be a pointer to a struct. Nested structs and non-nil pointers to
+// structs are descended into, embedded structs without a toml tag are
+// flattened like the toml decoder does, and fields tagged `toml:"-"` are
+// skipped.
+func walkFields(config any, fn func(field)) {
+	walk(config, false, fn)
+}
+
+// walkFieldsRLocked is walkFields holding the read lock of config, and of
+// every nested struct it descends into, that has an RLock method, e.g.
+// because it embeds a sync.RWMutex, while their fields are visited. Nested
+// configurations are merged under their own lock, so the lock of the
+// top-level configuration alone does not keep them from changing.
+func walkFieldsRLocked(config any, fn func(field)) {
+	walk(config, true, fn)
+}
+
+func walk(config any, rlock bool, fn func(field)) {
+	v := reflect.ValueOf(config)
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return
+	}
+
+	walkStruct(v, nil, rlock, fn)
+}
+
+type rLocker interface {
+	RLock()
+	RUnlock()
+}
+
+// walkStruct walks the fields of v. When rlock is set, the lock of v, if
+// any, is held while they are visited.
+func walkStruct(v reflect.Value, path []string, rlock bool, fn func(field)) {
+	if rlock && v.CanAddr() {
+		if l, ok := v.Addr().Interface().(rLocker); ok {
+			l.RLock()
+			defer l.RUnlock()
+		}
+	}
+	walkStructFields(v, path, rlock, fn)
+}
+
+func walkStructFields(v reflect.Value, path []string, rlock bool, fn func(field)) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, tagged := tomlName(sf)
+		if name == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if sf.Anonymous && !tagged && isStruct(sf.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			// the methods of embedded structs are promoted, so the lock of
+			// an embedded struct is the one of v, which is already held.
+			walkStructFields(fv, path, rlock, fn)
+			continue
+		}
+
+		fieldPath := append(append([]string{}, path...), name)
+		if isStruct(sf.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					continue
+				}
+				fv = fv.Elem()
+			}
+			walkStruct(fv, fieldPath, rlock, fn)
+			continue
+		}
+
+		fn(field{path: fieldPath, value: fv, structField: sf})
+	}
+}
+
+// tomlName returns the key used for sf in a toml document and whether it was
+// set explicitly with a tag.
+func tomlName(sf reflect.StructField) (string, bool) {
+	tag := sf.Tag.Get("toml")
+	if name, _, _ := strings.Cut(tag, ","); name != "" {
+		return name, true
+	}
+
+	return sf.Name, false
+}
+
+// isStruct reports whether t is a struct, or pointer to a struct, that should
+// be descended into rather than treated as a single value.
+func isStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+
+	return !reflect.PointerTo(t).Implements(textUnmarshalerType)
+}
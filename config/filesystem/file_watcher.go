@@ -2,7 +2,10 @@ package filesystem
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
@@ -30,6 +33,7 @@ type fileWatcher struct {
 	configFilesLock  sync.RWMutex
 	logger           zerolog.Logger
 	reconcileTimeout time.Duration
+	changeDetection  ChangeDetection
 	cancel           context.CancelFunc
 	done             chan interface{}
 	stopOnce         sync.Once
@@ -42,16 +46,71 @@ type fileWatcher struct {
 
 type watchedFile struct {
 	modTime time.Time
+	// contents of the regular files the watched path is or contains, keyed
+	// by filename, when changes are detected by content.
+	contents map[string]*fileContent
+}
+
+// fileContent is the state of a regular file when it was last hashed.
+type fileContent struct {
+	modTime time.Time
+	size    int64
+	hash    string
 }
 
 type FileWatcherEvent struct {
 	Filenames []string
+	// Hashes holds the hex encoded SHA-256 of the changed files before and
+	// after the change, when changes are detected by content. It is keyed by
+	// the path of the file, which is inside a directory of Filenames when a
+	// directory is watched. A new file has an empty Old hash, and a removed
+	// one an empty New hash.
+	Hashes map[string]FileHashes
+}
+
+// FileHashes are the hashes of a file before and after a change.
+type FileHashes struct {
+	Old string
+	New string
+}
+
+// ChangeDetection decides when a watched file is considered changed.
+type ChangeDetection int
+
+const (
+	// DetectModTime reports a change whenever the modification time of a
+	// file changes, or fsnotify reports a write, even if the content stayed
+	// the same.
+	DetectModTime ChangeDetection = iota
+	// DetectContent reports a change only when the SHA-256 of the content
+	// of a file changes, so touching a file or rendering it again with the
+	// same content does not fire an event. Files are hashed by the reconcile
+	// loop, every 200ms, rather than on every fsnotify event, which also
+	// catches rewrites within the granularity of the modification time.
+	DetectContent
+	// DetectContentPrecheck is DetectContent, except that files whose size
+	// and modification time did not change are not hashed again on
+	// reconcile. It is cheaper for large files, but misses a rewrite to the
+	// same size within the granularity of the modification time.
+	DetectContentPrecheck
+)
+
+// FileWatcherOption configures the watchers returned by NewFileWatcher and
+// NewRateLimitedFileWatcher.
+type FileWatcherOption func(*fileWatcher)
+
+// WithChangeDetection sets how changes are detected. Defaults to
+// DetectModTime.
+func WithChangeDetection(mode ChangeDetection) FileWatcherOption {
+	return func(w *fileWatcher) {
+		w.changeDetection = mode
+	}
 }
 
 // NewFileWatcher create a file watcher that will watch all the files/folders from configFiles
 // if success a fileWatcher will be returned and a nil error
 // otherwise an error and a nil fileWatcher are returned
-func NewFileWatcher(configFiles []string, logger zerolog.Logger) (Watcher, error) {
+func NewFileWatcher(configFiles []string, logger zerolog.Logger, opts ...FileWatcherOption) (Watcher, error) {
 	ws, err := fsnotify.NewWatcher()
 	if err != nil {
 		return nil, err
@@ -64,6 +123,9 @@ func NewFileWatcher(configFiles []string, logger zerolog.Logger) (Watcher, error
 		reconcileTimeout: timeoutDuration,
 		done:             make(chan interface{}),
 	}
+	for _, opt := range opts {
+		opt(w)
+	}
 	for _, f := range configFiles {
 		abs, err := filepath.Abs(f)
 		if err != nil {
@@ -113,7 +175,7 @@ func (w *fileWatcher) Add(filename string) error {
 	if err != nil {
 		return err
 	}
-	w.addFile(filename, modTime)
+	w.addFile(filename, modTime, w.hashContents(filename, nil, false))
 	return nil
 }
 
@@ -138,21 +200,21 @@ func (w *fileWatcher) Replace(oldFile, newFile string) error {
 	if err != nil {
 		return err
 	}
-	w.replaceFile(oldFile, newFile, modTime)
+	w.replaceFile(oldFile, newFile, modTime, w.hashContents(newFile, nil, false))
 	return nil
 }
 
-func (w *fileWatcher) replaceFile(oldFile, newFile string, modTime time.Time) {
+func (w *fileWatcher) replaceFile(oldFile, newFile string, modTime time.Time, contents map[string]*fileContent) {
 	w.configFilesLock.Lock()
 	defer w.configFilesLock.Unlock()
 	delete(w.configFiles, oldFile)
-	w.configFiles[newFile] = &watchedFile{modTime: modTime}
+	w.configFiles[newFile] = &watchedFile{modTime: modTime, contents: contents}
 }
 
-func (w *fileWatcher) addFile(filename string, modTime time.Time) {
+func (w *fileWatcher) addFile(filename string, modTime time.Time, contents map[string]*fileContent) {
 	w.configFilesLock.Lock()
 	defer w.configFilesLock.Unlock()
-	w.configFiles[filename] = &watchedFile{modTime: modTime}
+	w.configFiles[filename] = &watchedFile{modTime: modTime, contents: contents}
 }
 
 func (w *fileWatcher) removeFile(filename string) {
@@ -222,6 +284,14 @@ func (w *fileWatcher) handleEvent(ctx context.Context, event fsnotify.Event) err
 		}
 	}
 
+	if (isCreateEvent(event) || isWriteEvent(event) || isRenameEvent(event)) && w.changeDetection != DetectModTime {
+		// a write event may be seen while the file is only partially written,
+		// e.g. right after it was truncated, so the content is hashed by the
+		// reconcile loop instead.
+		w.logger.Trace().Str("filename", event.Name).Interface("OP", event.Op).Msg("defer to the reconcile")
+		return nil
+	}
+
 	if isCreateEvent(event) || isWriteEvent(event) || isRenameEvent(event) {
 		w.logger.Trace().Str("filename", event.Name).Interface("OP", event.Op).Msg("call the handler")
 		select {
@@ -272,6 +342,24 @@ func (w *fileWatcher) reconcile(ctx context.Context) {
 			w.logger.Error().Str("file", filename).Err(err).Msg("failed to add file to watcher")
 			continue
 		}
+		if w.changeDetection != DetectModTime {
+			contents := w.hashContents(filename, configFile.contents, w.changeDetection == DetectContentPrecheck)
+			hashes := diffContents(configFile.contents, contents)
+			configFile.contents = contents
+			configFile.modTime = newModTime
+			if len(hashes) == 0 {
+				continue
+			}
+
+			w.logger.Trace().Str("filename", filename).Interface("hashes", hashes).Msg("call the handler")
+			select {
+			case w.eventsCh <- &FileWatcherEvent{Filenames: []string{filename}, Hashes: hashes}:
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
 		if !configFile.modTime.Equal(newModTime) {
 			w.logger.Trace().Str("filename", filename).Time("old modTime", configFile.modTime).Time("new modTime", newModTime).Msg("call the handler")
 			configFile.modTime = newModTime
@@ -284,6 +372,101 @@ func (w *fileWatcher) reconcile(ctx context.Context) {
 	}
 }
 
+// hashContents hashes filename, or the regular files directly inside it when
+// it is a directory, when changes are detected by content. With precheck,
+// files whose size and modification time are the same as in previous are not
+// hashed again. Files that cannot be hashed are left out.
+func (w *fileWatcher) hashContents(filename string, previous map[string]*fileContent, precheck bool) map[string]*fileContent {
+	if w.changeDetection == DetectModTime {
+		return nil
+	}
+
+	var paths []string
+	info, err := os.Stat(filename)
+	switch {
+	case err != nil:
+	case info.IsDir():
+		entries, err := os.ReadDir(filename)
+		if err != nil {
+			w.logger.Error().Err(err).Str("file", filename).Msg("failed to list directory")
+			return previous
+		}
+		for _, entry := range entries {
+			paths = append(paths, filepath.Join(filename, entry.Name()))
+		}
+	default:
+		paths = []string{filename}
+	}
+
+	contents := map[string]*fileContent{}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil || !info.Mode().IsRegular() {
+			continue
+		}
+
+		if p, ok := previous[path]; ok && precheck && p.size == info.Size() && p.modTime.Equal(info.ModTime()) {
+			contents[path] = p
+			continue
+		}
+
+		c, err := hashFile(path)
+		if err != nil {
+			w.logger.Error().Err(err).Str("file", path).Msg("failed to hash file")
+			continue
+		}
+		contents[path] = c
+	}
+
+	return contents
+}
+
+// diffContents returns the hashes of the files whose content differs between
+// previous and current. Removed files have an empty New hash.
+func diffContents(previous, current map[string]*fileContent) map[string]FileHashes {
+	hashes := map[string]FileHashes{}
+	for path, c := range current {
+		if p, ok := previous[path]; !ok || p.hash != c.hash {
+			var old string
+			if ok {
+				old = p.hash
+			}
+			hashes[path] = FileHashes{Old: old, New: c.hash}
+		}
+	}
+	for path, p := range previous {
+		if _, ok := current[path]; !ok {
+			hashes[path] = FileHashes{Old: p.hash}
+		}
+	}
+
+	return hashes
+}
+
+func hashFile(filename string) (*fileContent, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+
+	return &fileContent{
+		modTime: info.ModTime(),
+		size:    info.Size(),
+		hash:    hex.EncodeToString(h.Sum(nil)),
+	}, nil
+}
+
 func isCreateEvent(event fsnotify.Event) bool {
 	return event.Op&fsnotify.Create == fsnotify.Create
 }
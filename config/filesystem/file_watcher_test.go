@@ -2,6 +2,8 @@ package filesystem
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"os"
 	"strings"
@@ -396,3 +398,87 @@ func createTempConfigFile(t *testing.T, filename string) string {
 
 	return file.Name()
 }
+
+func TestEventWatcherContentTouch(t *testing.T) {
+	filepath := createTempConfigFile(t, "temp_config1")
+	w, err := NewFileWatcher([]string{filepath}, zerolog.Logger{}, WithChangeDetection(DetectContent))
+	require.NoError(t, err)
+	w.Start(context.Background())
+	defer func() {
+		_ = w.Stop()
+	}()
+
+	// touching the file or writing the same content again is not a change.
+	require.NoError(t, os.Chtimes(filepath, time.Now(), time.Now().Add(time.Second)))
+	require.NoError(t, os.WriteFile(filepath, []byte("test config"), 0o600))
+	require.Error(t, assertEvent(filepath, w.EventsCh(), defaultTimeout), "timedout waiting for event")
+
+	// an identical re-render replacing the file is not a change either.
+	rendered := createTempConfigFile(t, "temp_config2")
+	require.NoError(t, os.Rename(rendered, filepath))
+	require.Error(t, assertEvent(filepath, w.EventsCh(), defaultTimeout), "timedout waiting for event")
+
+	require.NoError(t, os.WriteFile(filepath, []byte("test config 2"), 0o600))
+	select {
+	case ev := <-w.EventsCh():
+		require.Equal(t, []string{filepath}, ev.Filenames)
+		require.Equal(t, FileHashes{Old: sha256Hex("test config"), New: sha256Hex("test config 2")}, ev.Hashes[filepath])
+	case <-time.After(defaultTimeout):
+		t.Fatal("timedout waiting for event")
+	}
+}
+
+func TestEventReconcileContentSameModTime(t *testing.T) {
+	filepath := createTempConfigFile(t, "temp_config1")
+	modTime := time.Now().Add(-time.Minute).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(filepath, modTime, modTime))
+
+	wi, err := NewFileWatcher([]string{filepath}, zerolog.Logger{}, WithChangeDetection(DetectContent))
+	require.NoError(t, err)
+	w := wi.(*fileWatcher)
+	w.Start(context.Background())
+	defer func() {
+		_ = w.Stop()
+	}()
+
+	// remove the file from the internal watcher to only trigger the reconcile
+	require.NoError(t, w.watcher.Remove(filepath))
+
+	// a rewrite to the same size within the same modification time is only
+	// caught by hashing the content.
+	require.NoError(t, os.WriteFile(filepath, []byte("test CONFIG"), 0o600))
+	require.NoError(t, os.Chtimes(filepath, modTime, modTime))
+
+	select {
+	case ev := <-w.EventsCh():
+		require.Equal(t, FileHashes{Old: sha256Hex("test config"), New: sha256Hex("test CONFIG")}, ev.Hashes[filepath])
+	case <-time.After(2000 * time.Millisecond):
+		t.Fatal("timedout waiting for event")
+	}
+}
+
+func TestEventReconcileContentPrecheck(t *testing.T) {
+	tempDir := TempDir(t, "temp_dir")
+	filepath := tempDir + "/config.toml"
+	require.NoError(t, os.WriteFile(filepath, []byte("test config"), 0o600))
+
+	wi, err := NewFileWatcher([]string{tempDir}, zerolog.Logger{}, WithChangeDetection(DetectContentPrecheck))
+	require.NoError(t, err)
+	w := wi.(*fileWatcher)
+
+	contents := w.configFiles[tempDir].contents
+	require.Equal(t, sha256Hex("test config"), contents[filepath].hash)
+
+	// the precheck trusts an unchanged size and modification time.
+	stale := &fileContent{modTime: contents[filepath].modTime, size: contents[filepath].size, hash: "stale"}
+	got := w.hashContents(tempDir, map[string]*fileContent{filepath: stale}, true)
+	require.Same(t, stale, got[filepath])
+
+	require.NoError(t, os.Remove(filepath))
+	require.Equal(t, map[string]FileHashes{filepath: {Old: sha256Hex("test config")}}, diffContents(contents, w.hashContents(tempDir, contents, true)))
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
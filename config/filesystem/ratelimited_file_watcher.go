@@ -38,9 +38,9 @@ func (r rateLimitedFileWatcher) EventsCh() chan *FileWatcherEvent {
 	return r.eventCh
 }
 
-func NewRateLimitedFileWatcher(configFiles []string, logger zerolog.Logger, coalesceInterval time.Duration) (Watcher, error) {
+func NewRateLimitedFileWatcher(configFiles []string, logger zerolog.Logger, coalesceInterval time.Duration, opts ...FileWatcherOption) (Watcher, error) {
 
-	watcher, err := NewFileWatcher(configFiles, logger)
+	watcher, err := NewFileWatcher(configFiles, logger, opts...)
 	if err != nil {
 		return nil, err
 	}
@@ -56,6 +56,7 @@ func (r rateLimitedFileWatcher) coalesceTimer(ctx context.Context, inputCh chan
 		coalesceTimer     *time.Timer
 		sendCh            = make(chan struct{})
 		fileWatcherEvents []string
+		hashes            map[string]FileHashes
 	)
 
 	go func() {
@@ -64,12 +65,13 @@ func (r rateLimitedFileWatcher) coalesceTimer(ctx context.Context, inputCh chan
 			case event, ok := <-inputCh:
 				if !ok {
 					if len(fileWatcherEvents) > 0 {
-						r.eventCh <- &FileWatcherEvent{Filenames: fileWatcherEvents}
+						r.eventCh <- &FileWatcherEvent{Filenames: fileWatcherEvents, Hashes: hashes}
 					}
 					close(r.eventCh)
 					return
 				}
 				fileWatcherEvents = append(fileWatcherEvents, event.Filenames...)
+				hashes = coalesceHashes(hashes, event.Hashes)
 				if coalesceTimer == nil {
 					coalesceTimer = time.AfterFunc(coalesceDuration, func() {
 						// This runs in another goroutine so we can't just do the send
@@ -80,11 +82,32 @@ func (r rateLimitedFileWatcher) coalesceTimer(ctx context.Context, inputCh chan
 				}
 			case <-sendCh:
 				coalesceTimer = nil
-				r.eventCh <- &FileWatcherEvent{Filenames: fileWatcherEvents}
+				r.eventCh <- &FileWatcherEvent{Filenames: fileWatcherEvents, Hashes: hashes}
 				fileWatcherEvents = make([]string, 0)
+				hashes = nil
 			case <-ctx.Done():
 				return
 			}
 		}
 	}()
 }
+
+// coalesceHashes merges the hashes of a later event into hashes, keeping the
+// first Old and the last New hash of every file.
+func coalesceHashes(hashes, later map[string]FileHashes) map[string]FileHashes {
+	if len(later) == 0 {
+		return hashes
+	}
+	if hashes == nil {
+		hashes = map[string]FileHashes{}
+	}
+
+	for path, h := range later {
+		if earlier, ok := hashes[path]; ok {
+			h.Old = earlier.Old
+		}
+		hashes[path] = h
+	}
+
+	return hashes
+}
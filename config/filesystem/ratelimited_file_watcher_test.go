@@ -85,3 +85,19 @@ func TestEventRateLimitedWatcherMove(t *testing.T) {
 	require.NoError(t, assertEvent(filepath, w.EventsCh(), defaultTimeout))
 	require.Error(t, assertEvent(filepath, w.EventsCh(), defaultTimeout), "expected timeout error")
 }
+
+func TestCoalesceHashes(t *testing.T) {
+	hashes := coalesceHashes(nil, map[string]FileHashes{
+		"a": {Old: "a0", New: "a1"},
+	})
+	hashes = coalesceHashes(hashes, nil)
+	hashes = coalesceHashes(hashes, map[string]FileHashes{
+		"a": {Old: "a1", New: "a2"},
+		"b": {Old: "b0", New: "b1"},
+	})
+
+	require.Equal(t, map[string]FileHashes{
+		"a": {Old: "a0", New: "a2"},
+		"b": {Old: "b0", New: "b1"},
+	}, hashes)
+}
@@ -0,0 +1,488 @@
+package config
+
+import (
+	"encoding"
+	"errors"
+	"flag"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+var (
+	durationType       = reflect.TypeOf(time.Duration(0))
+	flagValueType      = reflect.TypeOf((*flag.Value)(nil)).Elem()
+	envNameReplacer    = strings.NewReplacer(".", "_", "-", "_")
+	flagNameReplacer   = strings.NewReplacer("_", "-")
+	errUnsupportedType = fmt.Errorf("unsupported type")
+)
+
+// RegisterStructFlags registers a flag for every exported field of cfg, which
+// must be a pointer to a struct, using struct tags instead of hand-written
+// f.StringVar calls. It is meant to be called from a RegisterFlags method:
+//
+//	type ConsulConfig struct {
+//		Address string `toml:"address" flag:"addr" env:"CONSUL_HTTP_ADDR" default:"localhost:8500" usage:"hostname:port of the consul server"`
+//	}
+//
+//	func (c *ConsulConfig) RegisterFlags(f *flag.FlagSet) {
+//		config.RegisterStructFlags(f, "consul", c)
+//	}
+//
+// The following tags are read:
+//
+//   - flag: the flag name relative to prefix. Defaults to the toml key with
+//     underscores replaced by dashes. `flag:"-"` skips the field.
+//   - env: comma separated environment variables to read the default from,
+//     the first one that is set wins. Defaults to the full flag name upper
+//     cased with dots and dashes replaced by underscores, e.g. CONSUL_ADDR for
+//     -consul.addr. `env:"-"` disables the lookup.
+//   - default: the default used when no environment variable is set.
+//   - usage: the flag usage string.
+//   - enum: comma separated allowed values of a field implementing
+//     SetAllowed(...string), e.g. Enum.
+//
+// Nested structs register their fields under '<prefix>.<name>'. Strings,
+// bools, integers, floats, time.Duration, slices and maps of those (given as
+// comma separated values and key=value pairs) are supported, as are fields
+// implementing flag.Value or encoding.TextUnmarshaler.
+//
+// An environment variable that cannot be parsed is ignored in favor of the
+// default, like the env.GetEnv*Default helpers do, and so is one whose
+// env.FileSuffix companion cannot be used, which is reported by env.Err
+// instead. Invalid tags, unsupported types and unparsable defaults are
+// programming errors and cause a panic, like registering a flag twice does.
+func RegisterStructFlags(f *flag.FlagSet, prefix string, cfg any) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		panic(fmt.Sprintf("RegisterStructFlags: expected a non-nil pointer to a struct, got %T", cfg))
+	}
+
+	registerStruct(f, prefix, v.Elem())
+}
+
+func registerStruct(f *flag.FlagSet, prefix string, v reflect.Value) {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		flagTag, hasFlagTag := sf.Tag.Lookup("flag")
+		tomlKey, tagged := tomlName(sf)
+		if flagTag == "-" || tomlKey == "-" {
+			continue
+		}
+
+		fv := v.Field(i)
+		if sf.Anonymous && !tagged && !hasFlagTag && isStruct(sf.Type) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			registerStruct(f, prefix, fv)
+			continue
+		}
+
+		name := flagTag
+		if name == "" {
+			name = flagNameReplacer.Replace(tomlKey)
+		}
+		if prefix != "" {
+			name = prefix + "." + name
+		}
+
+		if isStruct(sf.Type) && !reflect.PointerTo(sf.Type).Implements(flagValueType) {
+			if fv.Kind() == reflect.Ptr {
+				if fv.IsNil() {
+					fv.Set(reflect.New(sf.Type.Elem()))
+				}
+				fv = fv.Elem()
+			}
+			registerStruct(f, name, fv)
+			continue
+		}
+
+		registerField(f, name, sf, fv)
+	}
+}
+
+func registerField(f *flag.FlagSet, name string, sf reflect.StructField, fv reflect.Value) {
+	value, err := newFlagValue(fv)
+	if err != nil {
+		panic(fmt.Sprintf("RegisterStructFlags: field %s (%s): %s", sf.Name, sf.Type, err))
+	}
+
+	if r, ok := value.(restricter); ok {
+		if tag := sf.Tag.Get("enum"); tag != "" {
+			var allowed []string
+			for _, a := range strings.Split(tag, ",") {
+				allowed = append(allowed, strings.TrimSpace(a))
+			}
+			r.SetAllowed(allowed...)
+		}
+	}
+
+	def := sf.Tag.Get("default")
+	var keys []string
+	if !env.Isolated(f) {
+		keys = envKeys(name, sf.Tag.Get("env"))
+	}
+	for _, key := range keys {
+		env.Describe(key, name, def, sf.Tag.Get("usage"))
+	}
+
+	setDefault(value, fv, def, func(err error) {
+		panic(fmt.Sprintf("RegisterStructFlags: invalid default for -%s: %s", name, err))
+	})
+	for _, key := range keys {
+		v, err := env.Get[string](key)
+		if errors.Is(err, env.ErrNotSet) {
+			continue
+		}
+		// a FileSuffix companion that cannot be used is recorded for env.Err,
+		// and the default is kept.
+		if err != nil {
+			break
+		}
+
+		// an invalid value keeps the default, like env.GetEnvBoolDefault.
+		setDefault(value, fv, v, func(error) {
+			if r, ok := value.(interface{ reset() }); ok {
+				r.reset()
+			}
+			setDefault(value, fv, def, nil)
+		})
+		break
+	}
+
+	f.Var(value, name, sf.Tag.Get("usage"))
+}
+
+// restricter is implemented by flag values accepting a fixed set of values,
+// e.g. Enum. The enum tag sets the allowed values.
+type restricter interface {
+	SetAllowed(allowed ...string)
+}
+
+// flagAddr returns the address of the field v writes to when it was
+// registered by RegisterStructFlags, so flags can be mapped back to the
+// fields they set.
+func flagAddr(v flag.Value) (uintptr, bool) {
+	a, ok := v.(interface{ addr() uintptr })
+	if !ok {
+		return 0, false
+	}
+
+	return a.addr(), true
+}
+
+// setDefault sets value, writing to fv, to def. onError, when not nil, is
+// called when def cannot be parsed.
+func setDefault(value flag.Value, fv reflect.Value, def string, onError func(error)) {
+	if def == "" {
+		// mirror f.StringVar and friends, which always overwrite the field
+		// with the default.
+		if _, ok := value.(interface{ addr() uintptr }); ok {
+			fv.Set(reflect.Zero(fv.Type()))
+		}
+		return
+	}
+
+	if err := value.Set(def); err != nil {
+		if onError != nil {
+			onError(err)
+		}
+		return
+	}
+	// the default should be replaced, not extended, by the first value
+	// given on the command line.
+	if r, ok := value.(interface{ reset() }); ok {
+		r.reset()
+	}
+}
+
+// envKeys returns the environment variables to read the default of the flag
+// name from, according to the env tag.
+func envKeys(name, tag string) []string {
+	switch tag {
+	case "-":
+		return nil
+	case "":
+		return []string{strings.ToUpper(envNameReplacer.Replace(name))}
+	}
+
+	var keys []string
+	for _, key := range strings.Split(tag, ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// newFlagValue returns a flag.Value writing to fv.
+func newFlagValue(fv reflect.Value) (flag.Value, error) {
+	if fv.CanAddr() {
+		ptr := fv.Addr()
+		if ptr.Type().Implements(flagValueType) {
+			return ptr.Interface().(flag.Value), nil
+		}
+		if ptr.Type().Implements(textUnmarshalerType) {
+			return textValue{ptr}, nil
+		}
+	}
+
+	switch fv.Kind() {
+	case reflect.Slice:
+		if _, err := parseScalar(fv.Type().Elem(), ""); err == errUnsupportedType {
+			return nil, err
+		}
+		return &sliceValue{v: fv}, nil
+	case reflect.Map:
+		if fv.Type().Key().Kind() != reflect.String {
+			return nil, errUnsupportedType
+		}
+		if _, err := parseScalar(fv.Type().Elem(), ""); err == errUnsupportedType {
+			return nil, err
+		}
+		return &mapValue{v: fv}, nil
+	default:
+		if _, err := parseScalar(fv.Type(), ""); err == errUnsupportedType {
+			return nil, err
+		}
+		return scalarValue{fv}, nil
+	}
+}
+
+// parseScalar parses s into a new value of type t.
+func parseScalar(t reflect.Type, s string) (reflect.Value, error) {
+	out := reflect.New(t).Elem()
+	if t == durationType {
+		if s == "" {
+			return out, nil
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return out, err
+		}
+		out.SetInt(int64(d))
+		return out, nil
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		out.SetString(s)
+		return out, nil
+	case reflect.Bool:
+		if s == "" {
+			return out, nil
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return out, err
+		}
+		out.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if s == "" {
+			return out, nil
+		}
+		i, err := strconv.ParseInt(s, 0, t.Bits())
+		if err != nil {
+			return out, err
+		}
+		out.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if s == "" {
+			return out, nil
+		}
+		u, err := strconv.ParseUint(s, 0, t.Bits())
+		if err != nil {
+			return out, err
+		}
+		out.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		if s == "" {
+			return out, nil
+		}
+		fl, err := strconv.ParseFloat(s, t.Bits())
+		if err != nil {
+			return out, err
+		}
+		out.SetFloat(fl)
+	default:
+		return out, errUnsupportedType
+	}
+
+	return out, nil
+}
+
+func formatScalar(v reflect.Value) string {
+	if v.Type() == durationType {
+		return time.Duration(v.Int()).String()
+	}
+
+	return fmt.Sprint(v.Interface())
+}
+
+type scalarValue struct {
+	v reflect.Value
+}
+
+func (s scalarValue) String() string {
+	if !s.v.IsValid() {
+		return ""
+	}
+	return formatScalar(s.v)
+}
+
+func (s scalarValue) Set(value string) error {
+	parsed, err := parseScalar(s.v.Type(), value)
+	if err != nil {
+		return err
+	}
+	s.v.Set(parsed)
+	return nil
+}
+
+func (s scalarValue) addr() uintptr {
+	return s.v.UnsafeAddr()
+}
+
+func (s scalarValue) IsBoolFlag() bool {
+	return s.v.IsValid() && s.v.Kind() == reflect.Bool
+}
+
+// sliceValue parses comma separated values. The flag may be repeated to
+// append more values.
+type sliceValue struct {
+	v   reflect.Value
+	set bool
+}
+
+func (s *sliceValue) String() string {
+	if s.v == (reflect.Value{}) {
+		return ""
+	}
+
+	parts := make([]string, s.v.Len())
+	for i := range parts {
+		parts[i] = formatScalar(s.v.Index(i))
+	}
+	return strings.Join(parts, ",")
+}
+
+func (s *sliceValue) Set(value string) error {
+	if !s.set {
+		s.v.Set(reflect.MakeSlice(s.v.Type(), 0, 0))
+		s.set = true
+	}
+
+	for _, part := range strings.Split(value, ",") {
+		parsed, err := parseScalar(s.v.Type().Elem(), strings.TrimSpace(part))
+		if err != nil {
+			return err
+		}
+		s.v.Set(reflect.Append(s.v, parsed))
+	}
+
+	return nil
+}
+
+func (s *sliceValue) addr() uintptr {
+	return s.v.UnsafeAddr()
+}
+
+func (s *sliceValue) reset() {
+	s.set = false
+}
+
+// mapValue parses comma separated key=value pairs. The flag may be repeated
+// to add more pairs.
+type mapValue struct {
+	v   reflect.Value
+	set bool
+}
+
+func (m *mapValue) String() string {
+	if m.v == (reflect.Value{}) {
+		return ""
+	}
+
+	parts := make([]string, 0, m.v.Len())
+	iter := m.v.MapRange()
+	for iter.Next() {
+		parts = append(parts, iter.Key().String()+"="+formatScalar(iter.Value()))
+	}
+	sort.Strings(parts)
+	return strings.Join(parts, ",")
+}
+
+func (m *mapValue) Set(value string) error {
+	if !m.set {
+		m.v.Set(reflect.MakeMap(m.v.Type()))
+		m.set = true
+	}
+
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+
+		parsed, err := parseScalar(m.v.Type().Elem(), strings.TrimSpace(v))
+		if err != nil {
+			return err
+		}
+		m.v.SetMapIndex(reflect.ValueOf(strings.TrimSpace(k)).Convert(m.v.Type().Key()), parsed)
+	}
+
+	return nil
+}
+
+func (m *mapValue) addr() uintptr {
+	return m.v.UnsafeAddr()
+}
+
+func (m *mapValue) reset() {
+	m.set = false
+}
+
+// textValue adapts an encoding.TextUnmarshaler to flag.Value.
+type textValue struct {
+	ptr reflect.Value
+}
+
+func (t textValue) String() string {
+	if !t.ptr.IsValid() {
+		return ""
+	}
+	if m, ok := t.ptr.Interface().(encoding.TextMarshaler); ok {
+		b, err := m.MarshalText()
+		if err == nil {
+			return string(b)
+		}
+	}
+	return fmt.Sprint(t.ptr.Elem().Interface())
+}
+
+func (t textValue) addr() uintptr {
+	return t.ptr.Pointer()
+}
+
+func (t textValue) Set(value string) error {
+	return t.ptr.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(value))
+}
@@ -0,0 +1,209 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"net/netip"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type taggedTLS struct {
+	CertPath string `toml:"cert_path" usage:"path to the certificate"`
+	KeyPath  string `toml:"key_path" flag:"key" env:"-"`
+}
+
+type taggedConfig struct {
+	Address  string            `toml:"address" flag:"addr" env:"TEST_TAGGED_HTTP_ADDR" default:"localhost:8500" usage:"address to listen on"`
+	Token    string            `toml:"token" env:"TEST_TAGGED_TOKEN,TEST_TAGGED_FALLBACK_TOKEN"`
+	SSL      bool              `toml:"use_ssl" flag:"ssl"`
+	Retries  int               `toml:"retries" default:"3"`
+	Ratio    float64           `toml:"ratio" default:"0.5"`
+	Timeout  time.Duration     `toml:"timeout" default:"5s"`
+	Hosts    []string          `toml:"hosts" default:"a,b"`
+	Ports    []int             `toml:"ports"`
+	Labels   map[string]string `toml:"labels" default:"env=dev"`
+	Prefix   netip.Prefix      `toml:"prefix" default:"10.0.0.0/8"`
+	TLS      taggedTLS         `toml:"tls"`
+	Ignored  string            `toml:"ignored" flag:"-"`
+	Internal string            `toml:"-"`
+
+	unexported string
+}
+
+func TestRegisterStructFlagsNames(t *testing.T) {
+	var cfg taggedConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterStructFlags(fs, "test", &cfg)
+
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, f.Name)
+	})
+
+	want := []string{
+		"test.addr",
+		"test.hosts",
+		"test.labels",
+		"test.ports",
+		"test.prefix",
+		"test.ratio",
+		"test.retries",
+		"test.ssl",
+		"test.timeout",
+		"test.tls.cert-path",
+		"test.tls.key",
+		"test.token",
+	}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("registered flags = %v, want %v", names, want)
+	}
+
+	if usage := fs.Lookup("test.addr").Usage; usage != "address to listen on" {
+		t.Errorf("usage = %q", usage)
+	}
+}
+
+func TestRegisterStructFlagsDefaults(t *testing.T) {
+	t.Setenv("TEST_TAGGED_HTTP_ADDR", "consul:8500")
+	t.Setenv("TEST_TAGGED_FALLBACK_TOKEN", "fallback")
+	t.Setenv("TEST_TLS_CERT_PATH", "/certs/cert.pem")
+	t.Setenv("TEST_TLS_KEY", "/certs/ignored.pem")
+
+	var cfg taggedConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterStructFlags(fs, "test", &cfg)
+
+	if cfg.Address != "consul:8500" {
+		t.Errorf("Address = %q, want value from TEST_TAGGED_HTTP_ADDR", cfg.Address)
+	}
+	if cfg.Token != "fallback" {
+		t.Errorf("Token = %q, want value from the fallback variable", cfg.Token)
+	}
+	if cfg.TLS.CertPath != "/certs/cert.pem" {
+		t.Errorf("TLS.CertPath = %q, want value from the derived TEST_TLS_CERT_PATH", cfg.TLS.CertPath)
+	}
+	if cfg.TLS.KeyPath != "" {
+		t.Errorf("TLS.KeyPath = %q, env lookups should be disabled", cfg.TLS.KeyPath)
+	}
+	if cfg.Retries != 3 || cfg.Ratio != 0.5 || cfg.Timeout != 5*time.Second {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Hosts, []string{"a", "b"}) {
+		t.Errorf("Hosts = %v", cfg.Hosts)
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"env": "dev"}) {
+		t.Errorf("Labels = %v", cfg.Labels)
+	}
+	if cfg.Prefix.String() != "10.0.0.0/8" {
+		t.Errorf("Prefix = %v", cfg.Prefix)
+	}
+}
+
+func TestRegisterStructFlagsInvalidEnv(t *testing.T) {
+	t.Setenv("TEST_SSL", "maybe")
+	t.Setenv("TEST_RETRIES", "many")
+	t.Setenv("TEST_HOSTS", "c")
+	t.Setenv("TEST_PORTS", "80,http")
+
+	var cfg taggedConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	RegisterStructFlags(fs, "test", &cfg)
+
+	if cfg.SSL || cfg.Retries != 3 {
+		t.Errorf("SSL = %v, Retries = %d, want the defaults for invalid values", cfg.SSL, cfg.Retries)
+	}
+	if !reflect.DeepEqual(cfg.Hosts, []string{"c"}) {
+		t.Errorf("Hosts = %v, want the value from TEST_HOSTS", cfg.Hosts)
+	}
+	if len(cfg.Ports) != 0 {
+		t.Errorf("Ports = %v, want no value left over from the invalid one", cfg.Ports)
+	}
+}
+
+func TestRegisterStructFlagsUnusableFileEnv(t *testing.T) {
+	t.Setenv("TEST_TAGGED_HTTP_ADDR", "inline:8500")
+	setenvFile(t, "TEST_TAGGED_HTTP_ADDR", "/run/secrets/addr")
+	setenvFile(t, "TEST_TAGGED_TOKEN", filepath.Join(t.TempDir(), "missing"))
+	t.Setenv("TEST_TAGGED_FALLBACK_TOKEN", "fallback")
+
+	var cfg taggedConfig
+	RegisterStructFlags(flag.NewFlagSet("test", flag.ContinueOnError), "test", &cfg)
+
+	if cfg.Address != "localhost:8500" || cfg.Token != "" {
+		t.Errorf("Address = %q, Token = %q, want the defaults", cfg.Address, cfg.Token)
+	}
+	err := env.Err()
+	for _, want := range []string{"both TEST_TAGGED_HTTP_ADDR and TEST_TAGGED_HTTP_ADDR_FILE are set", "failed to read TEST_TAGGED_TOKEN_FILE"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("env.Err() = %v, want %q", err, want)
+		}
+	}
+}
+
+func TestRegisterStructFlagsParse(t *testing.T) {
+	var cfg taggedConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	RegisterStructFlags(fs, "test", &cfg)
+
+	err := fs.Parse([]string{
+		"-test.ssl",
+		"-test.retries", "5",
+		"-test.timeout", "1m",
+		"-test.hosts", "c",
+		"-test.hosts", "d,e",
+		"-test.ports", "80,443",
+		"-test.labels", "team=infra",
+		"-test.prefix", "192.168.0.0/16",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if !cfg.SSL || cfg.Retries != 5 || cfg.Timeout != time.Minute {
+		t.Errorf("unexpected values: %+v", cfg)
+	}
+	if !reflect.DeepEqual(cfg.Hosts, []string{"c", "d", "e"}) {
+		t.Errorf("Hosts = %v, want the defaults replaced", cfg.Hosts)
+	}
+	if !reflect.DeepEqual(cfg.Ports, []int{80, 443}) {
+		t.Errorf("Ports = %v", cfg.Ports)
+	}
+	if !reflect.DeepEqual(cfg.Labels, map[string]string{"team": "infra"}) {
+		t.Errorf("Labels = %v", cfg.Labels)
+	}
+	if cfg.Prefix.String() != "192.168.0.0/16" {
+		t.Errorf("Prefix = %v", cfg.Prefix)
+	}
+
+	if err := fs.Parse([]string{"-test.retries", "many"}); err == nil {
+		t.Error("expected an error for an invalid integer")
+	}
+}
+
+func TestRegisterStructFlagsPanics(t *testing.T) {
+	tests := map[string]any{
+		"not a pointer":    taggedConfig{},
+		"unsupported type": &struct{ C chan int }{},
+		"invalid default": &struct {
+			N int `default:"abc"`
+		}{},
+	}
+	for name, cfg := range tests {
+		t.Run(name, func(t *testing.T) {
+			defer func() {
+				r := recover()
+				if r == nil || !strings.Contains(r.(string), "RegisterStructFlags") {
+					t.Errorf("expected a RegisterStructFlags panic, got %v", r)
+				}
+			}()
+			RegisterStructFlags(flag.NewFlagSet("test", flag.ContinueOnError), "test", cfg)
+		})
+	}
+}
@@ -0,0 +1,758 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"github.com/pelletier/go-toml/v2/unstable"
+	"gopkg.in/yaml.v3"
+)
+
+const ConfigFormatFlag = "config.format"
+
+// Format is the encoding of a configuration file.
+type Format string
+
+const (
+	FormatTOML Format = "toml"
+	FormatYAML Format = "yaml"
+	FormatJSON Format = "json"
+)
+
+// ParseFormat parses the value of the -config.format flag. An empty string
+// returns an empty Format, meaning the format is detected from the file
+// extension.
+func ParseFormat(s string) (Format, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "":
+		return "", nil
+	case "toml":
+		return FormatTOML, nil
+	case "yaml", "yml":
+		return FormatYAML, nil
+	case "json":
+		return FormatJSON, nil
+	default:
+		return "", fmt.Errorf("unsupported configuration format %q. expected one of toml, yaml or json", s)
+	}
+}
+
+// FormatFromPath detects the format of a configuration file from its
+// extension. Files with an unknown or missing extension are treated as TOML
+// to stay compatible with configuration files that predate format detection.
+func FormatFromPath(path string) Format {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return FormatYAML
+	case ".json":
+		return FormatJSON
+	default:
+		return FormatTOML
+	}
+}
+
+// decode strictly decodes data in the given format into config. YAML and JSON
+// documents are converted to TOML first so that every format shares the
+// `toml` struct tags and go-toml's unknown field checking. Errors are
+// located by their key path in the original document.
+func decode(data []byte, format Format, config any) error {
+	switch format {
+	case FormatTOML, "":
+		return decodeTOML(data, config)
+	case FormatYAML:
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return fmt.Errorf("failed to parse yaml: %w", err)
+		}
+
+		var doc map[string]any
+		if err := root.Decode(&doc); err != nil {
+			return fmt.Errorf("failed to parse yaml: %w", err)
+		}
+
+		return decodeDocument(doc, config, FormatYAML, func(key []string) (int, int, bool) {
+			return yamlPosition(&root, key)
+		})
+	case FormatJSON:
+		doc, err := parseJSON(data)
+		if err != nil {
+			return err
+		}
+
+		return decodeDocument(doc, config, FormatJSON, func(key []string) (int, int, bool) {
+			return jsonPosition(data, key)
+		})
+	default:
+		return fmt.Errorf("unsupported configuration format %q", format)
+	}
+}
+
+// parseDocument parses data into a generic document without decoding it into
+// a configuration struct.
+func parseDocument(data []byte, format Format) (map[string]any, error) {
+	switch format {
+	case FormatTOML, "":
+		var doc map[string]any
+		if err := toml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse toml: %w", err)
+		}
+		return normalizeDocument(doc)
+	case FormatYAML:
+		var doc map[string]any
+		if err := yaml.Unmarshal(data, &doc); err != nil {
+			return nil, fmt.Errorf("failed to parse yaml: %w", err)
+		}
+		return normalizeDocument(doc)
+	case FormatJSON:
+		doc, err := parseJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return normalizeDocument(doc)
+	default:
+		return nil, fmt.Errorf("unsupported configuration format %q", format)
+	}
+}
+
+func parseJSON(data []byte) (map[string]any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var doc map[string]any
+	if err := dec.Decode(&doc); err != nil {
+		offset := len(data)
+		var syntaxErr *json.SyntaxError
+		var typeErr *json.UnmarshalTypeError
+		switch {
+		case errors.As(err, &syntaxErr):
+			// the offset is just past the offending byte.
+			offset = int(syntaxErr.Offset) - 1
+		case errors.As(err, &typeErr):
+			offset = int(typeErr.Offset)
+		}
+		return nil, jsonSyntaxError(data, offset, err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, jsonSyntaxError(data, int(dec.InputOffset()), errors.New("unexpected data after the top-level object"))
+	}
+
+	return doc, nil
+}
+
+// jsonSyntaxError returns err as a ValidationError located at the byte offset
+// of data the decoder stopped at.
+func jsonSyntaxError(data []byte, offset int, err error) error {
+	line, column := offsetPosition(data, offset)
+	return ValidationErrors{{
+		Line:   line,
+		Column: column,
+		Err:    fmt.Errorf("failed to parse json: %w", err),
+	}}
+}
+
+// jsonFrame is an object or array being read by jsonPosition.
+type jsonFrame struct {
+	object bool
+	// expectKey is true when the next token of an object is a key.
+	expectKey bool
+	key       string
+}
+
+// jsonPosition finds the line and column of the object key identified by
+// key in a json document. Like yamlPosition, keys inside arrays are not
+// located.
+func jsonPosition(data []byte, key []string) (int, int, bool) {
+	var stack []jsonFrame
+	// valueDone marks the value of the enclosing object key as read.
+	valueDone := func() {
+		if len(stack) > 0 && stack[len(stack)-1].object {
+			stack[len(stack)-1].expectKey = true
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	for {
+		start := int(dec.InputOffset())
+		tok, err := dec.Token()
+		if err != nil {
+			return 0, 0, false
+		}
+
+		if n := len(stack); n > 0 && stack[n-1].object && stack[n-1].expectKey {
+			if name, ok := tok.(string); ok {
+				stack[n-1].key, stack[n-1].expectKey = name, false
+				if jsonPathMatches(stack, key) {
+					// the offset is the end of the previous token, so skip
+					// the separators in between.
+					for start < len(data) && strings.IndexByte(" \t\r\n,:", data[start]) >= 0 {
+						start++
+					}
+					line, column := offsetPosition(data, start)
+					return line, column, true
+				}
+				continue
+			}
+		}
+
+		switch tok {
+		case json.Delim('{'):
+			stack = append(stack, jsonFrame{object: true, expectKey: true})
+		case json.Delim('['):
+			stack = append(stack, jsonFrame{})
+		case json.Delim('}'), json.Delim(']'):
+			stack = stack[:len(stack)-1]
+			valueDone()
+		default:
+			valueDone()
+		}
+	}
+}
+
+// jsonPathMatches reports whether stack is made of objects only and their
+// current keys equal key.
+func jsonPathMatches(stack []jsonFrame, key []string) bool {
+	if len(stack) != len(key) {
+		return false
+	}
+	for i, f := range stack {
+		if !f.object || !strings.EqualFold(f.key, key[i]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// offsetPosition returns the line and column of the byte offset of data.
+func offsetPosition(data []byte, offset int) (int, int) {
+	if offset > len(data) {
+		offset = len(data)
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	line := bytes.Count(data[:offset], []byte("\n")) + 1
+	column := offset - bytes.LastIndexByte(data[:offset], '\n')
+
+	return line, column
+}
+
+// lineOffset returns the byte offset of the line and column of data, the
+// inverse of offsetPosition.
+func lineOffset(data []byte, line, column int) int {
+	offset := 0
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(data[offset:], '\n')
+		if i < 0 {
+			return len(data)
+		}
+		offset += i + 1
+	}
+
+	if offset += column - 1; offset > len(data) {
+		return len(data)
+	}
+	return offset
+}
+
+// tomlKey is a key of a toml document, or an element of one of its arrays.
+type tomlKey struct {
+	// path is the key path, without array indices.
+	path []string
+	// name is the key path with array indices, e.g. servers[1].name.
+	name string
+	// offset is the byte offset of the last part of the key, or of the
+	// array element.
+	offset int
+}
+
+// tomlKeys lists the keys of a toml document and the elements of its arrays
+// in the order they appear. It returns nil when the document is invalid.
+func tomlKeys(data []byte) []tomlKey {
+	w := tomlWalker{arrays: map[string]int{}}
+	w.p.Reset(data)
+
+	var (
+		prefix []string
+		name   string
+	)
+	for w.p.NextExpression() {
+		expr := w.p.Expression()
+		switch expr.Kind {
+		case unstable.Table, unstable.ArrayTable:
+			var last *unstable.Node
+			prefix, last = keyParts(expr.Key())
+			if expr.Kind == unstable.ArrayTable {
+				w.arrays[strings.ToLower(strings.Join(prefix, "."))]++
+			}
+
+			parts := make([]string, len(prefix))
+			for i, part := range prefix {
+				parts[i] = part
+				if n := w.arrays[strings.ToLower(strings.Join(prefix[:i+1], "."))]; n > 0 {
+					parts[i] = fmt.Sprintf("%s[%d]", part, n-1)
+				}
+			}
+			name = strings.Join(parts, ".")
+			w.keys = append(w.keys, tomlKey{path: prefix, name: name, offset: int(last.Raw.Offset)})
+		case unstable.KeyValue:
+			w.keyValue(expr, prefix, name)
+		}
+	}
+	if w.p.Error() != nil {
+		return nil
+	}
+
+	return w.keys
+}
+
+// tomlWalker collects the keys of a toml document for tomlKeys.
+type tomlWalker struct {
+	p    unstable.Parser
+	keys []tomlKey
+	// arrays counts the elements of arrays of tables, by lower cased path.
+	arrays map[string]int
+}
+
+func (w *tomlWalker) keyValue(node *unstable.Node, prefix []string, prefixName string) {
+	parts, last := keyParts(node.Key())
+	path := append(append([]string{}, prefix...), parts...)
+	name := strings.Join(parts, ".")
+	if prefixName != "" {
+		name = prefixName + "." + name
+	}
+
+	w.keys = append(w.keys, tomlKey{path: path, name: name, offset: int(last.Raw.Offset)})
+	w.value(node.Value(), path, name)
+}
+
+func (w *tomlWalker) value(node *unstable.Node, path []string, name string) {
+	switch node.Kind {
+	case unstable.InlineTable:
+		it := node.Children()
+		for it.Next() {
+			w.keyValue(it.Node(), path, name)
+		}
+	case unstable.Array:
+		it := node.Children()
+		for i := 0; it.Next(); i++ {
+			elem := it.Node()
+			elemName := fmt.Sprintf("%s[%d]", name, i)
+			if offset, ok := w.offset(elem); ok {
+				w.keys = append(w.keys, tomlKey{path: path, name: elemName, offset: offset})
+			}
+			w.value(elem, path, elemName)
+		}
+	}
+}
+
+// offset returns the byte offset of a value node, when the parser records
+// it.
+func (w *tomlWalker) offset(node *unstable.Node) (int, bool) {
+	switch node.Kind {
+	case unstable.String, unstable.InlineTable:
+		return int(node.Raw.Offset), true
+	case unstable.Bool, unstable.Integer, unstable.Float, unstable.LocalDate, unstable.LocalTime, unstable.LocalDateTime, unstable.DateTime:
+		// the data of these values references the document.
+		return int(w.p.Range(node.Data).Offset), true
+	default:
+		return 0, false
+	}
+}
+
+// keyParts returns the parts of a dotted key and its last part.
+func keyParts(it unstable.Iterator) ([]string, *unstable.Node) {
+	var (
+		parts []string
+		last  *unstable.Node
+	)
+	for it.Next() {
+		last = it.Node()
+		parts = append(parts, string(last.Data))
+	}
+
+	return parts, last
+}
+
+// tomlKeyAt returns the name of the last of keys starting at or before
+// offset, which is the key or array element holding the value at offset.
+func tomlKeyAt(keys []tomlKey, offset int) string {
+	name := ""
+	for _, k := range keys {
+		if k.offset > offset {
+			break
+		}
+		name = k.name
+	}
+
+	return name
+}
+
+func decodeTOML(data []byte, config any) error {
+	err := toml.NewDecoder(bytes.NewReader(data)).DisallowUnknownFields().Decode(config)
+	return tomlValidationErrors(err, data, config, FormatTOML, nil)
+}
+
+// tomlValidationErrors converts an error returned by the toml decoder while
+// decoding text into config as ValidationErrors. format is the format of the document
+// text was converted from, or empty when it was merged from several
+// documents, and position, when not nil, locates a key path in that
+// document. Without position, errors in toml documents are located by the
+// decoder since text is the document itself.
+func tomlValidationErrors(err error, text []byte, config any, format Format, position func(key []string) (int, int, bool)) error {
+	if err == nil {
+		return nil
+	}
+
+	var (
+		errs   ValidationErrors
+		keys   []tomlKey
+		parsed bool
+	)
+	add := func(e *toml.DecodeError, msg string) {
+		path := strings.Join(e.Key(), ".")
+		line, column := e.Position()
+		// type errors carry the position of the offending value rather than
+		// its key.
+		if path == "" {
+			if !parsed {
+				keys, parsed = tomlKeys(text), true
+			}
+			path = tomlKeyAt(keys, lineOffset(text, line, column))
+		}
+
+		v := &ValidationError{Path: path, Err: errors.New(formatMessage(msg, format))}
+		switch {
+		case position == nil && format == FormatTOML:
+			v.Line, v.Column = line, column
+		case position != nil && path != "":
+			v.Line, v.Column, _ = position(sourceKey(path))
+		}
+		errs = append(errs, v)
+	}
+
+	var missing *toml.StrictMissingError
+	var decodeErr *toml.DecodeError
+	switch {
+	case errors.As(err, &missing):
+		for i := range missing.Errors {
+			add(&missing.Errors[i], "unknown field")
+		}
+	case errors.As(err, &decodeErr):
+		add(decodeErr, decodeErr.Error())
+	default:
+		// errors storing a table, an array or a number in a field that
+		// cannot hold it are not located by the decoder, so the value is
+		// looked for in the document instead.
+		v := &ValidationError{Err: errors.New(formatMessage(err.Error(), format))}
+		var doc map[string]any
+		if toml.Unmarshal(text, &doc) == nil {
+			if path, ok := mismatchPath(doc, reflect.TypeOf(config), ""); ok {
+				v.Path = path
+				switch {
+				case position != nil:
+					v.Line, v.Column, _ = position(sourceKey(path))
+				case format == FormatTOML:
+					v.Line, v.Column, _ = tomlPosition(text, sourceKey(path))
+				}
+			}
+		}
+		errs = append(errs, v)
+	}
+
+	return errs
+}
+
+// mismatchPath returns the path of the first value of doc, in key order,
+// that cannot be stored in the field of t it decodes into.
+func mismatchPath(doc map[string]any, t reflect.Type, path string) (string, bool) {
+	keys := make([]string, 0, len(doc))
+	for k := range doc {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	for _, k := range keys {
+		_, ft, ok := tomlField(t, k)
+		if !ok {
+			continue
+		}
+
+		name := k
+		if path != "" {
+			name = path + "." + k
+		}
+		if p, ok := valueMismatch(doc[k], ft, name); ok {
+			return p, true
+		}
+	}
+
+	return "", false
+}
+
+// valueMismatch returns the path of v, or of the first of its elements, when
+// it cannot be stored in a value of type t.
+func valueMismatch(v any, t reflect.Type, path string) (string, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() == reflect.Interface {
+		return "", false
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		switch {
+		case isStruct(t):
+			return mismatchPath(v, t, path)
+		case t.Kind() == reflect.Map:
+			for k, e := range v {
+				if p, ok := valueMismatch(e, t.Elem(), path+"."+k); ok {
+					return p, true
+				}
+			}
+			return "", false
+		default:
+			return path, true
+		}
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return path, true
+		}
+		for i, e := range v {
+			if p, ok := valueMismatch(e, t.Elem(), fmt.Sprintf("%s[%d]", path, i)); ok {
+				return p, true
+			}
+		}
+		return "", false
+	case int64:
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+			if reflect.Zero(t).OverflowInt(v) {
+				return path, true
+			}
+		case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+			if v < 0 || reflect.Zero(t).OverflowUint(uint64(v)) {
+				return path, true
+			}
+		}
+	}
+
+	// other values are scalars, which tables and arrays cannot hold unless
+	// they are decoded from text.
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return "", false
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Slice, reflect.Array:
+		return path, true
+	}
+	if isStruct(t) {
+		return path, true
+	}
+
+	return "", false
+}
+
+// tomlField returns the name and type of the field of the struct t the toml
+// key decodes into, matching it case-insensitively like the decoder.
+func tomlField(t reflect.Type, key string) (string, reflect.Type, bool) {
+	sf, ok := tomlStructField(t, key)
+	if !ok {
+		return "", nil, false
+	}
+	name, _ := tomlName(sf)
+
+	return name, sf.Type, true
+}
+
+// tomlStructField is tomlField returning the struct field itself.
+func tomlStructField(t reflect.Type, key string) (reflect.StructField, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return reflect.StructField{}, false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, tagged := tomlName(sf)
+		if sf.Anonymous && !tagged && isStruct(sf.Type) {
+			if field, ok := tomlStructField(sf.Type, key); ok {
+				return field, true
+			}
+			continue
+		}
+		if name != "-" && strings.EqualFold(name, key) {
+			return sf, true
+		}
+	}
+
+	return reflect.StructField{}, false
+}
+
+// formatMessage strips the toml prefix of a decoder message and names the
+// format of the document instead of TOML, or no format at all when the
+// document was merged from several ones.
+func formatMessage(msg string, format Format) string {
+	msg = strings.TrimPrefix(msg, "toml: ")
+	switch format {
+	case FormatTOML:
+		return msg
+	case "":
+		return strings.ReplaceAll(msg, "TOML ", "")
+	default:
+		return strings.ReplaceAll(msg, "TOML ", strings.ToUpper(string(format))+" ")
+	}
+}
+
+// sourceKey returns the key path to locate the value at path with. Array
+// elements are located by the key holding the array.
+func sourceKey(path string) []string {
+	key, _, _ := strings.Cut(path, "[")
+	return strings.Split(key, ".")
+}
+
+// decodeDocument re-encodes a generic document as TOML and decodes it with
+// the same strict decoder used for TOML files. Errors are reported by their
+// key path since the intermediate TOML document is not what the user wrote.
+// format is the format the document was parsed from, or empty when it was
+// merged from several documents, and position, when not nil, locates a key
+// path in the source.
+func decodeDocument(doc map[string]any, config any, format Format, position func(key []string) (line, column int, ok bool)) error {
+	normalized, err := normalizeDocument(doc)
+	if err != nil {
+		var errs ValidationErrors
+		if position != nil && errors.As(err, &errs) {
+			for _, e := range errs {
+				e.Line, e.Column, _ = position(sourceKey(e.Path))
+			}
+		}
+		return err
+	}
+
+	out, err := toml.Marshal(normalized)
+	if err != nil {
+		return fmt.Errorf("failed to convert configuration to toml: %w", err)
+	}
+
+	err = toml.NewDecoder(bytes.NewReader(out)).DisallowUnknownFields().Decode(config)
+	return tomlValidationErrors(err, out, config, format, position)
+}
+
+// normalizeDocument converts values produced by the yaml and json decoders
+// into types the toml encoder understands. null values are dropped so they
+// behave like missing keys, except in arrays where dropping them would shift
+// the elements after them, so they are rejected.
+func normalizeDocument(doc map[string]any) (map[string]any, error) {
+	return normalizeTable(doc, "")
+}
+
+// normalizeTable normalizes the table at path.
+func normalizeTable(doc map[string]any, path string) (map[string]any, error) {
+	out := make(map[string]any, len(doc))
+	for k, v := range doc {
+		if v == nil {
+			continue
+		}
+
+		key := k
+		if path != "" {
+			key = path + "." + k
+		}
+		n, err := normalizeValue(v, key)
+		if err != nil {
+			return nil, err
+		}
+		out[k] = n
+	}
+
+	return out, nil
+}
+
+// normalizeValue normalizes the value at path. Errors are ValidationErrors
+// naming the path.
+func normalizeValue(v any, path string) (any, error) {
+	switch v := v.(type) {
+	case map[string]any:
+		return normalizeTable(v, path)
+	case map[any]any:
+		m := make(map[string]any, len(v))
+		for k, val := range v {
+			m[fmt.Sprint(k)] = val
+		}
+		return normalizeTable(m, path)
+	case []any:
+		out := make([]any, 0, len(v))
+		for i, e := range v {
+			elem := fmt.Sprintf("%s[%d]", path, i)
+			if e == nil {
+				return nil, ValidationErrors{{Path: elem, Err: errors.New("null is not allowed in arrays")}}
+			}
+
+			n, err := normalizeValue(e, elem)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, n)
+		}
+		return out, nil
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i, nil
+		}
+		f, err := v.Float64()
+		if err != nil {
+			return nil, ValidationErrors{{Path: path, Err: fmt.Errorf("invalid number %q", v)}}
+		}
+		return f, nil
+	default:
+		return v, nil
+	}
+}
+
+// yamlPosition finds the line and column of the mapping key identified by
+// key in a parsed yaml document.
+func yamlPosition(root *yaml.Node, key []string) (int, int, bool) {
+	node := root
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+
+	var found *yaml.Node
+	for _, part := range key {
+		if node.Kind != yaml.MappingNode {
+			return 0, 0, false
+		}
+
+		found = nil
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				found = node.Content[i]
+				node = node.Content[i+1]
+				break
+			}
+		}
+		if found == nil {
+			return 0, 0, false
+		}
+	}
+	if found == nil {
+		return 0, 0, false
+	}
+
+	return found.Line, found.Column, true
+}
@@ -0,0 +1,344 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testServer struct {
+	Address string `toml:"address"`
+	Port    int    `toml:"port"`
+}
+
+type testConfig struct {
+	Name    string     `toml:"name"`
+	Debug   bool       `toml:"debug"`
+	Ratio   float64    `toml:"ratio"`
+	Tags    []string   `toml:"tags"`
+	Server  testServer `toml:"server"`
+	Timeout string     `toml:"timeout"`
+}
+
+func writeFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatalf("failed to write %s: %v", path, err)
+	}
+	return path
+}
+
+func TestFormatFromPath(t *testing.T) {
+	tests := map[string]Format{
+		"config.toml":  FormatTOML,
+		"config.yaml":  FormatYAML,
+		"config.YML":   FormatYAML,
+		"config.json":  FormatJSON,
+		"config":       FormatTOML,
+		"config.conf":  FormatTOML,
+		"/a/b/c.d.yml": FormatYAML,
+	}
+	for path, want := range tests {
+		if got := FormatFromPath(path); got != want {
+			t.Errorf("FormatFromPath(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
+
+func TestParseFormat(t *testing.T) {
+	if f, err := ParseFormat("YML"); err != nil || f != FormatYAML {
+		t.Errorf("ParseFormat(YML) = %q, %v", f, err)
+	}
+	if f, err := ParseFormat(""); err != nil || f != "" {
+		t.Errorf("ParseFormat(\"\") = %q, %v", f, err)
+	}
+	if _, err := ParseFormat("ini"); err == nil {
+		t.Error("ParseFormat(ini) should return an error")
+	}
+}
+
+func TestDecodeConfigurationFormats(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.toml": `
+name = "api"
+debug = true
+ratio = 0.5
+tags = ["a", "b"]
+timeout = "5s"
+
+[server]
+address = "0.0.0.0"
+port = 8080
+`,
+		"config.yaml": `
+name: api
+debug: true
+ratio: 0.5
+tags: [a, b]
+timeout: 5s
+server:
+  address: 0.0.0.0
+  port: 8080
+`,
+		"config.json": `{
+  "name": "api",
+  "debug": true,
+  "ratio": 0.5,
+  "tags": ["a", "b"],
+  "timeout": "5s",
+  "server": {"address": "0.0.0.0", "port": 8080}
+}`,
+	}
+
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			var cfg testConfig
+			if err := DecodeConfiguration(writeFile(t, dir, name, content), &cfg); err != nil {
+				t.Fatalf("DecodeConfiguration() error: %v", err)
+			}
+
+			if cfg.Name != "api" || !cfg.Debug || cfg.Ratio != 0.5 || cfg.Timeout != "5s" {
+				t.Errorf("unexpected config: %+v", cfg)
+			}
+			if strings.Join(cfg.Tags, ",") != "a,b" {
+				t.Errorf("Tags = %v, want [a b]", cfg.Tags)
+			}
+			if cfg.Server.Address != "0.0.0.0" || cfg.Server.Port != 8080 {
+				t.Errorf("Server = %+v", cfg.Server)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigurationUnknownFields(t *testing.T) {
+	dir := t.TempDir()
+
+	yamlFile := writeFile(t, dir, "config.yaml", "name: api\nserver:\n  adress: 0.0.0.0\n")
+	err := DecodeConfiguration(yamlFile, &testConfig{})
+	if err == nil {
+		t.Fatal("expected an error for an unknown yaml field")
+	}
+	if !strings.Contains(err.Error(), "server.adress") || !strings.Contains(err.Error(), "line 3, column 3") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	jsonFile := writeFile(t, dir, "config.json", "{\n  \"name\": \"api\",\n  \"server\": {\"adress\": \"0.0.0.0\"}\n}")
+	err = DecodeConfiguration(jsonFile, &testConfig{})
+	if err == nil || !strings.Contains(err.Error(), "server.adress: unknown field") || !strings.Contains(err.Error(), "line 3, column 14") {
+		t.Errorf("expected a located unknown field error for server.adress, got %v", err)
+	}
+
+	tomlFile := writeFile(t, dir, "config.toml", "nme = \"api\"\n")
+	err = DecodeConfiguration(tomlFile, &testConfig{})
+	if err == nil || !strings.Contains(err.Error(), "nme") {
+		t.Errorf("expected an unknown field error for nme, got %v", err)
+	}
+}
+
+func TestDecodeConfigurationTypeErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]struct {
+		content string
+		want    ValidationError
+		message string
+	}{
+		"config.toml": {
+			content: "name = \"api\"\n\n[server]\nport = \"http\"\n",
+			want:    ValidationError{Path: "server.port", Line: 4, Column: 8},
+			message: "cannot store TOML string into a Go int",
+		},
+		"config.yaml": {
+			content: "name: api\nserver:\n  port: http\n",
+			want:    ValidationError{Path: "server.port", Line: 3, Column: 3},
+			message: "cannot store YAML string into a Go int",
+		},
+		"config.json": {
+			content: "{\n  \"name\": \"api\",\n  \"server\": {\"port\": \"http\"}\n}",
+			want:    ValidationError{Path: "server.port", Line: 3, Column: 14},
+			message: "cannot store JSON string into a Go int",
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			err := DecodeConfiguration(writeFile(t, dir, name, tt.content), &testConfig{})
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("expected a single ValidationError, got %v", err)
+			}
+			got := errs[0]
+			if got.Path != tt.want.Path || got.Line != tt.want.Line || got.Column != tt.want.Column {
+				t.Errorf("got path=%q line=%d column=%d, want path=%q line=%d column=%d",
+					got.Path, got.Line, got.Column, tt.want.Path, tt.want.Line, tt.want.Column)
+			}
+			if got.Err.Error() != tt.message {
+				t.Errorf("message = %q, want %q", got.Err, tt.message)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigurationEnumError(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]struct {
+		content string
+		line    int
+	}{
+		"config.toml": {"[log]\nlevel = \"loud\"\n", 2},
+		"config.yaml": {"log:\n  level: loud\n", 2},
+		"config.json": {"{\n  \"log\": {\n    \"level\": \"loud\"\n  }\n}", 3},
+	}
+	for name, f := range files {
+		t.Run(name, func(t *testing.T) {
+			var cfg struct {
+				Log struct {
+					Level Enum `toml:"level"`
+				} `toml:"log"`
+			}
+			cfg.Log.Level.SetAllowed("debug", "info")
+
+			err := DecodeConfiguration(writeFile(t, dir, name, f.content), &cfg)
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("expected a single ValidationError, got %v", err)
+			}
+			if errs[0].Path != "log.level" || errs[0].Line != f.line {
+				t.Errorf("got path=%q line=%d, want log.level at line %d", errs[0].Path, errs[0].Line, f.line)
+			}
+			if !strings.Contains(errs[0].Err.Error(), `invalid value "loud"`) {
+				t.Errorf("unexpected message %q", errs[0].Err)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigurationErrorLocations(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name string
+		yaml string
+		json string
+		want ValidationError
+		// jsonLine and jsonColumn locate the key in the json document.
+		jsonLine, jsonColumn int
+	}{
+		{
+			name: "unknown field",
+			yaml: "name: api\nserver:\n  adress: 0.0.0.0\n",
+			json: "{\n  \"name\": \"api\",\n  \"server\": {\"adress\": \"0.0.0.0\"}\n}",
+			want: ValidationError{Path: "server.adress", Line: 3, Column: 3}, jsonLine: 3, jsonColumn: 14,
+		},
+		{
+			name: "wrong scalar type",
+			yaml: "name: api\nserver:\n  port: http\n",
+			json: "{\n  \"name\": \"api\",\n  \"server\": {\"port\": \"http\"}\n}",
+			want: ValidationError{Path: "server.port", Line: 3, Column: 3}, jsonLine: 3, jsonColumn: 14,
+		},
+		{
+			name: "array for a scalar",
+			yaml: "debug: true\nname: [a, b]\n",
+			json: "{\n  \"debug\": true,\n  \"name\": [\"a\", \"b\"]\n}",
+			want: ValidationError{Path: "name", Line: 2, Column: 1}, jsonLine: 3, jsonColumn: 3,
+		},
+		{
+			name: "scalar for a table",
+			yaml: "name: api\nserver: 3\n",
+			json: "{\n  \"name\": \"api\",\n  \"server\": 3\n}",
+			want: ValidationError{Path: "server", Line: 2, Column: 1}, jsonLine: 3, jsonColumn: 3,
+		},
+		{
+			name: "table in an array",
+			yaml: "name: api\ntags: [a, {b: 1}]\n",
+			json: "{\n  \"name\": \"api\",\n  \"tags\": [\"a\", {\"b\": 1}]\n}",
+			want: ValidationError{Path: "tags[1]", Line: 2, Column: 1}, jsonLine: 3, jsonColumn: 3,
+		},
+		{
+			name: "null in an array",
+			yaml: "name: api\ntags: [a, null]\n",
+			json: "{\n  \"name\": \"api\",\n  \"tags\": [\"a\", null]\n}",
+			want: ValidationError{Path: "tags[1]", Line: 2, Column: 1}, jsonLine: 3, jsonColumn: 3,
+		},
+	}
+	for _, tt := range tests {
+		for _, f := range []struct {
+			name, content string
+			line, column  int
+		}{
+			{"config.yaml", tt.yaml, tt.want.Line, tt.want.Column},
+			{"config.json", tt.json, tt.jsonLine, tt.jsonColumn},
+		} {
+			t.Run(tt.name+"/"+f.name, func(t *testing.T) {
+				err := DecodeConfiguration(writeFile(t, dir, f.name, f.content), &testConfig{})
+
+				var errs ValidationErrors
+				if !errors.As(err, &errs) || len(errs) != 1 {
+					t.Fatalf("expected a single ValidationError, got %v", err)
+				}
+				got := errs[0]
+				if got.Path != tt.want.Path || got.Line != f.line || got.Column != f.column {
+					t.Errorf("got path=%q line=%d column=%d, want path=%q line=%d column=%d",
+						got.Path, got.Line, got.Column, tt.want.Path, f.line, f.column)
+				}
+				if strings.Contains(got.Err.Error(), "TOML") {
+					t.Errorf("message names the intermediate toml document: %v", got.Err)
+				}
+			})
+		}
+	}
+}
+
+func TestDecodeConfigurationJSONSyntaxError(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.json", "{\n  \"name\": \"api\"\n  \"debug\": true\n}")
+
+	err := DecodeConfiguration(file, &testConfig{})
+	if err == nil || !strings.Contains(err.Error(), "line 3, column 3") {
+		t.Errorf("expected a located syntax error, got %v", err)
+	}
+}
+
+func TestDecodeConfigurationNullArrayElement(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]struct{ content, location string }{
+		"config.yaml": {"name: api\ntags: [a, null, c]\n", "line 2, column 1"},
+		"config.json": {"{\n  \"name\": \"api\",\n  \"tags\": [\"a\", null, \"c\"]\n}", "line 3, column 3"},
+	}
+	for name, f := range files {
+		t.Run(name, func(t *testing.T) {
+			err := DecodeConfiguration(writeFile(t, dir, name, f.content), &testConfig{})
+			if err == nil || !strings.Contains(err.Error(), "tags[1]: null is not allowed in arrays") {
+				t.Fatalf("expected a null element error for tags[1], got %v", err)
+			}
+			if !strings.Contains(err.Error(), f.location) {
+				t.Errorf("expected the error at %s, got %v", f.location, err)
+			}
+		})
+	}
+}
+
+func TestDecodeConfigurationWithFormat(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.conf", "name: api\n")
+
+	var cfg testConfig
+	if err := DecodeConfiguration(file, &cfg, WithFormat(FormatYAML)); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Name != "api" {
+		t.Errorf("Name = %q, want api", cfg.Name)
+	}
+}
+
+func TestParseConfigFormatParameter(t *testing.T) {
+	args := []string{"-unknown", "x", "-config.format", "yaml", "-config.file=a.yml"}
+	if got := ParseConfigFormatParameter(args); got != "yaml" {
+		t.Errorf("ParseConfigFormatParameter() = %q, want yaml", got)
+	}
+	if got := ParseConfigFileParameter(args); got != "a.yml" {
+		t.Errorf("ParseConfigFileParameter() = %q, want a.yml", got)
+	}
+}
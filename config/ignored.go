@@ -20,3 +20,17 @@ func (d ignoredFlag) Set(string) error {
 func IgnoredFlag(f *flag.FlagSet, name, message string) {
 	f.Var(ignoredFlag{name}, name, message)
 }
+
+type ignoredBoolFlag struct {
+	ignoredFlag
+}
+
+func (ignoredBoolFlag) IsBoolFlag() bool {
+	return true
+}
+
+// IgnoredBoolFlag ignores set value, without any warning. Unlike IgnoredFlag it
+// may be passed without a value, e.g. '-config.explain'.
+func IgnoredBoolFlag(f *flag.FlagSet, name, message string) {
+	f.Var(ignoredBoolFlag{ignoredFlag{name}}, name, message)
+}
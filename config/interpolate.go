@@ -0,0 +1,401 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+// WithEnvInterpolation replaces ${VAR} and ${VAR:-default} in configuration
+// files with the value of the VAR environment variable before they are
+// decoded. The default is used when VAR is unset or empty, and an unset VAR
+// without a default is replaced by an empty string. $${VAR} is written as a
+// literal ${VAR}. References in comments are left alone, and values are
+// escaped for the string they appear in, so a value containing quotes keeps
+// the file valid, or indented for the YAML block scalar they appear in.
+// Unquoted references are replaced as is, so they may provide numbers and
+// booleans, e.g. port = ${PORT:-8080}. Like the env package, VAR_FILE
+// provides VAR from a file, see env.FileSuffix. Interpolation is evaluated
+// again on every reload.
+func WithEnvInterpolation() DecodeOption {
+	return func(o *decodeOptions) {
+		o.interpolation = interpolateLenient
+	}
+}
+
+// WithStrictEnvInterpolation is WithEnvInterpolation, except that referencing
+// an unset variable without a default is an error.
+func WithStrictEnvInterpolation() DecodeOption {
+	return func(o *decodeOptions) {
+		o.interpolation = interpolateStrict
+	}
+}
+
+type interpolationMode int
+
+const (
+	interpolateNone interpolationMode = iota
+	interpolateLenient
+	interpolateStrict
+)
+
+// quoting is the kind of text a reference appears in, which decides how its
+// value is written.
+type quoting int
+
+const (
+	unquoted quoting = iota
+	// doubleQuoted strings escape with a backslash, like JSON strings and
+	// TOML basic strings.
+	doubleQuoted
+	multilineDoubleQuoted
+	// singleQuoted strings are literal, except for '' in YAML.
+	singleQuoted
+	multilineSingleQuoted
+	// blockScalar is the content of a YAML literal (|) or folded (>) block
+	// scalar, which has no escapes and ends at the first line indented no
+	// more than the line of its indicator.
+	blockScalar
+	comment
+)
+
+// interpolator expands the environment variable references of a
+// configuration file, keeping track of the strings and comments of the format
+// so values are escaped for where they are written and comments are left
+// alone.
+type interpolator struct {
+	data   []byte
+	format Format
+	mode   interpolationMode
+
+	i            int
+	quoting      quoting
+	out          bytes.Buffer
+	errs         ValidationErrors
+	line, column int
+
+	// the indentation of the line of the block scalar indicator, of the
+	// content of the block scalar once known, and whether it is folded.
+	blockParent, blockIndent int
+	blockFolded              bool
+}
+
+// interpolate expands the environment variable references in data, a
+// document in format.
+func interpolate(data []byte, format Format, mode interpolationMode) ([]byte, error) {
+	if mode == interpolateNone || !bytes.Contains(data, []byte("${")) {
+		return data, nil
+	}
+
+	s := &interpolator{data: data, format: format, mode: mode, line: 1, column: 1}
+	for s.i < len(data) {
+		if s.quoting == blockScalar {
+			s.blockLine()
+		}
+		if s.quoting == comment {
+			if data[s.i] == '\n' {
+				s.quoting = unquoted
+			}
+			s.copy(1)
+			continue
+		}
+
+		// $${ escapes a reference.
+		if s.hasPrefix("$${") {
+			s.out.WriteString("${")
+			s.skip(3)
+			continue
+		}
+		if s.reference() {
+			continue
+		}
+		s.token()
+	}
+	if len(s.errs) > 0 {
+		return nil, s.errs
+	}
+
+	return s.out.Bytes(), nil
+}
+
+func (s *interpolator) hasPrefix(prefix string) bool {
+	return bytes.HasPrefix(s.data[s.i:], []byte(prefix))
+}
+
+// skip advances past n bytes of the input without writing them.
+func (s *interpolator) skip(n int) {
+	for _, c := range s.data[s.i : s.i+n] {
+		s.column++
+		if c == '\n' {
+			s.line++
+			s.column = 1
+		}
+	}
+	s.i += n
+}
+
+// copy writes the next n bytes of the input as is.
+func (s *interpolator) copy(n int) {
+	if rest := len(s.data) - s.i; n > rest {
+		n = rest
+	}
+	s.out.Write(s.data[s.i : s.i+n])
+	s.skip(n)
+}
+
+// token copies the next byte of the input, or the next escape sequence or
+// string delimiter, and tracks which kind of text follows.
+func (s *interpolator) token() {
+	c := s.data[s.i]
+	switch s.quoting {
+	case unquoted:
+		switch {
+		case c == '#' && s.format == FormatTOML, c == '#' && s.format == FormatYAML && s.afterBlank():
+			s.quoting = comment
+		case (c == '|' || c == '>') && s.format == FormatYAML && s.startsScalar() && s.blockHeader():
+			s.blockParent, s.blockIndent, s.blockFolded = s.indentation(), -1, c == '>'
+			s.quoting = blockScalar
+			if end := bytes.IndexByte(s.data[s.i:], '\n'); end >= 0 {
+				s.copy(end + 1)
+			} else {
+				s.copy(len(s.data) - s.i)
+			}
+			return
+		case c == '"' && s.format == FormatTOML && s.hasPrefix(`"""`):
+			s.quoting = multilineDoubleQuoted
+			s.copy(3)
+			return
+		case c == '"' && (s.format != FormatYAML || s.startsScalar()):
+			s.quoting = doubleQuoted
+		case c == '\'' && s.format == FormatTOML && s.hasPrefix("'''"):
+			s.quoting = multilineSingleQuoted
+			s.copy(3)
+			return
+		case c == '\'' && (s.format == FormatTOML || s.format == FormatYAML && s.startsScalar()):
+			s.quoting = singleQuoted
+		}
+	case doubleQuoted, multilineDoubleQuoted:
+		switch {
+		case c == '\\':
+			s.copy(2)
+			return
+		case s.quoting == multilineDoubleQuoted && s.hasPrefix(`"""`):
+			s.quoting = unquoted
+			s.copy(s.closingQuotes('"'))
+			return
+		case c == '"' && s.quoting == doubleQuoted:
+			s.quoting = unquoted
+		}
+	case singleQuoted:
+		switch {
+		case s.format == FormatYAML && s.hasPrefix("''"):
+			s.copy(2)
+			return
+		case c == '\'':
+			s.quoting = unquoted
+		}
+	case multilineSingleQuoted:
+		if s.hasPrefix("'''") {
+			s.quoting = unquoted
+			s.copy(s.closingQuotes('\''))
+			return
+		}
+	}
+	s.copy(1)
+}
+
+// closingQuotes returns the length of the closing delimiter of a TOML
+// multi-line string at the current position, including the up to two quotes
+// before it that are part of the string.
+func (s *interpolator) closingQuotes(quote byte) int {
+	n := 0
+	for n < 5 && s.i+n < len(s.data) && s.data[s.i+n] == quote {
+		n++
+	}
+
+	return n
+}
+
+// blockHeader reports whether the current byte is the indicator of a YAML
+// block scalar, which may only be followed by indentation and chomping
+// indicators and a comment on its line.
+func (s *interpolator) blockHeader() bool {
+	j := s.i + 1
+	for j < len(s.data) && strings.IndexByte("0123456789+-", s.data[j]) >= 0 {
+		j++
+	}
+	blank := j
+	for j < len(s.data) && (s.data[j] == ' ' || s.data[j] == '\t') {
+		j++
+	}
+
+	return j == len(s.data) || s.data[j] == '\n' || s.data[j] == '\r' || s.data[j] == '#' && j > blank
+}
+
+// indentation returns the number of spaces the current line starts with.
+func (s *interpolator) indentation() int {
+	start := bytes.LastIndexByte(s.data[:s.i], '\n') + 1
+	n := 0
+	for start+n < len(s.data) && s.data[start+n] == ' ' {
+		n++
+	}
+
+	return n
+}
+
+// blockLine ends the block scalar when the current byte starts a line that
+// is not part of it. Blank lines are part of it whatever their indentation.
+func (s *interpolator) blockLine() {
+	if s.i > 0 && s.data[s.i-1] != '\n' {
+		return
+	}
+
+	indent := s.indentation()
+	if rest := s.data[s.i+indent:]; len(rest) == 0 || rest[0] == '\n' || rest[0] == '\r' {
+		return
+	}
+	if indent <= s.blockParent {
+		s.quoting = unquoted
+		return
+	}
+	if s.blockIndent < 0 {
+		s.blockIndent = indent
+	}
+}
+
+// afterBlank reports whether the current byte starts a line or follows a
+// blank, where a # starts a YAML comment.
+func (s *interpolator) afterBlank() bool {
+	return s.i == 0 || strings.ContainsRune(" \t\n", rune(s.data[s.i-1]))
+}
+
+// startsScalar reports whether the current byte starts a YAML scalar, so a
+// quote opens a string rather than being part of a plain scalar like it's.
+func (s *interpolator) startsScalar() bool {
+	j := s.i - 1
+	for j >= 0 && (s.data[j] == ' ' || s.data[j] == '\t') {
+		j--
+	}
+
+	return j < 0 || strings.ContainsRune("\n:-,[{?", rune(s.data[j]))
+}
+
+// reference expands the reference at the current position, if any.
+func (s *interpolator) reference() bool {
+	if !s.hasPrefix("${") {
+		return false
+	}
+	end := bytes.IndexAny(s.data[s.i+2:], "}\n")
+	if end < 0 || s.data[s.i+2+end] != '}' {
+		return false
+	}
+
+	s.expand(string(s.data[s.i+2 : s.i+2+end]))
+	s.skip(2 + end + 1)
+
+	return true
+}
+
+// expand writes the value of the reference ${expr}. Variables are read
+// through the env package, so NAME_FILE provides NAME from a file and the
+// variable is not reported as unused.
+func (s *interpolator) expand(expr string) {
+	name, def, hasDefault := strings.Cut(expr, ":-")
+	if !isEnvName(name) {
+		s.errorf("invalid environment variable reference ${%s}", expr)
+		return
+	}
+
+	switch value, ok, err := env.LookupEnv(name); {
+	case err != nil:
+		s.errorf("%s", err)
+	case hasDefault && value == "":
+		s.write(name, def)
+	case !ok && s.mode == interpolateStrict:
+		s.errorf("environment variable %s is not set", name)
+	default:
+		s.write(name, value)
+	}
+}
+
+// write writes the value of the reference to name escaped for the string it
+// appears in. Unquoted values are written as is, so they may provide numbers
+// and booleans.
+func (s *interpolator) write(name, value string) {
+	switch s.quoting {
+	case doubleQuoted, multilineDoubleQuoted:
+		s.out.WriteString(escapeDoubleQuoted(value))
+	case singleQuoted:
+		if strings.ContainsAny(value, "\n\r") || s.format == FormatTOML && strings.Contains(value, "'") {
+			s.errorf("the value of %s cannot be written in a single quoted string, use a double quoted one", name)
+			return
+		}
+		s.out.WriteString(strings.ReplaceAll(value, "'", "''"))
+	case blockScalar:
+		// continuation lines are indented like the block. Folded blocks turn
+		// single line breaks into spaces, so they are kept with a blank line.
+		sep := "\n"
+		if s.blockFolded {
+			sep = "\n\n"
+		}
+		s.out.WriteString(strings.ReplaceAll(value, "\n", sep+strings.Repeat(" ", s.blockIndent)))
+	case multilineSingleQuoted:
+		if strings.Contains(value, "'''") {
+			s.errorf("the value of %s cannot be written in a multi-line literal string, use a basic one", name)
+			return
+		}
+		s.out.WriteString(value)
+	default:
+		s.out.WriteString(value)
+	}
+}
+
+func (s *interpolator) errorf(format string, args ...any) {
+	s.errs = append(s.errs, &ValidationError{Line: s.line, Column: s.column, Err: fmt.Errorf(format, args...)})
+}
+
+// escapeDoubleQuoted escapes value for a double quoted string, with the
+// escapes JSON, TOML and YAML have in common.
+func escapeDoubleQuoted(value string) string {
+	var b strings.Builder
+	for _, r := range value {
+		switch r {
+		case '"', '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\u%04x`, r)
+			} else {
+				b.WriteRune(r)
+			}
+		}
+	}
+
+	return b.String()
+}
+
+// isEnvName reports whether name is a valid environment variable name.
+func isEnvName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, r := range name {
+		switch {
+		case r == '_', r >= 'A' && r <= 'Z', r >= 'a' && r <= 'z':
+		case r >= '0' && r <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
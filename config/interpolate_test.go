@@ -0,0 +1,189 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+func TestInterpolate(t *testing.T) {
+	t.Setenv("TEST_INTERPOLATE_NAME", "api")
+	t.Setenv("TEST_INTERPOLATE_EMPTY", "")
+
+	t.Setenv("TEST_INTERPOLATE_QUOTED", `say "hi" \ it's`)
+
+	tests := []struct {
+		format Format
+		in     string
+		want   string
+	}{
+		{FormatTOML, `name = "${TEST_INTERPOLATE_NAME}"`, `name = "api"`},
+		{FormatTOML, `name = "${TEST_INTERPOLATE_UNSET:-fallback}"`, `name = "fallback"`},
+		{FormatTOML, `name = "${TEST_INTERPOLATE_EMPTY:-fallback}"`, `name = "fallback"`},
+		{FormatTOML, `name = "${TEST_INTERPOLATE_UNSET}"`, `name = ""`},
+		{FormatTOML, `name = "$${TEST_INTERPOLATE_NAME}"`, `name = "${TEST_INTERPOLATE_NAME}"`},
+		{FormatTOML, `name = "$TEST_INTERPOLATE_NAME ${"`, `name = "$TEST_INTERPOLATE_NAME ${"`},
+		{FormatTOML, "port = ${TEST_INTERPOLATE_PORT:-8080}\n", "port = 8080\n"},
+		{FormatTOML, `name = "${TEST_INTERPOLATE_QUOTED}"`, `name = "say \"hi\" \\ it's"`},
+		{FormatTOML, "name = \"\"\"\n${TEST_INTERPOLATE_QUOTED}\"\"\"", "name = \"\"\"\nsay \\\"hi\\\" \\\\ it's\"\"\""},
+		{FormatTOML, `name = '${TEST_INTERPOLATE_NAME}' # ${TEST_INTERPOLATE_NAME}`, `name = 'api' # ${TEST_INTERPOLATE_NAME}`},
+		{FormatTOML, `name = "#${TEST_INTERPOLATE_NAME}"`, `name = "#api"`},
+		{FormatJSON, `{"name": "${TEST_INTERPOLATE_QUOTED}"}`, `{"name": "say \"hi\" \\ it's"}`},
+		{FormatYAML, `name: '${TEST_INTERPOLATE_QUOTED}'`, `name: 'say "hi" \ it''s'`},
+		{FormatYAML, `name: it's ${TEST_INTERPOLATE_NAME} # ${TEST_INTERPOLATE_NAME}`, `name: it's api # ${TEST_INTERPOLATE_NAME}`},
+		{FormatYAML, `name: a#${TEST_INTERPOLATE_NAME}`, `name: a#api`},
+		{FormatYAML, "text: |\n  'say' ${TEST_INTERPOLATE_QUOTED} # ${TEST_INTERPOLATE_NAME}\n\n  \"${TEST_INTERPOLATE_NAME}\n", "text: |\n  'say' say \"hi\" \\ it's # api\n\n  \"api\n"},
+		{FormatYAML, "text: >-\n  '${TEST_INTERPOLATE_QUOTED}' # ${TEST_INTERPOLATE_NAME}\nname: '${TEST_INTERPOLATE_QUOTED}' # ${TEST_INTERPOLATE_NAME}", "text: >-\n  'say \"hi\" \\ it's' # api\nname: 'say \"hi\" \\ it''s' # ${TEST_INTERPOLATE_NAME}"},
+		{FormatYAML, "list:\n  - |2 # ${TEST_INTERPOLATE_NAME}\n     # ${TEST_INTERPOLATE_NAME}\n  - # ${TEST_INTERPOLATE_NAME}\n", "list:\n  - |2 # ${TEST_INTERPOLATE_NAME}\n     # api\n  - # ${TEST_INTERPOLATE_NAME}\n"},
+		{FormatTOML, "name = '''\nit's ${TEST_INTERPOLATE_NAME} # ${TEST_INTERPOLATE_NAME}'''\nother = '${TEST_INTERPOLATE_NAME}' # ${TEST_INTERPOLATE_NAME}", "name = '''\nit's api # api'''\nother = 'api' # ${TEST_INTERPOLATE_NAME}"},
+		{FormatTOML, "name = \"\"\"\n# \"${TEST_INTERPOLATE_QUOTED}\"\"\"\"\nother = \"${TEST_INTERPOLATE_QUOTED}\" # ${TEST_INTERPOLATE_NAME}", "name = \"\"\"\n# \"say \\\"hi\\\" \\\\ it's\"\"\"\"\nother = \"say \\\"hi\\\" \\\\ it's\" # ${TEST_INTERPOLATE_NAME}"},
+	}
+	for _, tt := range tests {
+		got, err := interpolate([]byte(tt.in), tt.format, interpolateLenient)
+		if err != nil {
+			t.Errorf("interpolate(%q, %s) error: %v", tt.in, tt.format, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("interpolate(%q, %s) = %q, want %q", tt.in, tt.format, got, tt.want)
+		}
+	}
+}
+
+func TestInterpolateStrict(t *testing.T) {
+	in := "name = \"api\"\n\n[server]\naddress = \"${TEST_INTERPOLATE_UNSET}:${TEST_INTERPOLATE_PORT:-80}\"\n"
+	_, err := interpolate([]byte(in), FormatTOML, interpolateStrict)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 {
+		t.Fatalf("expected a single ValidationError, got %v", err)
+	}
+	if errs[0].Line != 4 || errs[0].Column != 12 || !strings.Contains(errs[0].Error(), "TEST_INTERPOLATE_UNSET is not set") {
+		t.Errorf("unexpected error: %+v", errs[0])
+	}
+}
+
+func TestInterpolateStrictComments(t *testing.T) {
+	in := "# set ${TEST_INTERPOLATE_UNSET} to override the name\nname = \"api\" # or ${TEST_INTERPOLATE_UNSET}\n"
+	got, err := interpolate([]byte(in), FormatTOML, interpolateStrict)
+	if err != nil {
+		t.Fatalf("interpolate() error: %v", err)
+	}
+	if string(got) != in {
+		t.Errorf("interpolate() = %q, want the comments left alone", got)
+	}
+}
+
+func TestInterpolateSingleQuoted(t *testing.T) {
+	t.Setenv("TEST_INTERPOLATE_QUOTED", "it's")
+
+	_, err := interpolate([]byte("name = '${TEST_INTERPOLATE_QUOTED}'\n"), FormatTOML, interpolateLenient)
+
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Column != 9 || !strings.Contains(errs[0].Error(), "TEST_INTERPOLATE_QUOTED cannot be written in a single quoted string") {
+		t.Errorf("expected a ValidationError for the literal string, got %v", err)
+	}
+}
+
+func TestDecodeConfigurationInterpolationQuotes(t *testing.T) {
+	value := "say \"hi\"\n\\o/ it's"
+	t.Setenv("TEST_INTERPOLATE_QUOTED", value)
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.toml": "name = \"${TEST_INTERPOLATE_QUOTED}\" # ${TEST_INTERPOLATE_UNSET}\n",
+		"config.json": `{"name": "${TEST_INTERPOLATE_QUOTED}"}`,
+		"config.yaml": "# ${TEST_INTERPOLATE_UNSET}\nname: \"${TEST_INTERPOLATE_QUOTED}\"\n",
+	} {
+		var cfg testConfig
+		if err := DecodeConfiguration(writeFile(t, dir, name, content), &cfg, WithStrictEnvInterpolation()); err != nil {
+			t.Errorf("DecodeConfiguration(%s) error: %v", name, err)
+			continue
+		}
+		if cfg.Name != value {
+			t.Errorf("%s: Name = %q, want %q", name, cfg.Name, value)
+		}
+	}
+}
+
+func TestDecodeConfigurationInterpolationBlockScalars(t *testing.T) {
+	value := "say \"hi\" # it's\nsecond line"
+	t.Setenv("TEST_INTERPOLATE_QUOTED", value)
+
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"literal.yaml": "name: |-\n  ${TEST_INTERPOLATE_QUOTED}\ntimeout: 1s\n",
+		"folded.yaml":  "name: >-\n    ${TEST_INTERPOLATE_QUOTED}\ntimeout: 1s\n",
+		"nested.yaml":  "server:\n  address: |-\n    ${TEST_INTERPOLATE_QUOTED}\nname: >-\n  ${TEST_INTERPOLATE_QUOTED}\ntimeout: 1s\n",
+		"basic.toml":   "name = \"\"\"${TEST_INTERPOLATE_QUOTED}\"\"\"\ntimeout = \"1s\"\n",
+		"literal.toml": "name = '''${TEST_INTERPOLATE_QUOTED}'''\ntimeout = \"1s\"\n",
+	} {
+		var cfg testConfig
+		if err := DecodeConfiguration(writeFile(t, dir, name, content), &cfg, WithStrictEnvInterpolation()); err != nil {
+			t.Errorf("DecodeConfiguration(%s) error: %v", name, err)
+			continue
+		}
+		if cfg.Name != value || cfg.Timeout != "1s" {
+			t.Errorf("%s: Name = %q, Timeout = %q, want %q and 1s", name, cfg.Name, cfg.Timeout, value)
+		}
+	}
+}
+
+func TestDecodeConfigurationInterpolation(t *testing.T) {
+	t.Setenv("TEST_INTERPOLATE_NAME", "api")
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "name = \"${TEST_INTERPOLATE_NAME}\"\n\n[server]\nport = ${TEST_INTERPOLATE_PORT:-8080}\n")
+
+	var cfg testConfig
+	if err := DecodeConfiguration(file, &cfg, WithEnvInterpolation()); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Name != "api" || cfg.Server.Port != 8080 {
+		t.Errorf("decoded = %+v", cfg)
+	}
+
+	var plain testConfig
+	if err := DecodeConfiguration(file, &plain); err == nil {
+		t.Error("expected the references to be left alone without WithEnvInterpolation")
+	}
+}
+
+func TestReloadConfigurationInterpolation(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "bucket = \"${TEST_INTERPOLATE_BUCKET}\"\n")
+	opts := decodeOptionsFrom(WithStrictEnvInterpolation())
+
+	for _, bucket := range []string{"first", "second"} {
+		t.Setenv("TEST_INTERPOLATE_BUCKET", bucket)
+
+		var cfg reloadConfig
+		if _, err := reloadConfiguration(&cfg, flag.NewFlagSet("test", flag.ContinueOnError), []string{file}, nil, opts); err != nil {
+			t.Fatalf("reloadConfiguration() error: %v", err)
+		}
+		if cfg.Bucket != bucket {
+			t.Errorf("Bucket = %q, want %q", cfg.Bucket, bucket)
+		}
+	}
+}
+
+func TestDecodeConfigurationInterpolationEnvFile(t *testing.T) {
+	dir := t.TempDir()
+	setenvFile(t, "TEST_INTERPOLATE_SECRET", writeFile(t, dir, "secret", "hunter2\n"))
+	t.Setenv("TEST_INTERPOLATE_REFERENCED", "api")
+
+	file := writeFile(t, dir, "config.toml", "name = \"${TEST_INTERPOLATE_REFERENCED}\"\ntimeout = \"${TEST_INTERPOLATE_SECRET}\"\n")
+	var cfg testConfig
+	if err := DecodeConfiguration(file, &cfg, WithStrictEnvInterpolation()); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Name != "api" || cfg.Timeout != "hunter2" {
+		t.Errorf("decoded = %+v, want the variables and the file companion expanded", cfg)
+	}
+	if unused := env.Unused("TEST_INTERPOLATE_"); len(unused) != 0 {
+		t.Errorf("Unused() = %v, want the referenced variables to be used", unused)
+	}
+}
@@ -0,0 +1,321 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// ParseConfigFileParameters returns every -config.file value in args, in the
+// order they were given. Unlike ParseConfigFileParameter, the flag may be
+// repeated to layer several configuration files on top of each other.
+func ParseConfigFileParameters(args []string) []string {
+	return parseRepeatedFlagParameter(args, ConfigFileFlag)
+}
+
+// parseRepeatedFlagParameter scans args for every occurrence of the flag
+// name, accepting both the '-name value' and '-name=value' forms. Scanning
+// stops at the '--' terminator, like the flag package.
+func parseRepeatedFlagParameter(args []string, name string) []string {
+	var values []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			break
+		}
+
+		trimmed := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if trimmed == arg {
+			continue
+		}
+
+		switch {
+		case trimmed == name:
+			if i+1 < len(args) {
+				values = append(values, args[i+1])
+				i++
+			}
+		case strings.HasPrefix(trimmed, name+"="):
+			values = append(values, strings.TrimPrefix(trimmed, name+"="))
+		}
+	}
+
+	return values
+}
+
+// ExpandConfigFiles resolves the -config.file values into the list of files
+// to decode. Directories (e.g. a conf.d/ directory) are replaced by the
+// toml, yaml and json files they directly contain, sorted lexically. The
+// returned paths are absolute.
+func ExpandConfigFiles(paths []string) ([]string, error) {
+	return expandConfigFiles(OSFileSystem{}, paths)
+}
+
+func expandConfigFiles(fsys FileSystem, paths []string) ([]string, error) {
+	var files []string
+	for _, path := range paths {
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get absolute path for config file %s: %w", path, err)
+		}
+
+		info, err := fsys.Stat(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to stat config file %s: %w", path, err)
+		}
+		if !info.IsDir() {
+			files = append(files, abs)
+			continue
+		}
+
+		entries, err := fsys.ReadDir(abs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read config directory %s: %w", path, err)
+		}
+
+		// ReadDir returns the entries sorted by filename.
+		for _, entry := range entries {
+			if entry.IsDir() || !isConfigFile(entry.Name()) {
+				continue
+			}
+			files = append(files, filepath.Join(abs, entry.Name()))
+		}
+	}
+
+	return files, nil
+}
+
+func isConfigFile(name string) bool {
+	if strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".toml", ".yaml", ".yml", ".json":
+		return true
+	default:
+		return false
+	}
+}
+
+// DecodeConfigurationFiles decodes every file into config, with later files
+// overriding earlier ones key-by-key. Tables are merged recursively while
+// arrays and scalar values are replaced. Each file is checked for unknown
+// fields on its own so errors name the file that caused them.
+func DecodeConfigurationFiles(files []string, config any, opts ...DecodeOption) error {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	_, err := decodeFiles(files, config, o)
+	return err
+}
+
+// document is a parsed configuration file.
+type document struct {
+	file string
+	data map[string]any
+}
+
+// decodeResult describes what decodeFiles read.
+type decodeResult struct {
+	// docs are the parsed configuration files, in order.
+	docs []document
+	// secretFiles are the local files secret references were resolved from.
+	secretFiles []string
+}
+
+// decodeFiles implements DecodeConfigurationFiles and returns the parsed
+// documents so callers can tell which file set which key.
+func decodeFiles(files []string, config any, o decodeOptions) (decodeResult, error) {
+	ctx := o.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	var result decodeResult
+	names := append([]string{}, files...)
+	for _, source := range o.sources {
+		names = append(names, source.Name())
+	}
+	count := len(names)
+	merged := map[string]any{}
+	upgrader := newUpgrader(config, o.logger)
+	add := func(name string, data []byte, format Format) error {
+		data, err := interpolate(data, format, o.interpolation)
+		if err != nil {
+			return withFile(err, name)
+		}
+
+		// with several documents, decode into a throwaway value first so
+		// unknown fields and type errors are attributed to this document
+		// rather than the merged result.
+		target := config
+		if count > 1 {
+			target = newLike(config)
+		}
+
+		// documents using deprecated keys or an outdated format are decoded
+		// from their upgraded form. Syntax errors are left to decode, which
+		// reports their position.
+		var doc map[string]any
+		if upgrader != nil {
+			if parsed, err := parseDocument(data, format); err == nil {
+				changed, err := upgrader.upgrade(name, parsed, keyPosition(data, format))
+				if err != nil {
+					return withFile(err, name)
+				}
+				if changed {
+					if err := decodeDocument(parsed, target, format, keyPosition(data, format)); err != nil {
+						return withFile(err, name)
+					}
+					doc = parsed
+				}
+			}
+		}
+
+		if doc == nil {
+			if err := decode(data, format, target); err != nil {
+				return withFile(err, name)
+			}
+
+			doc, err = parseDocument(data, format)
+			if err != nil {
+				return fmt.Errorf("failed to decode %s: %w", name, err)
+			}
+		}
+		result.docs = append(result.docs, document{file: name, data: doc})
+		mergeDocuments(merged, doc, reflect.TypeOf(config))
+
+		return nil
+	}
+
+	for _, file := range files {
+		data, format, err := readConfigFile(o.fileSystem(), file, o.format)
+		if err != nil {
+			return result, err
+		}
+		if err := add(file, data, format); err != nil {
+			return result, err
+		}
+	}
+
+	for _, source := range o.sources {
+		data, format, err := source.Fetch(ctx)
+		if err != nil {
+			return result, fmt.Errorf("failed to fetch configuration from %s: %w", source.Name(), err)
+		}
+		if s, ok := source.(StringSource); ok && s.StringValues() {
+			if data, format, err = convertStrings(data, format, reflect.TypeOf(config)); err != nil {
+				return result, withFile(err, source.Name())
+			}
+		}
+		if err := add(source.Name(), data, format); err != nil {
+			return result, err
+		}
+	}
+
+	resolved, secretFiles, err := resolveSecrets(ctx, merged, reflect.TypeOf(config), o.resolvers)
+	if err != nil {
+		return result, err
+	}
+	result.secretFiles = secretFiles
+
+	// a single document without secret references has already been decoded
+	// into config above.
+	if count > 1 || resolved {
+		if err := decodeDocument(merged, config, "", nil); err != nil {
+			return result, fmt.Errorf("failed to decode %s: %w", strings.Join(names, ", "), err)
+		}
+	}
+
+	return result, nil
+}
+
+// lookup reports whether the key path is set in the document.
+func (d document) lookup(path []string) bool {
+	_, ok := d.lookupValue(path)
+	return ok
+}
+
+func readConfigFile(fsys FileSystem, file string, format Format) ([]byte, Format, error) {
+	if format == "" {
+		format = FormatFromPath(file)
+	}
+
+	data, err := fsys.ReadFile(file)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read configuration file %s: %w", file, err)
+	}
+
+	return data, format, nil
+}
+
+// mergeDocuments merges src into dst. Nested tables are merged key-by-key,
+// every other value in src replaces the one in dst. The keys of the structs
+// of t are renamed to the toml name of their field first: the decoder matches
+// them case-insensitively, so Port in src overrides port in dst. t is nil for
+// tables decoded into interfaces, whose keys are kept as they are.
+func mergeDocuments(dst, src map[string]any, t reflect.Type) {
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	for k, v := range src {
+		var vt reflect.Type
+		switch {
+		case t == nil:
+		case isStruct(t):
+			if name, ft, ok := tomlField(t, k); ok {
+				k, vt = name, ft
+			}
+		case t.Kind() == reflect.Map:
+			vt = t.Elem()
+		}
+
+		srcTable, ok := v.(map[string]any)
+		if !ok {
+			dst[k] = v
+			continue
+		}
+
+		dstTable, ok := dst[k].(map[string]any)
+		if !ok {
+			dstTable = map[string]any{}
+			dst[k] = dstTable
+		}
+		mergeDocuments(dstTable, srcTable, vt)
+	}
+}
+
+// newLike returns a pointer to a new zero value of the struct config points
+// to, following any number of pointer indirections.
+func newLike(config any) any {
+	t := reflect.TypeOf(config)
+	for t.Kind() == reflect.Ptr && t.Elem().Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Ptr {
+		return reflect.New(t).Interface()
+	}
+
+	return reflect.New(t.Elem()).Interface()
+}
+
+// lookupKey finds key in table, falling back to a case-insensitive match like
+// the toml decoder does.
+func lookupKey(table map[string]any, key string) (any, bool) {
+	if v, ok := table[key]; ok {
+		return v, true
+	}
+	for k, v := range table {
+		if strings.EqualFold(k, key) {
+			return v, true
+		}
+	}
+
+	return nil, false
+}
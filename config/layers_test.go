@@ -0,0 +1,119 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseConfigFileParameters(t *testing.T) {
+	args := []string{"-config.file", "base.toml", "-other", "--config.file=prod.toml", "--", "-config.file", "ignored.toml"}
+	got := ParseConfigFileParameters(args)
+	want := []string{"base.toml", "prod.toml"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ParseConfigFileParameters() = %v, want %v", got, want)
+	}
+}
+
+func TestDecodeConfigurationFilesLayered(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.toml", `
+name = "api"
+tags = ["a", "b"]
+
+[server]
+address = "0.0.0.0"
+port = 8080
+`)
+	overlay := writeFile(t, dir, "prod.yaml", `
+tags: [c]
+server:
+  port: 9090
+`)
+
+	var cfg testConfig
+	if err := DecodeConfigurationFiles([]string{base, overlay}, &cfg); err != nil {
+		t.Fatalf("DecodeConfigurationFiles() error: %v", err)
+	}
+
+	if cfg.Name != "api" {
+		t.Errorf("Name = %q, want api", cfg.Name)
+	}
+	if !reflect.DeepEqual(cfg.Tags, []string{"c"}) {
+		t.Errorf("Tags = %v, want [c]", cfg.Tags)
+	}
+	if cfg.Server.Address != "0.0.0.0" || cfg.Server.Port != 9090 {
+		t.Errorf("Server = %+v, want address from base and port from overlay", cfg.Server)
+	}
+}
+
+func TestDecodeConfigurationFilesMergesKeysCaseInsensitively(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.toml", `
+name = "api"
+
+[server]
+address = "0.0.0.0"
+port = 8080
+`)
+	overlay := writeFile(t, dir, "prod.yaml", `
+Name: worker
+Server:
+  Port: 9090
+`)
+
+	var cfg testConfig
+	if err := DecodeConfigurationFiles([]string{base, overlay}, &cfg); err != nil {
+		t.Fatalf("DecodeConfigurationFiles() error: %v", err)
+	}
+	if cfg.Name != "worker" || cfg.Server.Address != "0.0.0.0" || cfg.Server.Port != 9090 {
+		t.Errorf("cfg = %+v, want the overlay to override the keys of the base whatever their case", cfg)
+	}
+}
+
+func TestDecodeConfigurationFilesNamesFailingFile(t *testing.T) {
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.toml", "name = \"api\"\n")
+	bad := writeFile(t, dir, "bad.toml", "nmae = \"api\"\n")
+
+	err := DecodeConfigurationFiles([]string{base, bad}, &testConfig{})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if !strings.Contains(err.Error(), bad) || strings.Contains(err.Error(), base) {
+		t.Errorf("error should only name %s: %v", bad, err)
+	}
+}
+
+func TestExpandConfigFiles(t *testing.T) {
+	dir := t.TempDir()
+	confd := filepath.Join(dir, "conf.d")
+	if err := os.Mkdir(confd, 0o700); err != nil {
+		t.Fatal(err)
+	}
+	writeFile(t, confd, "20-overlay.yaml", "")
+	writeFile(t, confd, "10-base.toml", "")
+	writeFile(t, confd, "README.md", "")
+	writeFile(t, confd, ".hidden.toml", "")
+	base := writeFile(t, dir, "base.toml", "")
+
+	got, err := ExpandConfigFiles([]string{base, confd})
+	if err != nil {
+		t.Fatalf("ExpandConfigFiles() error: %v", err)
+	}
+
+	want := []string{
+		base,
+		filepath.Join(confd, "10-base.toml"),
+		filepath.Join(confd, "20-overlay.yaml"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ExpandConfigFiles() = %v, want %v", got, want)
+	}
+
+	if _, err := ExpandConfigFiles([]string{filepath.Join(dir, "missing.toml")}); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
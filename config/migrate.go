@@ -0,0 +1,389 @@
+package config
+
+import (
+	"fmt"
+	"log/slog"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// KeyAliaser is implemented by configurations that renamed some of their
+// keys. KeyAliases maps the dotted path of every deprecated key, relative to
+// the configuration, to the path of its replacement, e.g.
+// {"MaxRetryDelay": "max_retry_delay"}. Aliases are collected from every
+// struct reachable from the decoded configuration, so a nested configuration
+// declares them once wherever it is used. KeyAliases must work on a zero
+// value.
+//
+// Deprecated keys are moved to their replacement before decoding, with a
+// warning naming the file, the position of the key and the key to use
+// instead. Setting both a deprecated key and its replacement is an error.
+type KeyAliaser interface {
+	KeyAliases() map[string]string
+}
+
+// ConfigVersionKey is the top-level key documents of a Migrator declare their
+// version with.
+const ConfigVersionKey = "config_version"
+
+// Migration upgrades a configuration document to Version.
+type Migration struct {
+	// Version is the version of the documents Migrate returns, greater than
+	// zero.
+	Version int
+	// Description says what changed, e.g. "retry delays are durations".
+	Description string
+	// Migrate rewrites the generic document in place.
+	Migrate func(doc map[string]any) error
+}
+
+// Migrator is implemented by root configurations whose documents are
+// versioned with a top-level config_version key. Documents without one are
+// version 0, except for the documents layered on top of the first one, which
+// are written for its version. Every Migration with a greater Version is
+// applied in order before decoding, with a warning asking to update the
+// file, and documents written for a newer version than the last Migration
+// are rejected.
+type Migrator interface {
+	Migrations() []Migration
+}
+
+// WithDecodeLogger sets the logger decoding warnings, such as the use of a
+// deprecated key, are reported to. Defaults to slog.Default().
+func WithDecodeLogger(logger *slog.Logger) DecodeOption {
+	return func(o *decodeOptions) {
+		o.logger = logger
+	}
+}
+
+// upgrader applies the KeyAliases and Migrations of a configuration to the
+// documents decoded into it.
+type upgrader struct {
+	aliases    map[string]string
+	migrations []Migration
+	logger     *slog.Logger
+
+	// base is the version of the first document upgraded, once it is known.
+	// Overlays without a config_version are partial documents written for it,
+	// which must not have older migrations applied again.
+	base *int
+}
+
+// newUpgrader returns the upgrader of config, or nil when it declares no
+// aliases and no migrations.
+func newUpgrader(config any, logger *slog.Logger) *upgrader {
+	u := &upgrader{aliases: map[string]string{}, logger: logger}
+	if u.logger == nil {
+		u.logger = slog.Default()
+	}
+
+	if m, ok := config.(Migrator); ok {
+		u.migrations = append(u.migrations, m.Migrations()...)
+		sort.SliceStable(u.migrations, func(i, j int) bool {
+			return u.migrations[i].Version < u.migrations[j].Version
+		})
+	}
+
+	t := reflect.TypeOf(config)
+	for t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t != nil && t.Kind() == reflect.Struct {
+		collectAliases(t, nil, u.aliases, map[reflect.Type]bool{})
+	}
+
+	if len(u.aliases) == 0 && len(u.migrations) == 0 {
+		return nil
+	}
+
+	return u
+}
+
+// collectAliases adds the KeyAliases of t and of the structs reachable from
+// it, prefixed with their path, to aliases.
+func collectAliases(t reflect.Type, path []string, aliases map[string]string, visiting map[reflect.Type]bool) {
+	if visiting[t] {
+		return
+	}
+	visiting[t] = true
+	defer delete(visiting, t)
+
+	if a, ok := reflect.New(t).Interface().(KeyAliaser); ok {
+		prefix := strings.Join(path, ".")
+		for old, replacement := range a.KeyAliases() {
+			if prefix != "" {
+				old, replacement = prefix+"."+old, prefix+"."+replacement
+			}
+			aliases[old] = replacement
+		}
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, tagged := tomlName(sf)
+		if name == "-" {
+			continue
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		if !isStruct(ft) {
+			continue
+		}
+
+		if sf.Anonymous && !tagged {
+			collectAliases(ft, path, aliases, visiting)
+			continue
+		}
+		collectAliases(ft, append(append([]string{}, path...), name), aliases, visiting)
+	}
+}
+
+// upgrade applies the migrations and aliases to doc, the document parsed
+// from file, and reports whether it changed. position locates a key path in
+// the source for the warnings, and may be nil.
+func (u *upgrader) upgrade(file string, doc map[string]any, position func(key []string) (int, int, bool)) (bool, error) {
+	changed := false
+
+	if len(u.migrations) > 0 {
+		version := 0
+		if u.base != nil {
+			version = *u.base
+		}
+		if v, ok := doc[ConfigVersionKey]; ok {
+			var err error
+			if version, err = documentVersion(v); err != nil {
+				return false, &ValidationError{Path: ConfigVersionKey, Err: err}
+			}
+			// config_version is not a field of the configuration, so the
+			// document is decoded from doc rather than from the source.
+			delete(doc, ConfigVersionKey)
+			changed = true
+		}
+
+		latest := u.migrations[len(u.migrations)-1].Version
+		if version > latest {
+			return false, &ValidationError{Path: ConfigVersionKey, Err: fmt.Errorf("version %d is newer than the latest supported version %d", version, latest)}
+		}
+		if u.base == nil {
+			base := version
+			u.base = &base
+		}
+
+		var applied []string
+		for _, m := range u.migrations {
+			if m.Version <= version {
+				continue
+			}
+			if err := m.Migrate(doc); err != nil {
+				return false, fmt.Errorf("failed to migrate configuration to version %d: %w", m.Version, err)
+			}
+			applied = append(applied, m.Description)
+			changed = true
+		}
+		if len(applied) > 0 {
+			u.logger.Warn("configuration file uses an outdated format and was migrated, update it and set "+ConfigVersionKey+" to silence this warning",
+				"file", file,
+				"version", version,
+				"latest_version", latest,
+				"migrations", applied,
+			)
+		}
+	}
+
+	olds := make([]string, 0, len(u.aliases))
+	for old := range u.aliases {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+
+	var errs ValidationErrors
+	for _, old := range olds {
+		oldPath := strings.Split(old, ".")
+		value, ok := removeKey(doc, oldPath)
+		if !ok {
+			continue
+		}
+		changed = true
+
+		replacement := u.aliases[old]
+		newPath := strings.Split(replacement, ".")
+		line, column := 0, 0
+		if position != nil {
+			line, column, _ = position(oldPath)
+		}
+
+		if _, exists := (document{data: doc}).lookupValue(newPath); exists {
+			errs = append(errs, &ValidationError{
+				Path:   old,
+				Line:   line,
+				Column: column,
+				Err:    fmt.Errorf("deprecated key is set together with its replacement %s, remove it", replacement),
+			})
+			continue
+		}
+		setKey(doc, newPath, value)
+
+		attrs := []any{"file", file, "key", old, "replacement", replacement}
+		if line > 0 {
+			attrs = append(attrs, "line", line, "column", column)
+		}
+		u.logger.Warn("configuration uses a deprecated key, rename it", attrs...)
+	}
+	if len(errs) > 0 {
+		return false, errs
+	}
+
+	return changed, nil
+}
+
+func documentVersion(v any) (int, error) {
+	switch v := v.(type) {
+	case int:
+		return v, nil
+	case int64:
+		return int(v), nil
+	case float64:
+		if v == math.Trunc(v) {
+			return int(v), nil
+		}
+	}
+
+	return 0, fmt.Errorf("expected an integer, got %v", v)
+}
+
+// lookupValue returns the value at the key path.
+func (d document) lookupValue(path []string) (any, bool) {
+	table := d.data
+	for i, part := range path {
+		v, ok := lookupKey(table, part)
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			return v, true
+		}
+
+		if table, ok = v.(map[string]any); !ok {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// removeKey deletes the key path from doc and returns its value. Tables left
+// empty are kept, since an empty table is valid on its own.
+func removeKey(doc map[string]any, path []string) (any, bool) {
+	table := doc
+	for i, part := range path {
+		key, ok := findKey(table, part)
+		if !ok {
+			return nil, false
+		}
+		if i == len(path)-1 {
+			v := table[key]
+			delete(table, key)
+			return v, true
+		}
+
+		if table, ok = table[key].(map[string]any); !ok {
+			return nil, false
+		}
+	}
+
+	return nil, false
+}
+
+// setKey sets the key path of doc to value, creating tables as needed.
+func setKey(doc map[string]any, path []string, value any) {
+	table := doc
+	for _, part := range path[:len(path)-1] {
+		key, ok := findKey(table, part)
+		if !ok {
+			key = part
+		}
+		next, ok := table[key].(map[string]any)
+		if !ok {
+			next = map[string]any{}
+			table[key] = next
+		}
+		table = next
+	}
+	table[path[len(path)-1]] = value
+}
+
+// findKey returns the key of table matching name, falling back to a
+// case-insensitive match like lookupKey.
+func findKey(table map[string]any, name string) (string, bool) {
+	if _, ok := table[name]; ok {
+		return name, true
+	}
+	for k := range table {
+		if strings.EqualFold(k, name) {
+			return k, true
+		}
+	}
+
+	return "", false
+}
+
+// keyPosition returns a function locating key paths in data, or nil when
+// the format has no positions.
+func keyPosition(data []byte, format Format) func(key []string) (int, int, bool) {
+	switch format {
+	case FormatTOML, "":
+		return func(key []string) (int, int, bool) {
+			return tomlPosition(data, key)
+		}
+	case FormatYAML:
+		var root yaml.Node
+		if err := yaml.Unmarshal(data, &root); err != nil {
+			return nil
+		}
+		return func(key []string) (int, int, bool) {
+			return yamlPosition(&root, key)
+		}
+	case FormatJSON:
+		return func(key []string) (int, int, bool) {
+			return jsonPosition(data, key)
+		}
+	default:
+		return nil
+	}
+}
+
+// tomlPosition finds the line and column of the key path in a toml document.
+func tomlPosition(data []byte, key []string) (int, int, bool) {
+	for _, k := range tomlKeys(data) {
+		if equalPaths(k.path, key) {
+			line, column := offsetPosition(data, k.offset)
+			return line, column, true
+		}
+	}
+
+	return 0, 0, false
+}
+
+func equalPaths(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !strings.EqualFold(a[i], b[i]) {
+			return false
+		}
+	}
+
+	return true
+}
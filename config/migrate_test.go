@@ -0,0 +1,163 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type retryPolicy struct {
+	MaxRetries    int `toml:"max_retries"`
+	MaxRetryDelay int `toml:"max_retry_delay"`
+}
+
+func (p *retryPolicy) KeyAliases() map[string]string {
+	return map[string]string{"MaxRetryDelay": "max_retry_delay"}
+}
+
+type migratedConfig struct {
+	Name  string       `toml:"name"`
+	Retry *retryPolicy `toml:"retry"`
+	Port  int          `toml:"port"`
+}
+
+func (c *migratedConfig) Migrations() []Migration {
+	return []Migration{{
+		Version:     1,
+		Description: "address is split into host and port",
+		Migrate: func(doc map[string]any) error {
+			address, ok := doc["address"].(string)
+			if !ok {
+				return nil
+			}
+			delete(doc, "address")
+			_, port, _ := strings.Cut(address, ":")
+			n, err := strconv.Atoi(port)
+			if err != nil {
+				return err
+			}
+			doc["port"] = int64(n)
+			return nil
+		},
+	}}
+}
+
+func TestDecodeConfigurationKeyAliases(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "config_version = 1\nname = \"api\"\n\n[retry]\nmax_retries = 3\nMaxRetryDelay = 30\n")
+
+	var cfg migratedConfig
+	if err := DecodeConfiguration(file, &cfg, WithDecodeLogger(logger)); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Retry == nil || cfg.Retry.MaxRetryDelay != 30 || cfg.Retry.MaxRetries != 3 {
+		t.Errorf("decoded = %+v", cfg.Retry)
+	}
+	for _, want := range []string{"key=retry.MaxRetryDelay", "replacement=retry.max_retry_delay", "line=6", "column=1"} {
+		if !strings.Contains(logs.String(), want) {
+			t.Errorf("warning %q does not contain %s", logs.String(), want)
+		}
+	}
+
+	both := writeFile(t, dir, "both.toml", "config_version = 1\n[retry]\nMaxRetryDelay = 30\nmax_retry_delay = 10\n")
+	if err := DecodeConfiguration(both, &migratedConfig{}, WithDecodeLogger(logger)); err == nil || !strings.Contains(err.Error(), "retry.MaxRetryDelay: deprecated key is set together with its replacement") {
+		t.Errorf("expected the deprecated key to conflict with its replacement, got %v", err)
+	}
+
+	unknown := writeFile(t, dir, "unknown.toml", "config_version = 1\n[retry]\nMaxRetryDelay = 30\nmax_delay = 10\n")
+	var errs ValidationErrors
+	if err := DecodeConfiguration(unknown, &migratedConfig{}, WithDecodeLogger(logger)); !errors.As(err, &errs) || len(errs) != 1 || errs[0].Path != "retry.max_delay" {
+		t.Errorf("expected retry.max_delay to be an unknown field, got %v", err)
+	}
+}
+
+func TestDecodeConfigurationMigrations(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.yaml", "name: api\naddress: localhost:8080\n")
+
+	var cfg migratedConfig
+	if err := DecodeConfiguration(file, &cfg, WithDecodeLogger(logger)); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Name != "api" || cfg.Port != 8080 {
+		t.Errorf("decoded = %+v", cfg)
+	}
+	if !strings.Contains(logs.String(), "outdated format") {
+		t.Errorf("expected a migration warning, got %q", logs.String())
+	}
+
+	current := writeFile(t, dir, "current.toml", "config_version = 1\nport = 9090\n")
+	if err := DecodeConfiguration(current, &migratedConfig{}, WithDecodeLogger(logger)); err != nil {
+		t.Errorf("DecodeConfiguration() of a current file error: %v", err)
+	}
+
+	newer := writeFile(t, dir, "newer.toml", "config_version = 2\n")
+	if err := DecodeConfiguration(newer, &migratedConfig{}, WithDecodeLogger(logger)); err == nil {
+		t.Error("expected a file written for a newer version to be rejected")
+	}
+}
+
+func TestDecodeConfigurationFilesOverlayVersion(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	// an overlay without config_version is written for the version of the
+	// base, so address is no longer a key of it.
+	dir := t.TempDir()
+	base := writeFile(t, dir, "base.toml", "config_version = 1\nname = \"api\"\nport = 8080\n")
+	overlay := writeFile(t, dir, "overlay.toml", "port = 9090\n")
+	var cfg migratedConfig
+	if err := DecodeConfigurationFiles([]string{base, overlay}, &cfg, WithDecodeLogger(logger)); err != nil {
+		t.Fatalf("DecodeConfigurationFiles() error: %v", err)
+	}
+	if cfg.Name != "api" || cfg.Port != 9090 {
+		t.Errorf("decoded = %+v", cfg)
+	}
+	if strings.Contains(logs.String(), "outdated format") {
+		t.Errorf("expected the overlay not to be migrated, got %q", logs.String())
+	}
+
+	outdated := writeFile(t, dir, "outdated.toml", "address = \"localhost:9090\"\n")
+	if err := DecodeConfigurationFiles([]string{base, outdated}, &migratedConfig{}, WithDecodeLogger(logger)); err == nil || !strings.Contains(err.Error(), "address") {
+		t.Errorf("expected address to be an unknown field of an overlay of a current base, got %v", err)
+	}
+
+	// overlays of an unversioned base are migrated along with it.
+	logs.Reset()
+	old := writeFile(t, dir, "old.toml", "name = \"api\"\naddress = \"localhost:8080\"\n")
+	cfg = migratedConfig{}
+	if err := DecodeConfigurationFiles([]string{old, outdated}, &cfg, WithDecodeLogger(logger)); err != nil {
+		t.Fatalf("DecodeConfigurationFiles() error: %v", err)
+	}
+	if cfg.Port != 9090 {
+		t.Errorf("decoded = %+v, want the port of the migrated overlay", cfg)
+	}
+	if strings.Count(logs.String(), "outdated format") != 2 {
+		t.Errorf("expected both documents to be migrated, got %q", logs.String())
+	}
+}
+
+func TestTOMLPosition(t *testing.T) {
+	data := []byte("name = \"api\"\n\n[server.tls]\n  cert = \"a\"\nretry.max = 1\n")
+	tests := map[string][2]int{
+		"name":                 {1, 1},
+		"server.tls":           {3, 9},
+		"server.tls.cert":      {4, 3},
+		"server.tls.retry.max": {5, 7},
+	}
+	for key, want := range tests {
+		line, column, ok := tomlPosition(data, strings.Split(key, "."))
+		if !ok || line != want[0] || column != want[1] {
+			t.Errorf("tomlPosition(%s) = %d:%d %v, want %d:%d", key, line, column, ok, want[0], want[1])
+		}
+	}
+}
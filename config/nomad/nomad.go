@@ -1,8 +1,10 @@
 package nomad
 
 import (
+	"context"
 	"crypto/tls"
 	"flag"
+	"fmt"
 	"net/http"
 	"runtime"
 	"strings"
@@ -34,8 +36,8 @@ func (c *NomadConfig) RegisterFlags(f *flag.FlagSet, prefix string) {
 	if prefix != "" {
 		envPrefix = envPrefix + "_" + strings.ToUpper(prefix)
 	}
-	f.StringVar(&c.Address, cliPrefix+".addr", env.GetEnvStrDefault(envPrefix+"_ADDR", "localhost:4646"), "hostname:port to connect to the nomad server")
-	f.StringVar(&c.Token, cliPrefix+".token", env.GetEnvStrDefault(envPrefix+"_TOKEN", ""), "Token to use to authenticate to nomad")
+	env.StringVar(f, &c.Address, cliPrefix+".addr", envPrefix+"_ADDR", "localhost:4646", "hostname:port to connect to the nomad server")
+	env.StringVar(f, &c.Token, cliPrefix+".token", envPrefix+"_TOKEN", "", "Token to use to authenticate to nomad")
 }
 
 func (c *NomadConfig) Merge(other *NomadConfig) error {
@@ -56,6 +58,27 @@ func (c *NomadConfig) Merge(other *NomadConfig) error {
 	return nil
 }
 
+// Preflight checks that nomad accepts the address and token of other before
+// Merge swaps them in, by reading the token itself. Clusters without ACLs
+// pass the check as long as they can be reached.
+func (c *NomadConfig) Preflight(ctx context.Context, other *NomadConfig) error {
+	client, err := (&NomadConfig{Address: other.Address, Token: other.Token}).CreateClient()
+	if err != nil {
+		return fmt.Errorf("failed to create nomad client: %w", err)
+	}
+	defer client.Close()
+
+	_, _, err = client.ACLTokens().Self((&api.QueryOptions{}).WithContext(ctx))
+	if err != nil && strings.Contains(err.Error(), "ACL support disabled") {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("nomad at %s rejected the token: %w", other.Address, err)
+	}
+
+	return nil
+}
+
 // https://github.com/hashicorp/nomad/blob/fb085186b7874e7d7e008c83e0b443526fb2002e/api/api.go#L273-L286
 func defaultHttpClient() *http.Client {
 	httpClient := cleanhttp.DefaultPooledClient()
@@ -0,0 +1,426 @@
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/bloominlabs/baseplate-go/config"
+)
+
+// VariablesSource is a config.RemoteSource reading the configuration from a
+// Nomad Variable. By default every item of the variable sets the
+// configuration value at the path given by its key, e.g. an item
+// database.password sets password in the [database] table. Items are
+// converted to the type of the field they set, e.g. server.port=8080 for an
+// int field, see config.StringSource. WithFieldMapping
+// maps item keys onto paths explicitly, and WithDocumentItem reads a whole
+// configuration file stored in a single item instead.
+//
+// The variable is watched with blocking queries. When Nomad cannot be
+// reached, the last variable that was read successfully is used.
+type VariablesSource struct {
+	config    *NomadConfig
+	path      string
+	namespace string
+	logger    *slog.Logger
+
+	documentItem string
+	fields       map[string]string
+
+	waitTime     time.Duration
+	fetchTimeout time.Duration
+	minBackoff   time.Duration
+	maxBackoff   time.Duration
+
+	mu        sync.Mutex
+	last      *api.Variable
+	lastIndex uint64
+}
+
+type VariablesSourceOption func(*VariablesSource)
+
+// WithNamespace reads the variable from namespace instead of the namespace
+// of the client.
+func WithNamespace(namespace string) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.namespace = namespace
+	}
+}
+
+// WithLogger sets the logger reporting Nomad errors. Defaults to
+// slog.Default().
+func WithLogger(logger *slog.Logger) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.logger = logger
+	}
+}
+
+// WithFieldMapping maps item keys onto configuration paths, e.g.
+// {"db_password": "database.password"}. Items that are not in fields are
+// ignored.
+func WithFieldMapping(fields map[string]string) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.fields = fields
+	}
+}
+
+// WithDocumentItem reads the configuration file stored in the item named
+// item, e.g. config.toml. Its format is detected from the item name.
+func WithDocumentItem(item string) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.documentItem = item
+	}
+}
+
+// WithWaitTime bounds how long a blocking query waits for a change. Defaults
+// to 5 minutes.
+func WithWaitTime(d time.Duration) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.waitTime = d
+	}
+}
+
+// WithFetchTimeout bounds how long reading the variable may take, so an
+// unreachable Nomad agent cannot stall a reload. Blocking queries are given
+// the same time on top of their wait time. Defaults to 10 seconds.
+func WithFetchTimeout(d time.Duration) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.fetchTimeout = d
+	}
+}
+
+// WithRetryBackoff sets the minimum and maximum delay between attempts to
+// watch the variable while Nomad is failing. Defaults to 1 second and 1
+// minute.
+func WithRetryBackoff(min, max time.Duration) VariablesSourceOption {
+	return func(s *VariablesSource) {
+		s.minBackoff = min
+		s.maxBackoff = max
+	}
+}
+
+// NewVariablesSource returns a source reading the variable at path with the
+// client of c.
+func NewVariablesSource(c *NomadConfig, path string, opts ...VariablesSourceOption) *VariablesSource {
+	s := &VariablesSource{
+		config:       c,
+		path:         path,
+		logger:       slog.Default(),
+		waitTime:     5 * time.Minute,
+		fetchTimeout: 10 * time.Second,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Minute,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// ConfigVariableFlag is the parameter WithVariablesSource reads the Nomad
+// Variable path from.
+const ConfigVariableFlag = "config.nomad-variable"
+
+// WithVariablesSource makes ParseConfiguration read the Nomad Variable given
+// by -config.nomad-variable on top of the config files, and reload the
+// configuration when it changes. Since the variable is read before the
+// command line is parsed, c is used as is: a nil c connects with the defaults
+// and the NOMAD_ADDR and NOMAD_TOKEN environment variables.
+func WithVariablesSource(c *NomadConfig, opts ...VariablesSourceOption) config.ParseOption {
+	if c == nil {
+		c = &NomadConfig{}
+		c.RegisterFlags(flag.NewFlagSet("nomad", flag.ContinueOnError), "")
+	}
+
+	return config.WithRemoteSourceFlag(
+		ConfigVariableFlag,
+		"Nomad Variable path to read the configuration from, e.g. nomad/jobs/api. Changes to it are watched.",
+		func(path string) (config.RemoteSource, error) {
+			return NewVariablesSource(c, path, opts...), nil
+		},
+	)
+}
+
+func (s *VariablesSource) Name() string {
+	return "nomadvar://" + s.path
+}
+
+// Fetch reads the variable and renders it as a configuration document, or
+// renders the last variable read successfully when Nomad cannot be reached.
+func (s *VariablesSource) Fetch(ctx context.Context) ([]byte, config.Format, error) {
+	v, meta, err := s.read(ctx, 0)
+	if err != nil {
+		s.mu.Lock()
+		last := s.last
+		s.mu.Unlock()
+
+		var accessErr *VariableAccessError
+		if last == nil || errors.As(err, &accessErr) {
+			return nil, "", err
+		}
+
+		s.logger.Warn("failed to read nomad variable, using the last known configuration",
+			"path", s.path,
+			"error", err,
+		)
+		return s.render(last)
+	}
+
+	s.mu.Lock()
+	s.last = v
+	if meta.LastIndex > s.lastIndex {
+		s.lastIndex = meta.LastIndex
+	}
+	s.mu.Unlock()
+
+	return s.render(v)
+}
+
+// StringValues reports whether the items are rendered as the values of the
+// document, which are strings, rather than read as a configuration file, see
+// WithDocumentItem.
+func (s *VariablesSource) StringValues() bool {
+	return s.documentItem == ""
+}
+
+func (s *VariablesSource) render(v *api.Variable) ([]byte, config.Format, error) {
+	if s.documentItem != "" {
+		doc, ok := v.Items[s.documentItem]
+		if !ok {
+			return nil, "", fmt.Errorf("nomad variable %s has no item %q", s.path, s.documentItem)
+		}
+		return []byte(doc), config.FormatFromPath(s.documentItem), nil
+	}
+
+	keys := make([]string, 0, len(v.Items))
+	for key := range v.Items {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	doc := map[string]any{}
+	for _, key := range keys {
+		path := key
+		if s.fields != nil {
+			var ok bool
+			if path, ok = s.fields[key]; !ok {
+				continue
+			}
+		}
+
+		// an item cannot be both a value and the table of another item, e.g.
+		// database and database.password.
+		table := doc
+		parts := strings.Split(path, ".")
+		for i, part := range parts[:len(parts)-1] {
+			existing, ok := table[part]
+			if !ok {
+				existing = map[string]any{}
+				table[part] = existing
+			}
+			next, ok := existing.(map[string]any)
+			if !ok {
+				return nil, "", fmt.Errorf("nomad variable %s: item %q conflicts with another item setting %s", s.path, key, strings.Join(parts[:i+1], "."))
+			}
+			table = next
+		}
+		last := parts[len(parts)-1]
+		if _, ok := table[last]; ok {
+			return nil, "", fmt.Errorf("nomad variable %s: item %q conflicts with another item setting %s", s.path, key, path)
+		}
+		table[last] = v.Items[key]
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to render nomad variable %s: %w", s.path, err)
+	}
+
+	return out, config.FormatJSON, nil
+}
+
+// Watch signals changes to the variable until ctx is canceled. Errors are
+// logged and retried with an exponential backoff.
+func (s *VariablesSource) Watch(ctx context.Context) <-chan struct{} {
+	changed := make(chan struct{}, 1)
+
+	go func() {
+		defer close(changed)
+
+		s.mu.Lock()
+		index := s.lastIndex
+		s.mu.Unlock()
+
+		backoff := s.minBackoff
+		for {
+			v, meta, err := s.read(ctx, index)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				s.logger.Warn("failed to watch nomad variable, retrying",
+					"path", s.path,
+					"backoff", backoff,
+					"error", err,
+				)
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(backoff):
+				}
+				backoff *= 2
+				if backoff > s.maxBackoff {
+					backoff = s.maxBackoff
+				}
+				continue
+			}
+			backoff = s.minBackoff
+
+			// the index going backwards means nomad's state was reset, start
+			// over.
+			if meta.LastIndex < index {
+				index = 0
+				continue
+			}
+			if meta.LastIndex == index {
+				continue
+			}
+			index = meta.LastIndex
+
+			// the index also moves when the variable is written with the same
+			// items.
+			s.mu.Lock()
+			unchanged := v != nil && s.last != nil && sameItems(v.Items, s.last.Items)
+			s.mu.Unlock()
+			if unchanged {
+				continue
+			}
+
+			select {
+			case changed <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	return changed
+}
+
+func sameItems(a, b api.VariableItems) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for k, v := range a {
+		if w, ok := b[k]; !ok || v != w {
+			return false
+		}
+	}
+
+	return true
+}
+
+// VariableAccessError is returned when the token is not allowed to read a
+// Nomad Variable, or the variable does not exist.
+type VariableAccessError struct {
+	Path       string
+	Namespace  string
+	StatusCode int
+	Err        error
+}
+
+func (e *VariableAccessError) Error() string {
+	namespace := e.Namespace
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	switch e.StatusCode {
+	case http.StatusNotFound:
+		return fmt.Sprintf("nomad variable %s does not exist in namespace %s", e.Path, namespace)
+	default:
+		return fmt.Sprintf("permission denied reading nomad variable %s in namespace %s. check that the token's ACL policy grants read on the path: %s", e.Path, namespace, e.Err)
+	}
+}
+
+func (e *VariableAccessError) Unwrap() error {
+	return e.Err
+}
+
+func (s *VariablesSource) read(ctx context.Context, index uint64) (*api.Variable, *api.QueryMeta, error) {
+	client, err := s.config.GetClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create nomad client: %w", err)
+	}
+
+	timeout := s.fetchTimeout
+	q := &api.QueryOptions{Namespace: s.namespace, WaitIndex: index}
+	if index > 0 {
+		q.WaitTime = s.waitTime
+		// nomad adds up to WaitTime/16 of jitter to blocking queries.
+		timeout += s.waitTime + s.waitTime/16
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	v, meta, err := client.Variables().Read(s.path, q.WithContext(ctx))
+	if err != nil {
+		if errors.Is(err, api.ErrVariablePathNotFound) {
+			return nil, nil, &VariableAccessError{Path: s.path, Namespace: s.namespace, StatusCode: http.StatusNotFound, Err: err}
+		}
+
+		var status interface{ StatusCode() int }
+		if errors.As(err, &status) && status.StatusCode() == http.StatusForbidden {
+			return nil, nil, &VariableAccessError{Path: s.path, Namespace: s.namespace, StatusCode: http.StatusForbidden, Err: err}
+		}
+
+		return nil, nil, fmt.Errorf("failed to read nomad variable %s: %w", s.path, err)
+	}
+
+	return v, meta, nil
+}
+
+// VariablesResolver is a config.SecretResolver for references to Nomad
+// Variable items, e.g. nomadvar://nomad/jobs/api#db_password. Register it
+// with config.WithSecretResolver("nomadvar", nomad.NewVariablesResolver(c)).
+type VariablesResolver struct {
+	config *NomadConfig
+}
+
+// NewVariablesResolver returns a resolver reading variables with the client
+// of c.
+func NewVariablesResolver(c *NomadConfig) *VariablesResolver {
+	return &VariablesResolver{config: c}
+}
+
+func (r *VariablesResolver) ResolveSecret(ctx context.Context, ref *url.URL) (string, error) {
+	if ref.Fragment == "" {
+		return "", fmt.Errorf("missing the item name, e.g. %s://%s%s#password", ref.Scheme, ref.Host, ref.Path)
+	}
+
+	s := NewVariablesSource(r.config, ref.Host+ref.Path, WithNamespace(ref.Query().Get("namespace")))
+	v, _, err := s.read(ctx, 0)
+	if err != nil {
+		return "", err
+	}
+
+	item, ok := v.Items[ref.Fragment]
+	if !ok {
+		return "", fmt.Errorf("nomad variable %s has no item %q", s.path, ref.Fragment)
+	}
+
+	return item, nil
+}
@@ -0,0 +1,275 @@
+package nomad
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/nomad/api"
+
+	"github.com/bloominlabs/baseplate-go/config"
+)
+
+func TestVariablesSourceRender(t *testing.T) {
+	v := &api.Variable{
+		Path: "nomad/jobs/api",
+		Items: api.VariableItems{
+			"database.password": "hunter2",
+			"region":            "us-east-1",
+			"db_user":           "api",
+		},
+	}
+
+	tests := []struct {
+		name   string
+		opts   []VariablesSourceOption
+		format config.Format
+		want   map[string]any
+	}{
+		{
+			name:   "item keys",
+			format: config.FormatJSON,
+			want: map[string]any{
+				"database": map[string]any{"password": "hunter2"},
+				"region":   "us-east-1",
+				"db_user":  "api",
+			},
+		},
+		{
+			name:   "field mapping",
+			opts:   []VariablesSourceOption{WithFieldMapping(map[string]string{"db_user": "database.username"})},
+			format: config.FormatJSON,
+			want: map[string]any{
+				"database": map[string]any{"username": "api"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out, format, err := NewVariablesSource(nil, v.Path, tt.opts...).render(v)
+			if err != nil {
+				t.Fatalf("render() error: %v", err)
+			}
+			if format != tt.format {
+				t.Errorf("format = %s, want %s", format, tt.format)
+			}
+
+			var got map[string]any
+			if err := json.Unmarshal(out, &got); err != nil {
+				t.Fatalf("Unmarshal() error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("render() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	v.Items["config.toml"] = "name = \"api\"\n"
+	out, format, err := NewVariablesSource(nil, v.Path, WithDocumentItem("config.toml")).render(v)
+	if err != nil || string(out) != "name = \"api\"\n" || format != config.FormatTOML {
+		t.Errorf("render() with a document item = %q %s %v", out, format, err)
+	}
+
+	if _, _, err := NewVariablesSource(nil, v.Path, WithDocumentItem("missing.toml")).render(v); err == nil {
+		t.Error("expected an error for a missing document item")
+	}
+}
+
+func TestVariablesSourceRenderConflicts(t *testing.T) {
+	tests := map[string]struct {
+		items api.VariableItems
+		opts  []VariablesSourceOption
+	}{
+		"value and nested item": {
+			items: api.VariableItems{"database": "postgres://db", "database.password": "hunter2"},
+		},
+		"mapped onto the same path": {
+			items: api.VariableItems{"db_password": "hunter2", "password": "hunter3"},
+			opts:  []VariablesSourceOption{WithFieldMapping(map[string]string{"db_password": "database.password", "password": "database.password"})},
+		},
+		"mapped onto a table": {
+			items: api.VariableItems{"db": "postgres://db", "db_password": "hunter2"},
+			opts:  []VariablesSourceOption{WithFieldMapping(map[string]string{"db": "database", "db_password": "database.password"})},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			v := &api.Variable{Path: "nomad/jobs/api", Items: tt.items}
+			_, _, err := NewVariablesSource(nil, v.Path, tt.opts...).render(v)
+			if err == nil || !strings.Contains(err.Error(), "conflicts with another item setting database") {
+				t.Errorf("render() error = %v, want a conflict", err)
+			}
+		})
+	}
+}
+
+type typedConfig struct {
+	Server struct {
+		Port    int           `toml:"port"`
+		Timeout time.Duration `toml:"timeout"`
+	} `toml:"server"`
+	TLS struct {
+		Enabled bool `toml:"enabled"`
+	} `toml:"tls"`
+	Region string `toml:"region"`
+}
+
+func (c *typedConfig) RegisterFlags(f *flag.FlagSet) {}
+
+func (c *typedConfig) Validate() error {
+	return nil
+}
+
+func (c *typedConfig) Merge(o config.WatchableConfiguration) error {
+	*c = *o.(*typedConfig)
+	return nil
+}
+
+func TestVariablesSourceConvertsItems(t *testing.T) {
+	vs := &variableServer{path: "nomad/jobs/api", items: map[string]string{
+		"server.port":    "8080",
+		"server.timeout": "30s",
+		"tls.enabled":    "true",
+		"region":         "1",
+	}, index: 1}
+	srv := httptest.NewServer(vs)
+	defer srv.Close()
+
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	p := config.NewParser(config.WithRemoteSources(NewVariablesSource(&NomadConfig{Address: srv.URL}, vs.path, WithLogger(testLogger()))))
+	p.Args = []string{}
+	p.FlagSet = fs
+	p.Logger = testLogger()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var cfg typedConfig
+	if err := p.Parse(ctx, &cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if cfg.Server.Port != 8080 || cfg.Server.Timeout != 30*time.Second || !cfg.TLS.Enabled || cfg.Region != "1" {
+		t.Errorf("parsed = %+v", cfg)
+	}
+}
+
+// variableServer is a stand-in for the Nomad Variables HTTP API serving a
+// single variable.
+type variableServer struct {
+	sync.Mutex
+	path  string
+	items map[string]string
+	index uint64
+}
+
+func (s *variableServer) set(items map[string]string) {
+	s.Lock()
+	defer s.Unlock()
+	s.items = items
+	s.index++
+}
+
+func (s *variableServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/var/"+s.path {
+		http.NotFound(w, r)
+		return
+	}
+
+	// emulate a blocking query that returns shortly.
+	if index, _ := strconv.ParseUint(r.URL.Query().Get("index"), 10, 64); index > 0 {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	s.Lock()
+	index, items := s.index, s.items
+	s.Unlock()
+
+	w.Header().Set("X-Nomad-Index", strconv.FormatUint(index, 10))
+	w.Header().Set("X-Nomad-LastContact", "0")
+	w.Header().Set("X-Nomad-KnownLeader", "true")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"Path":        s.path,
+		"Namespace":   "default",
+		"Items":       items,
+		"ModifyIndex": index,
+	})
+}
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func TestVariablesSourceWatchIgnoresUnchangedItems(t *testing.T) {
+	vs := &variableServer{path: "nomad/jobs/api", items: map[string]string{"region": "us-east-1"}, index: 1}
+	srv := httptest.NewServer(vs)
+	defer srv.Close()
+
+	s := NewVariablesSource(&NomadConfig{Address: srv.URL}, vs.path, WithLogger(testLogger()))
+	if _, _, err := s.Fetch(context.Background()); err != nil {
+		t.Fatalf("Fetch() error: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changed := s.Watch(ctx)
+
+	// rewriting the variable with the same items bumps the index only.
+	vs.set(map[string]string{"region": "us-east-1"})
+	select {
+	case <-changed:
+		t.Fatal("Watch() signaled a change for a variable written with the same items")
+	case <-time.After(200 * time.Millisecond):
+	}
+
+	vs.set(map[string]string{"region": "eu-west-1"})
+	select {
+	case <-changed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Watch() did not signal the changed items")
+	}
+}
+
+func TestVariablesSourceFetchTimeout(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	s := NewVariablesSource(&NomadConfig{Address: srv.URL}, "nomad/jobs/api", WithLogger(testLogger()), WithFetchTimeout(50*time.Millisecond))
+
+	start := time.Now()
+	if _, _, err := s.Fetch(context.Background()); err == nil {
+		t.Fatal("expected an error from an unresponsive agent")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Fetch() took %s, want it bounded by the fetch timeout", elapsed)
+	}
+}
+
+func TestVariableAccessError(t *testing.T) {
+	err := error(&VariableAccessError{Path: "nomad/jobs/api", StatusCode: http.StatusForbidden, Err: errors.New("Unexpected response code: 403 (Permission denied)")})
+	if !strings.Contains(err.Error(), "permission denied reading nomad variable nomad/jobs/api in namespace default") {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err = &VariableAccessError{Path: "nomad/jobs/api", Namespace: "prod", StatusCode: http.StatusNotFound, Err: api.ErrVariablePathNotFound}
+	if !errors.Is(err, api.ErrVariablePathNotFound) || !strings.Contains(err.Error(), "does not exist in namespace prod") {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
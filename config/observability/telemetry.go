@@ -64,18 +64,18 @@ type TelemetryConfig struct {
 }
 
 func (t *TelemetryConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&t.OTLPAddr, "otlp.addr", env.GetEnvStrDefault("OTLP_ADDR", "localhost:4317"), "hostname:port for OTLP.grpc protocol on remote OTLP receiver")
-	f.StringVar(&t.OTLPCAPath, "otlp.ca.path", env.GetEnvStrDefault("OTLP_CA_PATH", ""), "Path to certificate authority used to verify outgoing OTLP receiver connections")
-	f.StringVar(&t.OTLPCertPath, "otlp.cert.path", env.GetEnvStrDefault("OTLP_CERT_PATH", ""), "Path to certificate to encrypt outgoing OTLP receiver connections")
-	f.StringVar(&t.OTLPKeyPath, "otlp.key.path", env.GetEnvStrDefault("OTLP_KEY_PATH", ""), "Path to private key to encrypt outgoing OTLP receiver connections")
+	env.StringVar(f, &t.OTLPAddr, "otlp.addr", "OTLP_ADDR", "localhost:4317", "hostname:port for OTLP.grpc protocol on remote OTLP receiver")
+	env.StringVar(f, &t.OTLPCAPath, "otlp.ca.path", "OTLP_CA_PATH", "", "Path to certificate authority used to verify outgoing OTLP receiver connections")
+	env.StringVar(f, &t.OTLPCertPath, "otlp.cert.path", "OTLP_CERT_PATH", "", "Path to certificate to encrypt outgoing OTLP receiver connections")
+	env.StringVar(f, &t.OTLPKeyPath, "otlp.key.path", "OTLP_KEY_PATH", "", "Path to private key to encrypt outgoing OTLP receiver connections")
 
-	f.StringVar(&t.Pyroscope.URL, "pyroscope.url", env.GetEnvStrDefault("PYROSCOPE_URL", ""), "URL for uploading pyroscope traces")
-	f.StringVar(&t.Pyroscope.Token, "pyroscope.token", env.GetEnvStrDefault("PYROSCOPE_TOKEN", ""), "Token used for authenticated to pyroscope")
-	f.StringVar(&t.Pyroscope.User, "pyroscope.user", env.GetEnvStrDefault("PYROSCOPE_USER", ""), "User used for authenticated to pyroscope")
+	env.StringVar(f, &t.Pyroscope.URL, "pyroscope.url", "PYROSCOPE_URL", "", "URL for uploading pyroscope traces")
+	env.StringVar(f, &t.Pyroscope.Token, "pyroscope.token", "PYROSCOPE_TOKEN", "", "Token used for authenticated to pyroscope")
+	env.StringVar(f, &t.Pyroscope.User, "pyroscope.user", "PYROSCOPE_USER", "", "User used for authenticated to pyroscope")
 
-	f.StringVar(&t.ServiceName, "service-name", env.GetEnvStrDefault("SERVICE_NAME", ""), "Service name to use for telemetry")
+	env.StringVar(f, &t.ServiceName, "service-name", "SERVICE_NAME", "", "Service name to use for telemetry")
 
-	f.DurationVar(&t.MetricsCollectionInterval, "otlp.metrics_collection_interval", env.GetEnvDurDefault("METRICS_COLLECTION_INTERVAL", time.Minute), "Interval between metrics collections")
+	env.DurationVar(f, &t.MetricsCollectionInterval, "otlp.metrics_collection_interval", "METRICS_COLLECTION_INTERVAL", time.Minute, "Interval between metrics collections")
 
 	f.BoolVar(&t.Insecure, "otlp.insecure", false, "Emit OTLP without needing mTLS certificate")
 }
@@ -0,0 +1,591 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+// ErrExplained is returned by Parser.Parse after -config.explain printed the
+// provenance table, or -help.env the environment variables. ParseConfiguration
+// exits the process instead.
+var ErrExplained = errors.New("configuration explained")
+
+// FileSystem is the file system configuration files are read from. Paths are
+// absolute operating system paths.
+type FileSystem interface {
+	Stat(name string) (fs.FileInfo, error)
+	ReadDir(name string) ([]fs.DirEntry, error)
+	ReadFile(name string) ([]byte, error)
+}
+
+// OSFileSystem is the FileSystem backed by the os package.
+type OSFileSystem struct{}
+
+func (OSFileSystem) Stat(name string) (fs.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OSFileSystem) ReadDir(name string) ([]fs.DirEntry, error) {
+	return os.ReadDir(name)
+}
+
+func (OSFileSystem) ReadFile(name string) ([]byte, error) {
+	return os.ReadFile(name)
+}
+
+// Clock tells the Parser the current time.
+type Clock interface {
+	Now() time.Time
+}
+
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// Parser loads a configuration from command line arguments, environment
+// variables and config files, and reloads it when the files change. Every
+// dependency is explicit so a Parser can be used more than once per process
+// and in tests. The zero value uses the same globals as ParseConfiguration.
+type Parser struct {
+	// Args are the command line arguments, without the program name.
+	// Defaults to os.Args[1:].
+	Args []string
+	// FlagSet the configuration flags are registered on. Defaults to
+	// flag.CommandLine.
+	FlagSet *flag.FlagSet
+	// Logger reports reloads and their failures. Defaults to slog.Default().
+	Logger *slog.Logger
+	// FileSystem config files are read from. Defaults to OSFileSystem.
+	FileSystem FileSystem
+	// Clock used to time reloads. Defaults to the system clock.
+	Clock Clock
+	// NewWatcher creates the watcher notifying the Parser of changes to the
+	// config files. Defaults to a filesystem.NewRateLimitedFileWatcher
+	// coalescing events over 5 seconds, which detects changes by
+	// modification time. To only reload on changes to the content of the
+	// files, pass filesystem.WithChangeDetection to a watcher of your own:
+	//
+	//	p.NewWatcher = func(paths []string) (filesystem.Watcher, error) {
+	//		return filesystem.NewRateLimitedFileWatcher(paths, logger, 5*time.Second,
+	//			filesystem.WithChangeDetection(filesystem.DetectContentPrecheck))
+	//	}
+	NewWatcher func(paths []string) (filesystem.Watcher, error)
+	// Output -config.explain and -help.env print to. Defaults to os.Stdout.
+	Output io.Writer
+	// MeterProvider reload metrics are reported to. Defaults to
+	// otel.GetMeterProvider().
+	MeterProvider metric.MeterProvider
+
+	provenance    *Provenance
+	decodeOptions []DecodeOption
+	reloadSignals []os.Signal
+	reloadHooks   []func(ReloadEvent)
+	sources       []RemoteSource
+	sourceFlags   []sourceFlag
+	status        *ReloadStatus
+	envPrefixes   []string
+}
+
+// ParseOption configures the behavior of ParseConfiguration and Parser.
+type ParseOption func(*Parser)
+
+// WithProvenance records where every effective configuration value came from
+// into p once the configuration has been parsed.
+func WithProvenance(p *Provenance) ParseOption {
+	return func(o *Parser) {
+		o.provenance = p
+	}
+}
+
+// WithDecodeOptions passes opts to every decode of the configuration files,
+// including the ones done on reload, e.g. to register a SecretResolver.
+func WithDecodeOptions(opts ...DecodeOption) ParseOption {
+	return func(o *Parser) {
+		o.decodeOptions = append(o.decodeOptions, opts...)
+	}
+}
+
+// NewParser returns a Parser configured with opts. Its exported fields may be
+// set afterwards.
+func NewParser(opts ...ParseOption) *Parser {
+	p := &Parser{}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+func (p *Parser) args() []string {
+	if p.Args == nil {
+		return os.Args[1:]
+	}
+
+	return p.Args
+}
+
+func (p *Parser) flagSet() *flag.FlagSet {
+	if p.FlagSet == nil {
+		return flag.CommandLine
+	}
+
+	return p.FlagSet
+}
+
+func (p *Parser) logger() *slog.Logger {
+	if p.Logger == nil {
+		return slog.Default()
+	}
+
+	return p.Logger
+}
+
+func (p *Parser) fileSystem() FileSystem {
+	if p.FileSystem == nil {
+		return OSFileSystem{}
+	}
+
+	return p.FileSystem
+}
+
+func (p *Parser) clock() Clock {
+	if p.Clock == nil {
+		return systemClock{}
+	}
+
+	return p.Clock
+}
+
+func (p *Parser) newWatcher(paths []string) (filesystem.Watcher, error) {
+	if p.NewWatcher == nil {
+		// NewRateLimitedFileWatcher still requires zerolog.Logger — pass Nop
+		// until the filesystem package is migrated.
+		return filesystem.NewRateLimitedFileWatcher(paths, zerolog.Nop(), time.Second*5)
+	}
+
+	return p.NewWatcher(paths)
+}
+
+func (p *Parser) output() io.Writer {
+	if p.Output == nil {
+		return os.Stdout
+	}
+
+	return p.Output
+}
+
+func (p *Parser) meterProvider() metric.MeterProvider {
+	if p.MeterProvider == nil {
+		return otel.GetMeterProvider()
+	}
+
+	return p.MeterProvider
+}
+
+// Parse parses the configuration into cfg and watches the config files for
+// changes until ctx is canceled. It behaves like ParseConfiguration, except
+// that it returns ErrExplained instead of exiting after -config.explain or
+// -help.env.
+func (p *Parser) Parse(ctx context.Context, cfg WatchableConfiguration, createCfg func() WatchableConfiguration) error {
+	if createCfg == nil {
+		if _, ok := newLike(cfg).(WatchableConfiguration); !ok {
+			return fmt.Errorf("createCfg is required when %T is not a pointer", cfg)
+		}
+		createCfg = func() WatchableConfiguration {
+			return newLike(cfg).(WatchableConfiguration)
+		}
+	}
+
+	l, err := p.load(ctx, cfg)
+	if err != nil {
+		return err
+	}
+	l.current = func() any { return cfg }
+
+	return p.watch(ctx, l, func(files []string) (decodeResult, error) {
+		newConfig := createCfg()
+		decoded, err := reloadConfiguration(newConfig, p.flagSet(), files, l.args, l.opts)
+		if err != nil {
+			return decoded, failedAt(ReloadStageDecode, fmt.Errorf("failed to decode updated config file: %w", err))
+		}
+
+		if err := newConfig.Validate(); err != nil {
+			return decoded, failedAt(ReloadStageValidate, fmt.Errorf("updated config failed validation: %w", err))
+		}
+
+		if err := preflight(ctx, cfg, newConfig); err != nil {
+			return decoded, failedAt(ReloadStagePreflight, err)
+		}
+
+		if err := mergeWithRollback(cfg, newConfig); err != nil {
+			var rollback *RollbackError
+			if errors.As(err, &rollback) {
+				if rollback.RestoreErr != nil {
+					p.logger().Error("failed to roll back configuration after a failed merge, the configuration may be inconsistent",
+						"merge_error", rollback.Err,
+						"rollback_error", rollback.RestoreErr,
+					)
+				} else {
+					p.logger().Warn("rolled back configuration after a failed merge",
+						"error", rollback.Err,
+					)
+				}
+			}
+			return decoded, failedAt(ReloadStageMerge, err)
+		}
+
+		return decoded, nil
+	})
+}
+
+// loaded is the state of an initial parse that reloads build upon.
+type loaded struct {
+	// args are the original arguments, applied again on top of the updated
+	// files on every reload.
+	args    []string
+	paths   []string
+	files   []string
+	opts    decodeOptions
+	decoded decodeResult
+	// current returns the configuration in effect.
+	current func() any
+	status  *ReloadStatus
+	metrics *reloadMetrics
+}
+
+// load does the initial parse of cfg.
+func (p *Parser) load(ctx context.Context, cfg Configuration) (*loaded, error) {
+	l := &loaded{args: append([]string{}, p.args()...)}
+
+	var err error
+	l.paths = ParseConfigFileParameters(l.args)
+	l.files, err = expandConfigFiles(p.fileSystem(), l.paths)
+	if err != nil {
+		return nil, err
+	}
+
+	format, err := ParseFormat(ParseConfigFormatParameter(l.args))
+	if err != nil {
+		return nil, err
+	}
+
+	l.opts = decodeOptions{ctx: ctx, fs: p.FileSystem, logger: p.logger()}
+	for _, opt := range p.decodeOptions {
+		opt(&l.opts)
+	}
+	if format != "" {
+		l.opts.format = format
+	}
+	l.opts.sources, err = p.parseSources(l.args)
+	if err != nil {
+		return nil, err
+	}
+
+	if files := ParseEnvFileParameters(l.args); len(files) > 0 {
+		if err := env.LoadFiles(files...); err != nil {
+			return nil, err
+		}
+	}
+
+	// This sets default values from flags to the config.
+	// It needs to be called before parsing the config file!
+	fset := p.flagSet()
+	cfg.RegisterFlags(fset)
+	if err := envError(); err != nil {
+		return nil, fmt.Errorf("failed to read configuration from the environment: %w", err)
+	}
+	if len(l.files) > 0 || len(l.opts.sources) > 0 {
+		l.decoded, err = decodeFiles(l.files, cfg, l.opts)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read configuration: %w", err)
+		}
+	}
+
+	registerParameterFlags(fset)
+	p.registerSourceFlags(fset)
+	if err := fset.Parse(l.args); err != nil {
+		return nil, err
+	}
+
+	explain := ParseConfigExplainParameter(l.args)
+	if explain || p.provenance != nil {
+		prov := buildProvenance(cfg, fset, l.decoded.docs)
+		if p.provenance != nil {
+			*p.provenance = *prov
+		}
+
+		if explain {
+			if err := prov.WriteTable(p.output()); err != nil {
+				return nil, fmt.Errorf("failed to print configuration provenance: %w", err)
+			}
+			return nil, ErrExplained
+		}
+	}
+
+	if ParseEnvHelpParameter(l.args) {
+		if err := writeEnvTable(p.output(), envVariables(cfg, fset)); err != nil {
+			return nil, fmt.Errorf("failed to print environment variables: %w", err)
+		}
+		return nil, ErrExplained
+	}
+
+	logger := p.logger()
+	p.warnUnusedEnv(logger)
+	if logger.Enabled(ctx, slog.LevelDebug) {
+		if out, err := Dump(cfg); err == nil {
+			logger.Debug("loaded configuration",
+				"config", string(out),
+			)
+		}
+	}
+
+	l.status = p.status
+	if l.status == nil {
+		l.status = &ReloadStatus{}
+	}
+	l.status.loaded(p.clock().Now(), configHash(cfg))
+
+	l.metrics, err = p.registerMetrics(ctx, l.status)
+	if err != nil {
+		logger.Warn("failed to register configuration reload metrics",
+			"error", err,
+		)
+	}
+
+	return l, nil
+}
+
+// ReloadTrigger is what caused a reload.
+type ReloadTrigger string
+
+const (
+	// ReloadTriggerFile is a change to a config file or a secret file.
+	ReloadTriggerFile ReloadTrigger = "file"
+	// ReloadTriggerSignal is one of the signals given to WithReloadOnSignal.
+	ReloadTriggerSignal ReloadTrigger = "signal"
+	// ReloadTriggerSource is a change to a RemoteSource.
+	ReloadTriggerSource ReloadTrigger = "source"
+)
+
+// ReloadEvent describes the outcome of a reload, see WithReloadHook.
+type ReloadEvent struct {
+	Trigger ReloadTrigger
+	// Signal is the signal received when Trigger is ReloadTriggerSignal.
+	Signal os.Signal
+	// Source is the name of the source that changed when Trigger is
+	// ReloadTriggerSource.
+	Source string
+	// Files are the config files the reload decoded.
+	Files    []string
+	Duration time.Duration
+	// Err is nil when the new configuration was applied.
+	Err error
+	// Stage is the step that failed when Err is set.
+	Stage ReloadStage
+	// Hash identifies the configuration in effect after a successful
+	// reload, see ReloadState.
+	Hash string
+}
+
+// WithReloadOnSignal reloads the configuration when the process receives one
+// of sigs, syscall.SIGHUP when none is given, exactly like a config file
+// change does. This is what orchestrators such as Nomad's
+// change_mode = "signal" expect.
+func WithReloadOnSignal(sigs ...os.Signal) ParseOption {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+
+	return func(o *Parser) {
+		o.reloadSignals = append(o.reloadSignals, sigs...)
+	}
+}
+
+// WithReloadHook calls fn after every reload, successful or not, e.g. to emit
+// a metric. fn is called from the reload goroutine and should not block.
+func WithReloadHook(fn func(ReloadEvent)) ParseOption {
+	return func(o *Parser) {
+		o.reloadHooks = append(o.reloadHooks, fn)
+	}
+}
+
+// watch starts a goroutine calling reload with the updated list of config
+// files whenever one of them or a RemoteSource changes, or a reload signal is
+// received, until ctx is canceled. Nothing is started when there is nothing
+// to watch.
+func (p *Parser) watch(ctx context.Context, l *loaded, reload func(files []string) (decodeResult, error)) error {
+	if len(l.paths) == 0 && len(p.reloadSignals) == 0 && len(l.opts.sources) == 0 {
+		return nil
+	}
+
+	// watch the directories themselves as well so fragments added to a
+	// conf.d/ directory trigger a reload, and the files secrets are read
+	// from so rotating them does too.
+	var (
+		w         filesystem.Watcher
+		events    chan *filesystem.FileWatcherEvent
+		watched   []string
+		isWatched = map[string]bool{}
+	)
+	if len(l.paths) > 0 {
+		watched = watchedPaths(p.fileSystem(), l.paths, l.files)
+		watched = append(watched, l.decoded.secretFiles...)
+		for _, path := range watched {
+			isWatched[path] = true
+		}
+
+		var err error
+		w, err = p.newWatcher(watched)
+		if err != nil {
+			return fmt.Errorf("failed to create file watcher for %s: %w", strings.Join(watched, ", "), err)
+		}
+
+		w.Start(ctx)
+		events = w.EventsCh()
+	}
+
+	var signals chan os.Signal
+	if len(p.reloadSignals) > 0 {
+		signals = make(chan os.Signal, 1)
+		signal.Notify(signals, p.reloadSignals...)
+	}
+
+	var sourceChanged chan RemoteSource
+	if len(l.opts.sources) > 0 {
+		sourceChanged = make(chan RemoteSource)
+		for _, source := range l.opts.sources {
+			go func(source RemoteSource) {
+				for range source.Watch(ctx) {
+					select {
+					case sourceChanged <- source:
+					case <-ctx.Done():
+					}
+				}
+			}(source)
+		}
+	}
+
+	go func() {
+		logger := p.logger()
+		watchNew := func(paths []string) {
+			if w == nil {
+				return
+			}
+			for _, path := range paths {
+				if isWatched[path] {
+					continue
+				}
+				if err := w.Add(path); err != nil {
+					logger.Error("failed to watch config file",
+						"file", path,
+						"error", err,
+					)
+					continue
+				}
+				isWatched[path] = true
+				watched = append(watched, path)
+			}
+		}
+
+		run := func(event ReloadEvent) {
+			start := p.clock().Now()
+
+			var err error
+			event.Files, err = expandConfigFiles(p.fileSystem(), l.paths)
+			if err != nil {
+				err = failedAt(ReloadStageDecode, fmt.Errorf("failed to list updated config files: %w", err))
+			} else {
+				watchNew(event.Files)
+
+				var decoded decodeResult
+				decoded, err = reload(event.Files)
+				watchNew(decoded.secretFiles)
+			}
+
+			end := p.clock().Now()
+			event.Duration = end.Sub(start)
+			event.Err = err
+			if err != nil {
+				event.Stage = errorStage(err)
+				logger.Error("failed to reload configuration",
+					"trigger", event.Trigger,
+					"stage", event.Stage,
+					"files", event.Files,
+					"error", err,
+				)
+			} else {
+				if l.current != nil {
+					event.Hash = configHash(l.current())
+				}
+				logger.Info("config file reloaded successfully",
+					"trigger", event.Trigger,
+					"files", event.Files,
+					"duration", event.Duration,
+				)
+			}
+
+			l.status.reloaded(end, event)
+			if l.metrics != nil {
+				l.metrics.record(ctx, event)
+			}
+			for _, hook := range p.reloadHooks {
+				hook(event)
+			}
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				if signals != nil {
+					signal.Stop(signals)
+				}
+				if w == nil {
+					return
+				}
+				if err := w.Stop(); err != nil {
+					logger.Error("failed to stop file watcher",
+						"files", watched,
+						"error", err,
+					)
+				}
+				return
+			case event := <-events:
+				logger.Debug("config file changed, reloading",
+					"files", event.Filenames,
+				)
+				run(ReloadEvent{Trigger: ReloadTriggerFile})
+			case sig := <-signals:
+				logger.Debug("received signal, reloading",
+					"signal", sig.String(),
+				)
+				run(ReloadEvent{Trigger: ReloadTriggerSignal, Signal: sig})
+			case source := <-sourceChanged:
+				logger.Debug("configuration source changed, reloading",
+					"source", source.Name(),
+				)
+				run(ReloadEvent{Trigger: ReloadTriggerSource, Source: source.Name()})
+			}
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package config
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"io"
+	"io/fs"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+type parserConfig struct {
+	sync.RWMutex
+
+	Address string `toml:"address"`
+	Bucket  string `toml:"bucket"`
+
+	merged chan struct{}
+}
+
+func (c *parserConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Address, "parser.addr", "localhost:8080", "address")
+	f.StringVar(&c.Bucket, "parser.bucket", "", "bucket")
+}
+
+func (c *parserConfig) Validate() error {
+	return nil
+}
+
+func (c *parserConfig) Merge(o WatchableConfiguration) error {
+	newCfg := o.(*parserConfig)
+
+	c.Lock()
+	c.Address = newCfg.Address
+	c.Bucket = newCfg.Bucket
+	c.Unlock()
+
+	c.merged <- struct{}{}
+	return nil
+}
+
+// mapFS serves a fstest.MapFS under absolute paths.
+type mapFS struct {
+	sync.Mutex
+	files fstest.MapFS
+}
+
+func (m *mapFS) write(name, content string) {
+	m.Lock()
+	defer m.Unlock()
+	m.files[strings.TrimPrefix(name, "/")] = &fstest.MapFile{Data: []byte(content)}
+}
+
+func (m *mapFS) Stat(name string) (fs.FileInfo, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.files.Stat(strings.TrimPrefix(name, "/"))
+}
+
+func (m *mapFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.files.ReadDir(strings.TrimPrefix(name, "/"))
+}
+
+func (m *mapFS) ReadFile(name string) ([]byte, error) {
+	m.Lock()
+	defer m.Unlock()
+	return m.files.ReadFile(strings.TrimPrefix(name, "/"))
+}
+
+type fakeWatcher struct {
+	paths    []string
+	eventsCh chan *filesystem.FileWatcherEvent
+	stopped  chan struct{}
+}
+
+func (w *fakeWatcher) Start(context.Context) {}
+
+func (w *fakeWatcher) Stop() error {
+	close(w.stopped)
+	return nil
+}
+
+func (w *fakeWatcher) Add(filename string) error {
+	w.paths = append(w.paths, filename)
+	return nil
+}
+
+func (w *fakeWatcher) Remove(string) {}
+
+func (w *fakeWatcher) Replace(string, string) error {
+	return nil
+}
+
+func (w *fakeWatcher) EventsCh() chan *filesystem.FileWatcherEvent {
+	return w.eventsCh
+}
+
+type fixedClock struct{}
+
+func (fixedClock) Now() time.Time {
+	return time.Unix(0, 0)
+}
+
+func newTestParser(fsys FileSystem, args ...string) (*Parser, *fakeWatcher) {
+	w := &fakeWatcher{
+		eventsCh: make(chan *filesystem.FileWatcherEvent),
+		stopped:  make(chan struct{}),
+	}
+
+	fset := flag.NewFlagSet("test", flag.ContinueOnError)
+	fset.SetOutput(io.Discard)
+
+	return &Parser{
+		Args:       args,
+		FlagSet:    fset,
+		Logger:     slog.New(slog.NewTextHandler(io.Discard, nil)),
+		FileSystem: fsys,
+		Clock:      fixedClock{},
+		NewWatcher: func(paths []string) (filesystem.Watcher, error) {
+			w.paths = paths
+			return w, nil
+		},
+	}, w
+}
+
+func TestParserParse(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "address = \"file:8080\"\nbucket = \"from-file\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml", "-parser.bucket", "from-flag")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &parserConfig{merged: make(chan struct{})}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	if cfg.Address != "file:8080" || cfg.Bucket != "from-flag" {
+		t.Errorf("parsed = %s %s, want file:8080 from-flag", cfg.Address, cfg.Bucket)
+	}
+	if flag.CommandLine.Lookup("parser.addr") != nil {
+		t.Error("Parse registered flags on flag.CommandLine")
+	}
+	if len(w.paths) != 1 || w.paths[0] != "/etc/app/config.toml" {
+		t.Errorf("watched = %v", w.paths)
+	}
+
+	cancel()
+	select {
+	case <-w.stopped:
+	case <-time.After(time.Second):
+		t.Fatal("watcher was not stopped when ctx was canceled")
+	}
+}
+
+func TestParserReload(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/conf.d/00-base.toml", "address = \"file:8080\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/conf.d", "-parser.bucket", "from-flag")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &parserConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	fsys.write("/etc/app/conf.d/00-base.toml", "address = \"updated:8080\"\n")
+	fsys.write("/etc/app/conf.d/10-override.toml", "bucket = \"from-file\"\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/conf.d"}}
+
+	select {
+	case <-cfg.merged:
+	case <-time.After(time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+
+	cfg.RLock()
+	if cfg.Address != "updated:8080" || cfg.Bucket != "from-flag" {
+		t.Errorf("reloaded = %s %s, want updated:8080 from-flag", cfg.Address, cfg.Bucket)
+	}
+	cfg.RUnlock()
+
+	// an update that fails to decode is not merged.
+	fsys.write("/etc/app/conf.d/00-base.toml", "unknown = true\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/conf.d/00-base.toml"}}
+
+	select {
+	case <-cfg.merged:
+		t.Fatal("an invalid configuration was merged")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestParserExplain(t *testing.T) {
+	var out bytes.Buffer
+	p, _ := newTestParser(nil, "-config.explain", "-parser.addr", "flag:8080")
+	p.Output = &out
+
+	cfg := &parserConfig{}
+	if err := p.Parse(context.Background(), cfg, nil); !errors.Is(err, ErrExplained) {
+		t.Fatalf("Parse() error = %v, want ErrExplained", err)
+	}
+	if !strings.Contains(out.String(), "flag:8080") {
+		t.Errorf("explain output missing the flag value:\n%s", out.String())
+	}
+}
+
+func TestParserReloadOnSignal(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "address = \"file:8080\"\n")
+
+	p, _ := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadOnSignal()(p)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &parserConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	fsys.write("/etc/app/config.toml", "address = \"signal:8080\"\n")
+	proc, err := os.FindProcess(os.Getpid())
+	if err != nil {
+		t.Fatalf("FindProcess() error: %v", err)
+	}
+	if err := proc.Signal(syscall.SIGHUP); err != nil {
+		t.Fatalf("Signal() error: %v", err)
+	}
+
+	select {
+	case e := <-events:
+		if e.Trigger != ReloadTriggerSignal || e.Signal != syscall.SIGHUP || e.Err != nil {
+			t.Errorf("event = %+v", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+
+	cfg.RLock()
+	defer cfg.RUnlock()
+	if cfg.Address != "signal:8080" {
+		t.Errorf("Address = %q, want signal:8080", cfg.Address)
+	}
+}
+
+func TestParserReloadHookReportsFailures(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "address = \"file:8080\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &parserConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	fsys.write("/etc/app/config.toml", "unknown = true\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case e := <-events:
+		if e.Trigger != ReloadTriggerFile || e.Err == nil {
+			t.Errorf("event = %+v, want a failed file reload", e)
+		}
+		if len(e.Files) != 1 || e.Files[0] != "/etc/app/config.toml" {
+			t.Errorf("Files = %v", e.Files)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload hook was not called")
+	}
+}
+
+func TestParserEnvFileErrors(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "bucket = \"from-file\"\n")
+
+	t.Setenv("TEST_RELOAD_REGION", "us-west-2")
+	setenvFile(t, "TEST_RELOAD_REGION", "/run/secrets/region")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	p, _ := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	if _, err := ParseValue[*reloadConfig](ctx, p, nil); err == nil || !strings.Contains(err.Error(), "both TEST_RELOAD_REGION and TEST_RELOAD_REGION_FILE are set") {
+		t.Fatalf("ParseValue() error = %v, want the conflict", err)
+	}
+
+	setenvFile(t, "TEST_RELOAD_REGION", "")
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	v, err := ParseValue[*reloadConfig](ctx, p, nil)
+	if err != nil {
+		t.Fatalf("ParseValue() error: %v", err)
+	}
+
+	t.Setenv("TEST_RELOAD_REGION", "")
+	setenvFile(t, "TEST_RELOAD_REGION", "/run/secrets/missing-region")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case e := <-events:
+		if e.Stage != ReloadStageDecode || e.Err == nil || !strings.Contains(e.Err.Error(), "failed to read TEST_RELOAD_REGION_FILE") {
+			t.Errorf("event = %+v, want a failed decode", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload hook was not called")
+	}
+	if got := v.Load().Region; got != "us-west-2" {
+		t.Errorf("Region = %q, want the previous region", got)
+	}
+}
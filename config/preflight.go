@@ -0,0 +1,134 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// Preflighter is an optional interface of the configurations given to
+// Parser.Parse and ParseValue. On reload, Preflight is called on the current
+// configuration with the decoded and validated one before it is merged or
+// stored, e.g. to check that new credentials work with a cheap authenticated
+// call, and the reload is rejected when it fails so a bad secret never
+// replaces a working one.
+//
+// Like Merge, the Preflight methods of reusable configurations such as
+// s3.S3Config take their own type rather than a WatchableConfiguration.
+// Composite configurations forward to them with PreflightFields, the same way
+// their Merge calls the children's Merge. Configurations without a Preflight
+// method have the Preflight methods of their fields called that way.
+type Preflighter interface {
+	Preflight(ctx context.Context, decoded WatchableConfiguration) error
+}
+
+// preflightTimeout bounds how long Preflight may block a reload.
+const preflightTimeout = 30 * time.Second
+
+// preflight calls the Preflight method of cfg, if it has one, with
+// newConfig. Other configurations, such as the plain Configurations of
+// ParseValue, have the Preflight methods of their fields called instead, see
+// PreflightFields.
+func preflight(ctx context.Context, cfg, newConfig any) error {
+	ctx, cancel := context.WithTimeout(ctx, preflightTimeout)
+	defer cancel()
+
+	var err error
+	p, ok := cfg.(Preflighter)
+	decoded, watchable := newConfig.(WatchableConfiguration)
+	switch v := reflect.ValueOf(cfg); {
+	case ok && watchable:
+		err = p.Preflight(ctx, decoded)
+	case v.Kind() == reflect.Ptr && v.Type() == reflect.TypeOf(newConfig) && v.Elem().Kind() == reflect.Struct:
+		err = PreflightFields(ctx, cfg, newConfig)
+	}
+	if err != nil {
+		return fmt.Errorf("updated config failed preflight checks: %w", err)
+	}
+
+	return nil
+}
+
+// PreflightFields calls the Preflight method of every field of cfg that has
+// one with the same field of decoded, and joins their errors. cfg and decoded
+// must be pointers to the same struct type. A field has a Preflight method
+// when it or its address has a method Preflight(context.Context, T) error
+// that T, the type of the address of the field, is assignable to, e.g.
+// S3Config.Preflight(ctx, *S3Config). Nested structs without one are
+// descended into. It is meant to implement Preflighter:
+//
+//	func (c *Config) Preflight(ctx context.Context, decoded config.WatchableConfiguration) error {
+//		return config.PreflightFields(ctx, c, decoded)
+//	}
+func PreflightFields(ctx context.Context, cfg, decoded any) error {
+	cv, dv := reflect.ValueOf(cfg), reflect.ValueOf(decoded)
+	if cv.Kind() != reflect.Ptr || cv.Type() != dv.Type() || cv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("cannot preflight %T with %T, expected pointers to the same struct", cfg, decoded)
+	}
+	if cv.IsNil() || dv.IsNil() {
+		return nil
+	}
+
+	return preflightStruct(ctx, cv.Elem(), dv.Elem(), nil)
+}
+
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
+func preflightStruct(ctx context.Context, c, d reflect.Value, path []string) error {
+	var errs []error
+	t := c.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, tagged := tomlName(sf)
+		if name == "-" {
+			continue
+		}
+		fieldPath := path
+		if !sf.Anonymous || tagged {
+			fieldPath = append(append([]string{}, path...), name)
+		}
+
+		cf, df := c.Field(i), d.Field(i)
+		if cf.Kind() != reflect.Ptr {
+			cf, df = cf.Addr(), df.Addr()
+		}
+		if cf.IsNil() || df.IsNil() {
+			continue
+		}
+
+		if m := cf.MethodByName("Preflight"); m.IsValid() && isPreflight(m.Type(), df.Type()) {
+			out := m.Call([]reflect.Value{reflect.ValueOf(ctx), df})
+			if err, _ := out[0].Interface().(error); err != nil && len(fieldPath) > 0 {
+				errs = append(errs, fmt.Errorf("%s: %w", strings.Join(fieldPath, "."), err))
+			} else if err != nil {
+				errs = append(errs, err)
+			}
+			continue
+		}
+
+		if isStruct(sf.Type) {
+			if err := preflightStruct(ctx, cf.Elem(), df.Elem(), fieldPath); err != nil {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// isPreflight reports whether m is the type of a Preflight method that
+// accepts a decoded value of type decoded.
+func isPreflight(m, decoded reflect.Type) bool {
+	return m.NumIn() == 2 && m.In(0) == contextType && decoded.AssignableTo(m.In(1)) &&
+		m.NumOut() == 1 && m.Out(0) == errorType
+}
@@ -0,0 +1,206 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+type preflightConfig struct {
+	Password string `toml:"password"`
+
+	merged chan struct{}
+}
+
+func (c *preflightConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Password, "preflight.password", "", "password")
+}
+
+func (c *preflightConfig) Validate() error {
+	return nil
+}
+
+func (c *preflightConfig) Preflight(ctx context.Context, o WatchableConfiguration) error {
+	if o.(*preflightConfig).Password != "correct" {
+		return errors.New("authentication failed")
+	}
+	return nil
+}
+
+func (c *preflightConfig) Merge(o WatchableConfiguration) error {
+	c.Password = o.(*preflightConfig).Password
+	c.merged <- struct{}{}
+	return nil
+}
+
+func TestParserPreflightRejectsReload(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "password = \"correct\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &preflightConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	fsys.write("/etc/app/config.toml", "password = \"wrong\"\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case e := <-events:
+		if e.Err == nil || e.Stage != ReloadStagePreflight {
+			t.Errorf("event = %+v, want a failed preflight", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload hook was not called")
+	}
+	select {
+	case <-cfg.merged:
+		t.Fatal("a configuration failing its preflight checks was merged")
+	default:
+	}
+	if cfg.Password != "correct" {
+		t.Errorf("Password = %q, want the previous password", cfg.Password)
+	}
+}
+
+func TestParseValuePreflightRejectsReload(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "password = \"correct\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v, err := ParseValue[*preflightConfig](ctx, p, nil)
+	if err != nil {
+		t.Fatalf("ParseValue() error: %v", err)
+	}
+
+	fsys.write("/etc/app/config.toml", "password = \"wrong\"\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case e := <-events:
+		if e.Err == nil || e.Stage != ReloadStagePreflight {
+			t.Errorf("event = %+v, want a failed preflight", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload hook was not called")
+	}
+	if got := v.Load().Password; got != "correct" {
+		t.Errorf("Password = %q, want the previous password", got)
+	}
+}
+
+type preflightChild struct {
+	Token string `toml:"token"`
+}
+
+func (c *preflightChild) Preflight(ctx context.Context, o *preflightChild) error {
+	if o.Token != "valid" {
+		return errors.New("token rejected")
+	}
+	return nil
+}
+
+type preflightComposite struct {
+	Primary  preflightChild  `toml:"primary"`
+	Optional *preflightChild `toml:"optional"`
+	Nested   struct {
+		Child preflightChild `toml:"child"`
+	} `toml:"nested"`
+}
+
+func TestPreflightFields(t *testing.T) {
+	cfg := &preflightComposite{}
+	decoded := &preflightComposite{
+		Primary:  preflightChild{Token: "valid"},
+		Optional: &preflightChild{Token: "valid"},
+	}
+	decoded.Nested.Child.Token = "valid"
+
+	if err := PreflightFields(context.Background(), cfg, decoded); err != nil {
+		t.Fatalf("PreflightFields() error: %v", err)
+	}
+
+	cfg.Optional = &preflightChild{}
+	decoded.Primary.Token = "revoked"
+	decoded.Optional.Token = "revoked"
+	decoded.Nested.Child.Token = "revoked"
+	err := PreflightFields(context.Background(), cfg, decoded)
+	for _, want := range []string{"primary: token rejected", "optional: token rejected", "nested.child: token rejected"} {
+		if err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("PreflightFields() error = %v, want %q", err, want)
+		}
+	}
+
+	if err := PreflightFields(context.Background(), cfg, &preflightConfig{}); err == nil {
+		t.Error("expected an error for mismatched types")
+	}
+}
+
+// plainPreflightConfig is a Configuration without Merge or Preflight, whose
+// field has its own preflight checks.
+type plainPreflightConfig struct {
+	Primary preflightChild `toml:"primary"`
+}
+
+func (c *plainPreflightConfig) RegisterFlags(f *flag.FlagSet) {}
+
+func (c *plainPreflightConfig) Validate() error {
+	return nil
+}
+
+func TestParseValuePreflightsFieldsOfPlainConfiguration(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "[primary]\ntoken = \"valid\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	events := make(chan ReloadEvent, 1)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v, err := ParseValue[*plainPreflightConfig](ctx, p, nil)
+	if err != nil {
+		t.Fatalf("ParseValue() error: %v", err)
+	}
+
+	fsys.write("/etc/app/config.toml", "[primary]\ntoken = \"revoked\"\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case e := <-events:
+		if e.Stage != ReloadStagePreflight || e.Err == nil || !strings.Contains(e.Err.Error(), "primary: token rejected") {
+			t.Errorf("event = %+v, want a failed preflight of the field", e)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("reload hook was not called")
+	}
+	if got := v.Load().Primary.Token; got != "valid" {
+		t.Errorf("Primary.Token = %q, want the previous token", got)
+	}
+}
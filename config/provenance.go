@@ -0,0 +1,240 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+const ConfigExplainFlag = "config.explain"
+
+// Source identifies where the effective value of a configuration field came
+// from.
+type Source string
+
+const (
+	// SourceDefault is the default registered by RegisterFlags, or the zero
+	// value for fields without a flag.
+	SourceDefault Source = "default"
+	// SourceEnv is an environment variable bound to the flag of the field,
+	// see env.Bind.
+	SourceEnv Source = "env"
+	// SourceFile is a configuration file.
+	SourceFile Source = "file"
+	// SourceFlag is a flag passed on the command line.
+	SourceFlag Source = "flag"
+)
+
+// FieldProvenance describes where the effective value of a single
+// configuration field came from.
+type FieldProvenance struct {
+	// Path is the toml key path of the field, e.g. server.tls.cert_path.
+	Path string
+	// Flag is the name of the flag bound to the field, if any.
+	Flag string
+	// Source is the layer that set the effective value.
+	Source Source
+	// Origin names the specific source: the environment variable, the
+	// configuration file or the flag that set the value.
+	Origin string
+	// Value is the effective value. It is redacted for secret fields.
+	Value string
+	// Secret is true when Value has been redacted.
+	Secret bool
+}
+
+// Provenance records where every effective configuration value came from.
+type Provenance struct {
+	Fields []FieldProvenance
+}
+
+// Lookup returns the provenance of the field with the given toml key path.
+func (p *Provenance) Lookup(path string) (FieldProvenance, bool) {
+	for _, f := range p.Fields {
+		if f.Path == path {
+			return f, true
+		}
+	}
+
+	return FieldProvenance{}, false
+}
+
+// WriteTable writes the provenance as an aligned table.
+func (p *Provenance) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "FIELD\tSOURCE\tORIGIN\tVALUE")
+	for _, f := range p.Fields {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", f.Path, f.Source, f.Origin, f.Value)
+	}
+
+	return tw.Flush()
+}
+
+// ParseConfigExplainParameter reports whether -config.explain was passed in
+// args.
+func ParseConfigExplainParameter(args []string) bool {
+	return parseBoolParameter(args, ConfigExplainFlag)
+}
+
+// parseBoolParameter reports whether the boolean flag name was passed in
+// args, before flag.Parse.
+func parseBoolParameter(args []string, name string) bool {
+	set := false
+	for _, arg := range args {
+		if arg == "--" {
+			break
+		}
+
+		trimmed := strings.TrimPrefix(strings.TrimPrefix(arg, "-"), "-")
+		if trimmed == arg {
+			continue
+		}
+
+		switch {
+		case trimmed == name:
+			set = true
+		case strings.HasPrefix(trimmed, name+"="):
+			// invalid values are left to flag.Parse to report.
+			set, _ = strconv.ParseBool(strings.TrimPrefix(trimmed, name+"="))
+		}
+	}
+
+	return set
+}
+
+// buildProvenance computes the provenance of every field of config. fs must
+// be the flag set config registered its flags on, after it was parsed, and
+// docs the configuration files decoded into config in order.
+func buildProvenance(config any, fs *flag.FlagSet, docs []document) *Provenance {
+	flagsByAddr := flagsByAddress(fs)
+
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		setFlags[f.Name] = true
+	})
+
+	var found []env.Lookup
+	for _, l := range env.Lookups() {
+		if l.Found && l.Value != "" {
+			found = append(found, l)
+		}
+	}
+
+	p := &Provenance{}
+	walkFields(config, func(f field) {
+		fp := FieldProvenance{
+			Path:   f.key(),
+			Source: SourceDefault,
+			Secret: isSecret(f),
+		}
+
+		fl := f.flag(flagsByAddr)
+		if fl != nil {
+			fp.Flag = fl.Name
+			fp.Origin = "-" + fl.Name
+			if key, ok := envOrigin(fl, found); ok {
+				fp.Source = SourceEnv
+				fp.Origin = key
+			}
+		}
+
+		for _, doc := range docs {
+			if doc.lookup(f.path) {
+				fp.Source = SourceFile
+				fp.Origin = doc.file
+			}
+		}
+
+		if fl != nil && setFlags[fl.Name] {
+			fp.Source = SourceFlag
+			fp.Origin = "-" + fl.Name
+		}
+
+		// the value is rendered like Dump does, so the secrets of structs in
+		// slices and maps and the passwords of URLs are redacted too.
+		if value, ok := dumpValue(f.value); ok {
+			fp.Value = fmt.Sprint(value)
+		}
+		if fp.Secret && fp.Value != "" {
+			fp.Value = redactedValue
+		}
+
+		p.Fields = append(p.Fields, fp)
+	})
+
+	return p
+}
+
+// flagsByAddress indexes the flags of fs by the address of the value they
+// write to.
+func flagsByAddress(fs *flag.FlagSet) map[uintptr]*flag.Flag {
+	flags := map[uintptr]*flag.Flag{}
+	fs.VisitAll(func(f *flag.Flag) {
+		// values registered by RegisterStructFlags know the field they write
+		// to, the flag package's own values are pointers to it.
+		if addr, ok := flagAddr(f.Value); ok {
+			flags[addr] = f
+			return
+		}
+
+		v := reflect.ValueOf(f.Value)
+		if v.Kind() == reflect.Ptr && !v.IsNil() {
+			flags[v.Pointer()] = f
+		}
+	})
+
+	return flags
+}
+
+// flag returns the flag writing to f, if any.
+func (f field) flag(flags map[uintptr]*flag.Flag) *flag.Flag {
+	if !f.value.CanAddr() {
+		return nil
+	}
+
+	return flags[f.value.UnsafeAddr()]
+}
+
+// envOrigin finds the environment variable that provided the default of fl,
+// among the variables bound to it with env.Bind, env.Describe or the env tag
+// of RegisterStructFlags. When several bound variables are set, e.g. a chain
+// of defaults, the one whose value is the default wins.
+func envOrigin(fl *flag.Flag, lookups []env.Lookup) (string, bool) {
+	var origin *env.Lookup
+	for i, l := range lookups {
+		if !containsString(l.Flags, fl.Name) {
+			continue
+		}
+		if origin == nil || (l.Value == fl.DefValue && origin.Value != fl.DefValue) {
+			origin = &lookups[i]
+		}
+	}
+	if origin == nil {
+		return "", false
+	}
+
+	switch {
+	case origin.File != "":
+		return origin.Key + env.FileSuffix, true
+	case origin.DotEnvFile != "":
+		return fmt.Sprintf("%s (%s)", origin.Key, origin.DotEnvFile), true
+	default:
+		return origin.Key, true
+	}
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
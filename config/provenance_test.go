@@ -0,0 +1,116 @@
+package config
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type provenanceConfig struct {
+	Address  string `toml:"address"`
+	Region   string `toml:"region"`
+	Token    string `toml:"token"`
+	Endpoint string `toml:"endpoint"`
+	Timeout  int    `toml:"timeout"`
+	Unbound  string `toml:"unbound"`
+	Server   string `toml:"server"`
+}
+
+func (c *provenanceConfig) RegisterFlags(f *flag.FlagSet) {
+	env.Bind("TEST_PROVENANCE_ADDR", "test.addr")
+	f.StringVar(&c.Address, "test.addr", env.GetEnvStrDefault("TEST_PROVENANCE_ADDR", "localhost:8080"), "address")
+	env.Bind("TEST_PROVENANCE_REGION", "test.region")
+	f.StringVar(&c.Region, "test.region", env.GetEnvStrDefault("TEST_PROVENANCE_REGION", "us-east-1"), "region")
+	env.Bind("TEST_PROVENANCE_TOKEN", "test.token")
+	f.StringVar(&c.Token, "test.token", env.GetEnvStrDefault("TEST_PROVENANCE_TOKEN", ""), "token")
+	// the variable does not end with the flag name, like the server's
+	// NOMAD_ADDR_<prefix>.
+	env.Bind("TEST_PROVENANCE_ADDR_api", "api.addr")
+	f.StringVar(&c.Server, "api.addr", env.GetEnvStrDefault("TEST_PROVENANCE_ADDR_api", ":8080"), "server address")
+	f.StringVar(&c.Endpoint, "test.endpoint", "", "endpoint")
+	f.IntVar(&c.Timeout, "test.timeout", 5, "timeout")
+}
+
+func TestBuildProvenance(t *testing.T) {
+	t.Setenv("TEST_PROVENANCE_REGION", "eu-west-1")
+	t.Setenv("TEST_PROVENANCE_TOKEN", "hunter2")
+	t.Setenv("TEST_PROVENANCE_ADDR_api", ":9090")
+	// an unrelated variable holding a default is not its origin.
+	t.Setenv("TEST_UNRELATED_ADDR", "localhost:8080")
+	env.GetEnvStrDefault("TEST_UNRELATED_ADDR", "")
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "endpoint = \"https://example.com\"\ntimeout = 10\n")
+
+	var cfg provenanceConfig
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	cfg.RegisterFlags(fs)
+
+	decoded, err := decodeFiles([]string{file}, &cfg, decodeOptions{})
+	if err != nil {
+		t.Fatalf("decodeFiles() error: %v", err)
+	}
+	if err := fs.Parse([]string{"-test.timeout", "30"}); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+
+	p := buildProvenance(&cfg, fs, decoded.docs)
+
+	tests := []struct {
+		path   string
+		source Source
+		origin string
+		value  string
+	}{
+		{"address", SourceDefault, "-test.addr", "localhost:8080"},
+		{"region", SourceEnv, "TEST_PROVENANCE_REGION", "eu-west-1"},
+		{"token", SourceEnv, "TEST_PROVENANCE_TOKEN", redactedValue},
+		{"endpoint", SourceFile, file, "https://example.com"},
+		{"timeout", SourceFlag, "-test.timeout", "30"},
+		{"unbound", SourceDefault, "", ""},
+		{"server", SourceEnv, "TEST_PROVENANCE_ADDR_api", ":9090"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, ok := p.Lookup(tt.path)
+			if !ok {
+				t.Fatalf("no provenance for %s", tt.path)
+			}
+			if got.Source != tt.source || got.Origin != tt.origin || got.Value != tt.value {
+				t.Errorf("Lookup(%s) = %+v, want source=%s origin=%s value=%s", tt.path, got, tt.source, tt.origin, tt.value)
+			}
+		})
+	}
+
+	var out bytes.Buffer
+	if err := p.WriteTable(&out); err != nil {
+		t.Fatalf("WriteTable() error: %v", err)
+	}
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("table leaked a secret:\n%s", out.String())
+	}
+}
+
+func TestParseConfigExplainParameter(t *testing.T) {
+	tests := []struct {
+		args []string
+		want bool
+	}{
+		{[]string{"-config.explain"}, true},
+		{[]string{"--config.explain=true"}, true},
+		{[]string{"-config.explain=false"}, false},
+		{[]string{"-config.explain=1"}, true},
+		{[]string{"-config.explain=t"}, true},
+		{[]string{"-config.explain=nope"}, false},
+		{[]string{"-other", "--", "-config.explain"}, false},
+		{nil, false},
+	}
+	for _, tt := range tests {
+		if got := ParseConfigExplainParameter(tt.args); got != tt.want {
+			t.Errorf("ParseConfigExplainParameter(%v) = %v, want %v", tt.args, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type reloadConfig struct {
+	Address string `toml:"address"`
+	Region  string `toml:"region"`
+	Bucket  string `toml:"bucket"`
+	Debug   bool   `toml:"debug"`
+}
+
+func (c *reloadConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Address, "reload.addr", "localhost:8080", "address")
+	env.Bind("TEST_RELOAD_REGION", "reload.region")
+	f.StringVar(&c.Region, "reload.region", env.GetEnvStrDefault("TEST_RELOAD_REGION", "us-east-1"), "region")
+	f.StringVar(&c.Bucket, "reload.bucket", "", "bucket")
+	f.BoolVar(&c.Debug, "reload.debug", false, "debug")
+}
+
+func (c *reloadConfig) Validate() error {
+	return nil
+}
+
+func TestReloadConfigurationPrecedence(t *testing.T) {
+	t.Setenv("TEST_RELOAD_REGION", "eu-west-1")
+
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "address = \"file:8080\"\nbucket = \"from-file\"\n")
+
+	before := flag.CommandLine
+	args := []string{"-config.file", file, "-reload.bucket", "from-flag", "-reload.debug"}
+
+	var cfg reloadConfig
+	if _, err := reloadConfiguration(&cfg, flag.CommandLine, []string{file}, args, decodeOptions{}); err != nil {
+		t.Fatalf("reloadConfiguration() error: %v", err)
+	}
+
+	want := reloadConfig{
+		Address: "file:8080",
+		Region:  "eu-west-1",
+		Bucket:  "from-flag",
+		Debug:   true,
+	}
+	if cfg != want {
+		t.Errorf("reloaded = %+v, want %+v", cfg, want)
+	}
+
+	if flag.CommandLine != before {
+		t.Error("reloadConfiguration replaced flag.CommandLine")
+	}
+}
+
+func TestReloadConfigurationIgnoresApplicationFlags(t *testing.T) {
+	name := "test-reload-app-flag"
+	if flag.CommandLine.Lookup(name) == nil {
+		flag.Bool(name, false, "an application flag registered outside of the configuration")
+	}
+
+	var cfg reloadConfig
+	args := []string{"-" + name, "-reload.addr", "flag:8080"}
+	if _, err := reloadConfiguration(&cfg, flag.CommandLine, nil, args, decodeOptions{}); err != nil {
+		t.Fatalf("reloadConfiguration() error: %v", err)
+	}
+	if cfg.Address != "flag:8080" {
+		t.Errorf("Address = %q, want flag:8080", cfg.Address)
+	}
+}
+
+func TestReloadConfigurationEnvFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", "bucket = \"from-file\"\n")
+	region := writeFile(t, dir, "region", "eu-west-1\n")
+
+	tests := []struct {
+		name, value, file, want string
+	}{
+		{"conflict", "us-west-2", region, "both TEST_RELOAD_REGION and TEST_RELOAD_REGION_FILE are set"},
+		{"unreadable", "", filepath.Join(dir, "missing"), "failed to read TEST_RELOAD_REGION_FILE"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TEST_RELOAD_REGION", tt.value)
+			setenvFile(t, "TEST_RELOAD_REGION", tt.file)
+
+			var cfg reloadConfig
+			_, err := reloadConfiguration(&cfg, flag.NewFlagSet("test", flag.ContinueOnError), []string{file}, nil, decodeOptions{})
+			var envErr *env.Error
+			if !errors.As(err, &envErr) || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("reloadConfiguration() error = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -13,6 +13,7 @@ import (
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/smithy-go"
 
 	"github.com/aws/aws-sdk-go-v2/feature/s3/transfermanager"
 	// "github.com/aws/smithy-go/metrics/smithyotelmetrics"
@@ -107,40 +108,52 @@ func (c *S3Config) RegisterFlags(f *flag.FlagSet, opts ...Option) {
 		c.prefix = "s3"
 	}
 	prefix, upperPrefix := CreatePrefix(c.prefix)
-	f.BoolVar(
+	env.BoolVar(
+		f,
 		&c.TLSSkipVerify,
 		fmt.Sprintf("%s.tls-skip-verify", prefix),
-		env.GetEnvBoolDefault(fmt.Sprintf("%s_TLS_SKIP_VERIFY", upperPrefix), false),
+		fmt.Sprintf("%s_TLS_SKIP_VERIFY", upperPrefix),
+		false,
 		"should the client skip TLS verification when making requests",
 	)
-	f.BoolVar(
+	env.BoolVar(
+		f,
 		&c.UsePathStyle,
 		fmt.Sprintf("%s.use-path-style", prefix),
-		env.GetEnvBoolDefault(fmt.Sprintf("%s_USE_PATH_STYLE", upperPrefix), false),
+		fmt.Sprintf("%s_USE_PATH_STYLE", upperPrefix),
+		false,
 		"use aws path style when making requests",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.Region,
 		fmt.Sprintf("%s.region", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_REGION", upperPrefix), "us-east-1"),
+		fmt.Sprintf("%s_REGION", upperPrefix),
+		"us-east-1",
 		"region to associate the client to",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.Endpoint,
 		fmt.Sprintf("%s.endpoint", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_ENDPOINT", upperPrefix), ""),
+		fmt.Sprintf("%s_ENDPOINT", upperPrefix),
+		"",
 		"base endpoint to use for requests",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.AccessKeyID,
 		fmt.Sprintf("%s.access-key-id", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_ACCESS_KEY_ID", upperPrefix), env.GetEnvStrDefault("AWS_ACCESS_KEY_ID", env.GetEnvStrDefault("SPACES_ACCESS_KEY_ID", ""))),
+		fmt.Sprintf("%s_ACCESS_KEY_ID,AWS_ACCESS_KEY_ID,SPACES_ACCESS_KEY_ID", upperPrefix),
+		"",
 		"S3 Access Key ID for authentication",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.SecretAccessKey,
 		fmt.Sprintf("%s.secret-access-key", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_SECRET_ACCESS_KEY", upperPrefix), env.GetEnvStrDefault("AWS_SECRET_ACCESS_KEY", env.GetEnvStrDefault("SPACES_SECRET_ACCESS_KEY", ""))),
+		fmt.Sprintf("%s_SECRET_ACCESS_KEY,AWS_SECRET_ACCESS_KEY,SPACES_SECRET_ACCESS_KEY", upperPrefix),
+		"",
 		"S3 Secret Access Key for authentication",
 	)
 	// see the struct for why this is commented out
@@ -180,6 +193,43 @@ func (c *S3Config) Merge(other *S3Config) error {
 	return nil
 }
 
+// Preflight checks that the credentials of other are accepted before Merge
+// swaps them in, by listing at most one bucket with a client built from the
+// values Merge would apply. Credentials that are valid but not allowed to list
+// buckets pass the check.
+func (c *S3Config) Preflight(ctx context.Context, other *S3Config) error {
+	c.RLock()
+	candidate := &S3Config{
+		Endpoint:        other.Endpoint,
+		Region:          c.Region,
+		AccessKeyID:     other.AccessKeyID,
+		SecretAccessKey: other.SecretAccessKey,
+		UsePathStyle:    c.UsePathStyle,
+		TLSSkipVerify:   c.TLSSkipVerify,
+	}
+	c.RUnlock()
+
+	client, err := candidate.CreateClient()
+	if err != nil {
+		return fmt.Errorf("failed to create s3 client: %w", err)
+	}
+
+	_, err = client.ListBuckets(ctx, &s3.ListBucketsInput{MaxBuckets: aws.Int32(1)})
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		switch apiErr.ErrorCode() {
+		case "InvalidAccessKeyId", "SignatureDoesNotMatch", "InvalidToken", "ExpiredToken":
+		default:
+			return nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("s3 rejected the access key %s: %w", candidate.AccessKeyID, err)
+	}
+
+	return nil
+}
+
 func (c *S3Config) Validate() error {
 	var validationErrors error
 	// c.prefix is not set inside the file watcher in ParseConfiguration which
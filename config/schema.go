@@ -0,0 +1,254 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+// SchemaDraft is the JSON Schema dialect GenerateSchema emits.
+const SchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema is a JSON Schema document describing a configuration file.
+type Schema struct {
+	Schema               string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	AdditionalProperties any                `json:"additionalProperties,omitempty"`
+	Deprecated           bool               `json:"deprecated,omitempty"`
+}
+
+// durationPattern matches the durations time.ParseDuration accepts.
+const durationPattern = `^(0|[-+]?([0-9]*(\.[0-9]*)?(ns|us|µs|μs|ms|s|m|h))+)$`
+
+// GenerateSchema returns the JSON Schema of the configuration files cfg can
+// decode, so editors can autocomplete them and CI can validate them before
+// they are rolled out. Like the decoder, the schema rejects unknown keys.
+//
+// cfg is only used for its type: its flags are registered on a throwaway
+// flag set, isolated from the environment with env.Isolate, to collect the
+// defaults and the flag usage strings, which become the descriptions. The
+// defaults are the ones of the code, not of the machine generating the
+// schema. Fields without a flag are described by their `usage`
+// tag. Fields tagged `required:"true"` are required, and the defaults of
+// secrets are left out. The config_version key of a Migrator and the
+// deprecated keys of KeyAliaser configurations are accepted too.
+func GenerateSchema(cfg Configuration) (*Schema, error) {
+	fresh, ok := newLike(cfg).(Configuration)
+	if !ok {
+		return nil, fmt.Errorf("%T does not implement Configuration through a pointer", cfg)
+	}
+
+	fs := flag.NewFlagSet("schema", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	defer env.Isolate(fs)()
+	fresh.RegisterFlags(fs)
+
+	flags := flagsByAddress(fs)
+	leaves := map[string]field{}
+	walkFields(fresh, func(f field) {
+		leaves[f.key()] = f
+	})
+
+	t := reflect.TypeOf(fresh).Elem()
+	g := schemaGenerator{flags: flags, leaves: leaves}
+	s := g.object(t, nil)
+	s.Schema = SchemaDraft
+	s.Title = t.Name()
+
+	if m, ok := fresh.(Migrator); ok {
+		latest := 0
+		for _, migration := range m.Migrations() {
+			if migration.Version > latest {
+				latest = migration.Version
+			}
+		}
+		s.Properties[ConfigVersionKey] = &Schema{
+			Type:        "integer",
+			Description: fmt.Sprintf("version of the format of the file, the latest is %d", latest),
+		}
+	}
+
+	aliases := map[string]string{}
+	collectAliases(t, nil, aliases, map[reflect.Type]bool{})
+	for old, replacement := range aliases {
+		addAlias(s, strings.Split(old, "."), replacement)
+	}
+
+	return s, nil
+}
+
+// addAlias adds the deprecated key path old of the object s, accepting the
+// same values as its replacement, the dotted path of another key of s.
+func addAlias(s *Schema, old []string, replacement string) {
+	target := s
+	for _, part := range strings.Split(replacement, ".") {
+		if target = target.Properties[part]; target == nil {
+			return
+		}
+	}
+
+	table := s
+	for _, part := range old[:len(old)-1] {
+		next := table.Properties[part]
+		if next == nil {
+			next = &Schema{Type: "object", Properties: map[string]*Schema{}, AdditionalProperties: false}
+			table.Properties[part] = next
+		}
+		if next.Properties == nil {
+			return
+		}
+		table = next
+	}
+
+	alias := *target
+	alias.Deprecated = true
+	alias.Description = "deprecated, use " + replacement
+	table.Properties[old[len(old)-1]] = &alias
+}
+
+type schemaGenerator struct {
+	flags  map[uintptr]*flag.Flag
+	leaves map[string]field
+}
+
+// object returns the schema of the struct type t found at path.
+func (g schemaGenerator) object(t reflect.Type, path []string) *Schema {
+	s := &Schema{
+		Type:                 "object",
+		Properties:           map[string]*Schema{},
+		AdditionalProperties: false,
+	}
+	g.properties(s, t, path)
+
+	return s
+}
+
+func (g schemaGenerator) properties(s *Schema, t reflect.Type, path []string) {
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+
+		name, tagged := tomlName(sf)
+		if name == "-" {
+			continue
+		}
+
+		ft := sf.Type
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		if sf.Anonymous && !tagged && isStruct(ft) {
+			g.properties(s, ft, path)
+			continue
+		}
+
+		fieldPath := append(append([]string{}, path...), name)
+		var prop *Schema
+		if isStruct(ft) {
+			prop = g.object(ft, fieldPath)
+		} else {
+			prop = g.value(ft)
+			g.describe(prop, fieldPath)
+		}
+		if usage := sf.Tag.Get("usage"); usage != "" && prop.Description == "" {
+			prop.Description = usage
+		}
+
+		if required, _ := strconv.ParseBool(sf.Tag.Get("required")); required {
+			s.Required = append(s.Required, name)
+		}
+		s.Properties[name] = prop
+	}
+}
+
+// describe sets the description and default of a leaf field from the flag
+// registered for it.
+func (g schemaGenerator) describe(s *Schema, path []string) {
+	f, ok := g.leaves[field{path: path}.key()]
+	if !ok {
+		return
+	}
+
+	if fl := f.flag(g.flags); fl != nil {
+		s.Description = fl.Usage
+	}
+	if e, ok := f.value.Interface().(Enum); ok {
+		s.Enum = e.Allowed()
+	}
+
+	if isSecret(f) || f.value.IsZero() {
+		return
+	}
+	if value, ok := dumpValue(f.value); ok {
+		s.Default = value
+	}
+}
+
+// value returns the schema of a non-struct type.
+func (g schemaGenerator) value(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == reflect.TypeOf(time.Duration(0)):
+		// the decoder only accepts nanoseconds for time.Duration fields,
+		// Duration fields accept strings such as 5m.
+		return &Schema{Type: "integer", Description: "duration in nanoseconds"}
+	case t == reflect.TypeOf(Duration{}):
+		return &Schema{Type: "string", Pattern: durationPattern}
+	case reflect.PointerTo(t).Implements(textUnmarshalerType):
+		return &Schema{Type: "string"}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &Schema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &Schema{Type: "string"}
+		}
+		return &Schema{Type: "array", Items: g.item(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: g.item(t.Elem())}
+	default:
+		// interfaces and anything else accept any value.
+		return &Schema{}
+	}
+}
+
+// item returns the schema of the elements of a slice or map.
+func (g schemaGenerator) item(t reflect.Type) *Schema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if isStruct(t) {
+		// elements have no flags, so there are no defaults to look up.
+		return schemaGenerator{}.object(t, nil)
+	}
+
+	return g.value(t)
+}
@@ -0,0 +1,175 @@
+package config
+
+import (
+	"encoding/json"
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type schemaTLS struct {
+	CertPath string `toml:"cert_path" usage:"path to the certificate" required:"true"`
+}
+
+type schemaConfig struct {
+	Address string            `toml:"address" required:"true"`
+	Token   string            `toml:"token"`
+	Retries int               `toml:"retries"`
+	Timeout time.Duration     `toml:"timeout"`
+	Backoff Duration          `toml:"backoff" usage:"delay between retries"`
+	Hosts   []string          `toml:"hosts"`
+	Labels  map[string]string `toml:"labels"`
+	TLS     schemaTLS         `toml:"tls"`
+	Backup  *testServer       `toml:"backup"`
+	Ignored string            `toml:"-"`
+}
+
+func (c *schemaConfig) RegisterFlags(f *flag.FlagSet) {
+	f.StringVar(&c.Address, "schema.addr", "localhost:8080", "hostname:port to listen on")
+	f.StringVar(&c.Token, "schema.token", "hunter2", "token to authenticate with")
+	f.IntVar(&c.Retries, "schema.retries", 3, "number of retries")
+	f.DurationVar(&c.Timeout, "schema.timeout", 0, "request timeout")
+}
+
+func (c *schemaConfig) Validate() error {
+	return nil
+}
+
+func TestGenerateSchema(t *testing.T) {
+	s, err := GenerateSchema(&schemaConfig{})
+	if err != nil {
+		t.Fatalf("GenerateSchema() error: %v", err)
+	}
+
+	out, err := json.Marshal(s)
+	if err != nil {
+		t.Fatalf("Marshal() error: %v", err)
+	}
+
+	var got map[string]any
+	if err := json.Unmarshal(out, &got); err != nil {
+		t.Fatalf("Unmarshal() error: %v", err)
+	}
+
+	want := map[string]any{
+		"$schema":              SchemaDraft,
+		"title":                "schemaConfig",
+		"type":                 "object",
+		"additionalProperties": false,
+		"required":             []any{"address"},
+		"properties": map[string]any{
+			"address": map[string]any{"type": "string", "description": "hostname:port to listen on", "default": "localhost:8080"},
+			"token":   map[string]any{"type": "string", "description": "token to authenticate with"},
+			"retries": map[string]any{"type": "integer", "description": "number of retries", "default": float64(3)},
+			"timeout": map[string]any{"type": "integer", "description": "request timeout"},
+			"backoff": map[string]any{"type": "string", "pattern": durationPattern, "description": "delay between retries"},
+			"hosts":   map[string]any{"type": "array", "items": map[string]any{"type": "string"}},
+			"labels":  map[string]any{"type": "object", "additionalProperties": map[string]any{"type": "string"}},
+			"tls": map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"required":             []any{"cert_path"},
+				"properties": map[string]any{
+					"cert_path": map[string]any{"type": "string", "description": "path to the certificate"},
+				},
+			},
+			"backup": map[string]any{
+				"type":                 "object",
+				"additionalProperties": false,
+				"properties": map[string]any{
+					"address": map[string]any{"type": "string"},
+					"port":    map[string]any{"type": "integer"},
+				},
+			},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("schema =\n%s", out)
+	}
+}
+
+type schemaEnvConfig struct {
+	Address string `toml:"address" env:"TEST_SCHEMA_ADDR" default:"localhost:8080"`
+	Token   string `toml:"token" env:"TEST_SCHEMA_TOKEN" default:"dev"`
+}
+
+func (c *schemaEnvConfig) RegisterFlags(f *flag.FlagSet) {
+	RegisterStructFlags(f, "schema", c)
+}
+
+func (c *schemaEnvConfig) Validate() error {
+	return nil
+}
+
+func TestGenerateSchemaIgnoresEnvironment(t *testing.T) {
+	t.Setenv("TEST_SCHEMA_ADDR", "prod.internal:80")
+	t.Setenv("TEST_SCHEMA_TOKEN_FILE", filepath.Join(t.TempDir(), "missing"))
+
+	s, err := GenerateSchema(&schemaEnvConfig{})
+	if err != nil {
+		t.Fatalf("GenerateSchema() error: %v", err)
+	}
+	if got := s.Properties["address"].Default; got != "localhost:8080" {
+		t.Errorf("address default = %v, want the default tag", got)
+	}
+	for _, l := range env.Lookups() {
+		if strings.HasPrefix(l.Key, "TEST_SCHEMA_") {
+			t.Errorf("GenerateSchema recorded the lookup of %s", l.Key)
+		}
+	}
+}
+
+type schemaVersionedConfig struct {
+	Name  string       `toml:"name"`
+	Retry *retryPolicy `toml:"retry"`
+}
+
+func (c *schemaVersionedConfig) Migrations() []Migration {
+	return (&migratedConfig{}).Migrations()
+}
+
+func (c *schemaVersionedConfig) RegisterFlags(f *flag.FlagSet) {}
+
+func (c *schemaVersionedConfig) Validate() error {
+	return nil
+}
+
+func TestGenerateSchemaVersionsAndAliases(t *testing.T) {
+	s, err := GenerateSchema(&schemaVersionedConfig{})
+	if err != nil {
+		t.Fatalf("GenerateSchema() error: %v", err)
+	}
+
+	version, ok := s.Properties[ConfigVersionKey]
+	if !ok || version.Type != "integer" || !strings.Contains(version.Description, "the latest is 1") {
+		t.Errorf("%s = %+v, want an integer property", ConfigVersionKey, version)
+	}
+	if _, ok := s.Properties["name"]; !ok {
+		t.Errorf("properties = %v, want the fields of the configuration", s.Properties)
+	}
+
+	retry := s.Properties["retry"]
+	if retry == nil {
+		t.Fatalf("properties = %v, want retry", s.Properties)
+	}
+	alias, ok := retry.Properties["MaxRetryDelay"]
+	if !ok || alias.Type != "integer" || !alias.Deprecated || alias.Description != "deprecated, use retry.max_retry_delay" {
+		t.Errorf("MaxRetryDelay = %+v, want a deprecated alias of max_retry_delay", alias)
+	}
+	if replacement := retry.Properties["max_retry_delay"]; replacement == nil || replacement.Deprecated {
+		t.Errorf("max_retry_delay = %+v, want it left as is", replacement)
+	}
+
+	plain, err := GenerateSchema(&schemaConfig{})
+	if err != nil {
+		t.Fatalf("GenerateSchema() error: %v", err)
+	}
+	if _, ok := plain.Properties[ConfigVersionKey]; ok {
+		t.Errorf("a configuration without migrations has a %s property", ConfigVersionKey)
+	}
+}
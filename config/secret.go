@@ -0,0 +1,65 @@
+package config
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const redactedValue = "<redacted>"
+
+// secretNameParts are substrings that mark a field as holding a secret when
+// they appear in its name or toml key.
+var secretNameParts = []string{
+	"secret",
+	"password",
+	"passwd",
+	"token",
+	"credential",
+	"privatekey",
+	"apikey",
+}
+
+// isSecret reports whether the field holds a secret. A `redact:"true"` or
+// `redact:"false"` tag decides explicitly, otherwise the Go field name and
+// toml key are matched against secretNameParts.
+func isSecret(f field) bool {
+	if tag, ok := f.structField.Tag.Lookup("redact"); ok {
+		if redact, err := strconv.ParseBool(tag); err == nil {
+			return redact
+		}
+	}
+
+	for _, name := range []string{f.structField.Name, f.path[len(f.path)-1]} {
+		normalized := strings.ToLower(strings.NewReplacer("_", "", "-", "", ".", "").Replace(name))
+		for _, part := range secretNameParts {
+			if strings.Contains(normalized, part) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// redactedURL returns v with the password of its userinfo redacted, if v is a
+// URL or URL pointer, since URLs such as postgres://user:pw@host carry
+// secrets whatever the name of their field.
+func redactedURL(v any) (string, bool) {
+	switch u := v.(type) {
+	case URL:
+		return u.URL.Redacted(), true
+	case *URL:
+		if u != nil {
+			return u.URL.Redacted(), true
+		}
+	case url.URL:
+		return u.Redacted(), true
+	case *url.URL:
+		if u != nil {
+			return u.Redacted(), true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,221 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+// SecretResolver resolves secret references found in the values of secret
+// fields, e.g. file:///secrets/db_password or env://STRIPE_KEY, into the
+// secret itself. Resolvers are registered per URL scheme with
+// WithSecretResolver.
+type SecretResolver interface {
+	ResolveSecret(ctx context.Context, ref *url.URL) (string, error)
+}
+
+// SecretResolverFunc adapts a function to the SecretResolver interface.
+type SecretResolverFunc func(ctx context.Context, ref *url.URL) (string, error)
+
+func (f SecretResolverFunc) ResolveSecret(ctx context.Context, ref *url.URL) (string, error) {
+	return f(ctx, ref)
+}
+
+// WatchedSecretResolver is implemented by resolvers whose secrets are backed
+// by local files. ParseConfiguration watches the returned paths so that
+// rotating a secret triggers a reload, exactly like editing the config file.
+type WatchedSecretResolver interface {
+	SecretResolver
+	WatchPath(ref *url.URL) (string, bool)
+}
+
+// FileSecretResolver resolves file:// references by reading the file.
+// Trailing newlines are trimmed. Both file:///abs/path and file://rel/path
+// are accepted.
+type FileSecretResolver struct{}
+
+func (FileSecretResolver) ResolveSecret(_ context.Context, ref *url.URL) (string, error) {
+	path, _ := FileSecretResolver{}.WatchPath(ref)
+	out, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimRight(string(out), "\r\n"), nil
+}
+
+func (FileSecretResolver) WatchPath(ref *url.URL) (string, bool) {
+	path := ref.Host + ref.Path
+	if abs, err := filepath.Abs(path); err == nil {
+		path = abs
+	}
+
+	return path, true
+}
+
+// EnvSecretResolver resolves env://NAME references with the value of the NAME
+// environment variable, read through the env package so NAME_FILE provides
+// it from a file, see env.FileSuffix. It is an error for the variable to be
+// unset.
+type EnvSecretResolver struct{}
+
+func (EnvSecretResolver) ResolveSecret(_ context.Context, ref *url.URL) (string, error) {
+	key := ref.Host + strings.TrimPrefix(ref.Path, "/")
+	value, ok, err := env.LookupEnv(key)
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		return "", fmt.Errorf("environment variable %s is not set", key)
+	}
+
+	return value, nil
+}
+
+// WithSecretResolver registers r for references using scheme, replacing any
+// resolver already registered for it, e.g.
+// WithSecretResolver("file", FileSecretResolver{}). No resolver is
+// registered by default, so values that look like references are left as
+// is unless their scheme is registered.
+//
+// References are only resolved in secret fields, the fields Dump redacts:
+// fields tagged `redact:"true"`, and fields whose name looks like a secret,
+// e.g. Token or Password, unless they are tagged `redact:"false"`. A URL or
+// path setting is never replaced by the contents of a file, and the
+// resolved secrets are never printed.
+func WithSecretResolver(scheme string, r SecretResolver) DecodeOption {
+	return func(o *decodeOptions) {
+		if o.resolvers == nil {
+			o.resolvers = map[string]SecretResolver{}
+		}
+		o.resolvers[strings.ToLower(scheme)] = r
+	}
+}
+
+// resolveSecrets replaces every string of a secret field of doc, the
+// document of the struct type t, that is a reference to a registered
+// resolver by the secret it points to. It returns whether doc was changed
+// and the local files the secrets were read from.
+func resolveSecrets(ctx context.Context, doc map[string]any, t reflect.Type, resolvers map[string]SecretResolver) (bool, []string, error) {
+	if len(resolvers) == 0 {
+		return false, nil, nil
+	}
+
+	r := secretResolution{ctx: ctx, resolvers: resolvers}
+	if err := r.table(doc, t, nil); err != nil {
+		return false, nil, err
+	}
+
+	sort.Strings(r.files)
+	return r.changed, r.files, nil
+}
+
+type secretResolution struct {
+	ctx       context.Context
+	resolvers map[string]SecretResolver
+	changed   bool
+	files     []string
+}
+
+// table resolves the references of table, the table of the struct type t
+// at path. Keys that are not fields of t are left to the decoder to report.
+func (r *secretResolution) table(table map[string]any, t reflect.Type, path []string) error {
+	for k, v := range table {
+		sf, ok := tomlStructField(t, k)
+		if !ok {
+			continue
+		}
+
+		fieldPath := append(path[:len(path):len(path)], k)
+		resolved, err := r.value(v, sf.Type, isSecret(field{path: fieldPath, structField: sf}), fieldPath)
+		if err != nil {
+			return err
+		}
+		table[k] = resolved
+	}
+
+	return nil
+}
+
+// value resolves v, a value of type t, which is the value of a secret field
+// or one of its elements when secret is true.
+func (r *secretResolution) value(v any, t reflect.Type, secret bool, path []string) (any, error) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch v := v.(type) {
+	case map[string]any:
+		if isStruct(t) {
+			return v, r.table(v, t, path)
+		}
+		if t.Kind() != reflect.Map {
+			return v, nil
+		}
+		for k, e := range v {
+			resolved, err := r.value(e, t.Elem(), secret, append(path[:len(path):len(path)], k))
+			if err != nil {
+				return nil, err
+			}
+			v[k] = resolved
+		}
+		return v, nil
+	case []any:
+		if t.Kind() != reflect.Slice && t.Kind() != reflect.Array {
+			return v, nil
+		}
+		for i, e := range v {
+			resolved, err := r.value(e, t.Elem(), secret, append(path[:len(path):len(path)], fmt.Sprintf("[%d]", i)))
+			if err != nil {
+				return nil, err
+			}
+			v[i] = resolved
+		}
+		return v, nil
+	case string:
+		if !secret {
+			return v, nil
+		}
+		return r.reference(v, path)
+	default:
+		return v, nil
+	}
+}
+
+func (r *secretResolution) reference(s string, path []string) (any, error) {
+	scheme, _, ok := strings.Cut(s, "://")
+	if !ok {
+		return s, nil
+	}
+
+	resolver, ok := r.resolvers[strings.ToLower(scheme)]
+	if !ok {
+		return s, nil
+	}
+
+	ref, err := url.Parse(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret reference for '%s': %w", strings.Join(path, "."), err)
+	}
+
+	secret, err := resolver.ResolveSecret(r.ctx, ref)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve %s:// secret reference for '%s': %w", ref.Scheme, strings.Join(path, "."), err)
+	}
+
+	if w, ok := resolver.(WatchedSecretResolver); ok {
+		if file, ok := w.WatchPath(ref); ok {
+			r.files = append(r.files, file)
+		}
+	}
+
+	r.changed = true
+	return secret, nil
+}
@@ -0,0 +1,136 @@
+package config
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bloominlabs/baseplate-go/config/env"
+)
+
+type secretConfig struct {
+	Password string   `toml:"password"`
+	Key      string   `toml:"key" redact:"true"`
+	Vault    string   `toml:"vault" redact:"true"`
+	Endpoint string   `toml:"endpoint"`
+	Tokens   []string `toml:"tokens"`
+	CAFile   string   `toml:"ca_file"`
+}
+
+// secretResolvers registers the file and env resolvers, and vault.
+func secretResolvers(vault SecretResolver) decodeOptions {
+	return decodeOptionsFrom(
+		WithSecretResolver("file", FileSecretResolver{}),
+		WithSecretResolver("env", EnvSecretResolver{}),
+		WithSecretResolver("vault", vault),
+	)
+}
+
+func TestDecodeConfigurationSecretReferences(t *testing.T) {
+	t.Setenv("TEST_SECRET_KEY", "sk_test")
+
+	dir := t.TempDir()
+	secret := writeFile(t, dir, "db_password", "hunter2\n")
+	file := writeFile(t, dir, "config.toml", `
+password = "file://`+secret+`"
+key = "env://TEST_SECRET_KEY"
+vault = "vault://secret/data/db#password"
+endpoint = "https://example.com"
+tokens = ["env://TEST_SECRET_KEY", "plain"]
+ca_file = "file://`+secret+`"
+`)
+
+	vault := SecretResolverFunc(func(_ context.Context, ref *url.URL) (string, error) {
+		return ref.Host + ref.Path + ":" + ref.Fragment, nil
+	})
+
+	var cfg secretConfig
+	result, err := decodeFiles([]string{file}, &cfg, secretResolvers(vault))
+	if err != nil {
+		t.Fatalf("decodeFiles() error: %v", err)
+	}
+
+	want := secretConfig{
+		Password: "hunter2",
+		Key:      "sk_test",
+		Vault:    "secret/data/db:password",
+		Endpoint: "https://example.com",
+		Tokens:   []string{"sk_test", "plain"},
+		// references are only resolved in secret fields.
+		CAFile: "file://" + secret,
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("decoded = %+v, want %+v", cfg, want)
+	}
+
+	if !reflect.DeepEqual(result.secretFiles, []string{secret}) {
+		t.Errorf("secretFiles = %v, want [%s]", result.secretFiles, secret)
+	}
+
+	out, err := Dump(&cfg)
+	if err != nil {
+		t.Fatalf("Dump() error: %v", err)
+	}
+	if strings.Contains(string(out), "hunter2") || strings.Contains(string(out), "sk_test") {
+		t.Errorf("Dump() printed a resolved secret:\n%s", out)
+	}
+
+	// without resolvers, references are left as is.
+	var plain secretConfig
+	if _, err := decodeFiles([]string{file}, &plain, decodeOptions{}); err != nil {
+		t.Fatalf("decodeFiles() error: %v", err)
+	}
+	if plain.Password != "file://"+secret || plain.Key != "env://TEST_SECRET_KEY" {
+		t.Errorf("decoded = %+v, want the references left as is", plain)
+	}
+}
+
+func TestDecodeConfigurationSecretReferenceErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing")
+
+	tests := map[string]string{
+		"missing file": `password = "file://` + missing + `"`,
+		"unset env":    `key = "env://TEST_SECRET_UNSET_VARIABLE"`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			file := writeFile(t, dir, "config.toml", content)
+			err := DecodeConfiguration(file, &secretConfig{}, WithSecretResolver("file", FileSecretResolver{}), WithSecretResolver("env", EnvSecretResolver{}))
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if !strings.Contains(err.Error(), "secret reference") {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func decodeOptionsFrom(opts ...DecodeOption) decodeOptions {
+	var o decodeOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+func TestDecodeConfigurationEnvSecretFile(t *testing.T) {
+	dir := t.TempDir()
+	setenvFile(t, "TEST_SECRET_FILE_KEY", writeFile(t, dir, "key", "sk_file\n"))
+
+	file := writeFile(t, dir, "config.toml", `key = "env://TEST_SECRET_FILE_KEY"`)
+	var cfg secretConfig
+	if err := DecodeConfiguration(file, &cfg, WithSecretResolver("env", EnvSecretResolver{})); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.Key != "sk_file" {
+		t.Errorf("Key = %q, want the contents of the file companion", cfg.Key)
+	}
+	if unused := env.Unused("TEST_SECRET_FILE_"); len(unused) != 0 {
+		t.Errorf("Unused() = %v, want the referenced variable to be used", unused)
+	}
+}
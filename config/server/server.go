@@ -45,10 +45,12 @@ func (c *ServerConfig) RegisterFlags(f *flag.FlagSet, prefix string, opts ...Opt
 		dc = o(dc)
 	}
 
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.Address,
 		fmt.Sprintf("%s.addr", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("NOMAD_ADDR_%s", prefix), dc.DefaultAddr),
+		fmt.Sprintf("NOMAD_ADDR_%s", prefix),
+		dc.DefaultAddr,
 		"hostname:port to connect to server",
 	)
 
@@ -56,12 +58,51 @@ func (c *ServerConfig) RegisterFlags(f *flag.FlagSet, prefix string, opts ...Opt
 	f.StringVar(&c.KeyPath, fmt.Sprintf("%s.tls.key.path", prefix), "", "Path to the TLS key file")
 }
 
-func (c *ServerConfig) UseCommonRoutes(mux *http.ServeMux, public bool) {
+type routeConfig struct {
+	ConfigHandler       http.Handler
+	ConfigStatusHandler http.Handler
+}
+
+type RouteOption func(c routeConfig) routeConfig
+
+// WithConfigHandler serves h on /debug/config on non-public muxes, e.g.
+// config.DumpHandler(&cfg) to inspect the effective configuration with its
+// secrets redacted.
+func WithConfigHandler(h http.Handler) RouteOption {
+	return func(c routeConfig) routeConfig {
+		c.ConfigHandler = h
+		return c
+	}
+}
+
+// WithConfigStatusHandler serves h on /debug/config/status on non-public
+// muxes, e.g. config.StatusHandler(status) to see when the configuration was
+// last reloaded and why the last reload failed.
+func WithConfigStatusHandler(h http.Handler) RouteOption {
+	return func(c routeConfig) routeConfig {
+		c.ConfigStatusHandler = h
+		return c
+	}
+}
+
+func (c *ServerConfig) UseCommonRoutes(mux *http.ServeMux, public bool, opts ...RouteOption) {
+	var rc routeConfig
+	for _, o := range opts {
+		rc = o(rc)
+	}
+
 	mux.HandleFunc("/.well-known/healthcheck", func(w http.ResponseWriter, r *http.Request) {
 		_, _ = w.Write([]byte("ok"))
 	})
 
 	if !public {
+		if rc.ConfigHandler != nil {
+			mux.Handle("/debug/config", rc.ConfigHandler)
+		}
+		if rc.ConfigStatusHandler != nil {
+			mux.Handle("/debug/config/status", rc.ConfigStatusHandler)
+		}
+
 		// handling pprof
 		mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
 		mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
@@ -187,10 +187,12 @@ func (c *SlogConfig) SetLevel(s string) error {
 // RegisterFlags registers CLI flags for the slog configuration.
 //   - -slogger.log-level: the log level (default from LOG_LEVEL env var, or "debug")
 func (c *SlogConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.LogLevel,
 		"slogger.log-level",
-		env.GetEnvStrDefault("LOG_LEVEL", "info"),
+		"LOG_LEVEL",
+		"info",
 		"the log level to use for the logger (trace, debug, info, warn, error)",
 	)
 }
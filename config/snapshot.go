@@ -0,0 +1,103 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Snapshotter is an optional interface of WatchableConfiguration for
+// configurations whose Merge changes several things one after another, e.g.
+// a composite configuration merging its telemetry, S3 and database children.
+// Before every reload merges a new configuration, the Parser takes a
+// Snapshot, and restores it if Merge fails so the service is not left half
+// reconfigured.
+type Snapshotter interface {
+	Snapshot() (Snapshot, error)
+}
+
+// Snapshot is the state captured by Snapshotter.Snapshot.
+type Snapshot interface {
+	Restore() error
+}
+
+// SnapshotFunc adapts a function restoring a state to the Snapshot
+// interface.
+type SnapshotFunc func() error
+
+func (f SnapshotFunc) Restore() error {
+	return f()
+}
+
+// SnapshotAll snapshots every configuration that implements Snapshotter, and
+// returns a Snapshot restoring them in reverse order. Composite
+// configurations can implement Snapshotter with it:
+//
+//	func (c *Config) Snapshot() (config.Snapshot, error) {
+//		return config.SnapshotAll(&c.Telemetry, &c.S3, &c.Database)
+//	}
+func SnapshotAll(configs ...any) (Snapshot, error) {
+	var snapshots []Snapshot
+	for _, c := range configs {
+		s, ok := c.(Snapshotter)
+		if !ok {
+			continue
+		}
+
+		snapshot, err := s.Snapshot()
+		if err != nil {
+			return nil, fmt.Errorf("failed to snapshot %T: %w", c, err)
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return SnapshotFunc(func() error {
+		var errs error
+		for i := len(snapshots) - 1; i >= 0; i-- {
+			errs = errors.Join(errs, snapshots[i].Restore())
+		}
+		return errs
+	}), nil
+}
+
+// RollbackError is returned by a reload whose Merge failed after a Snapshot
+// was taken. RestoreErr is set when restoring the snapshot failed as well,
+// in which case the configuration may be inconsistent.
+type RollbackError struct {
+	Err        error
+	RestoreErr error
+}
+
+func (e *RollbackError) Error() string {
+	if e.RestoreErr != nil {
+		return fmt.Sprintf("failed to merge configuration: %s. rolling back to the previous configuration failed too: %s", e.Err, e.RestoreErr)
+	}
+
+	return fmt.Sprintf("failed to merge configuration, rolled back to the previous configuration: %s", e.Err)
+}
+
+func (e *RollbackError) Unwrap() []error {
+	return []error{e.Err, e.RestoreErr}
+}
+
+// mergeWithRollback merges newConfig into cfg, restoring the snapshot of cfg
+// when it implements Snapshotter and Merge fails.
+func mergeWithRollback(cfg, newConfig WatchableConfiguration) error {
+	s, ok := cfg.(Snapshotter)
+	if !ok {
+		if err := cfg.Merge(newConfig); err != nil {
+			return fmt.Errorf("failed to merge configuration: %w", err)
+		}
+		return nil
+	}
+
+	snapshot, err := s.Snapshot()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot the configuration before merging: %w", err)
+	}
+
+	if err := cfg.Merge(newConfig); err != nil {
+		return &RollbackError{Err: err, RestoreErr: snapshot.Restore()}
+	}
+
+	return nil
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"strings"
+	"testing"
+)
+
+type childConfig struct {
+	Value string
+	fail  bool
+}
+
+func (c *childConfig) Merge(other *childConfig) error {
+	if other.fail {
+		return errors.New("failed to create client")
+	}
+	c.Value = other.Value
+	return nil
+}
+
+func (c *childConfig) Snapshot() (Snapshot, error) {
+	value := c.Value
+	return SnapshotFunc(func() error {
+		c.Value = value
+		return nil
+	}), nil
+}
+
+type compositeConfig struct {
+	First  childConfig
+	Second childConfig
+}
+
+func (c *compositeConfig) RegisterFlags(f *flag.FlagSet) {}
+func (c *compositeConfig) Validate() error               { return nil }
+
+func (c *compositeConfig) Merge(o WatchableConfiguration) error {
+	other := o.(*compositeConfig)
+	if err := c.First.Merge(&other.First); err != nil {
+		return err
+	}
+	return c.Second.Merge(&other.Second)
+}
+
+func (c *compositeConfig) Snapshot() (Snapshot, error) {
+	return SnapshotAll(&c.First, &c.Second)
+}
+
+func TestMergeWithRollback(t *testing.T) {
+	cfg := &compositeConfig{First: childConfig{Value: "a"}, Second: childConfig{Value: "b"}}
+
+	err := mergeWithRollback(cfg, &compositeConfig{First: childConfig{Value: "c"}, Second: childConfig{fail: true}})
+	var rollback *RollbackError
+	if !errors.As(err, &rollback) || rollback.RestoreErr != nil {
+		t.Fatalf("expected a successful rollback, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "rolled back") {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if cfg.First.Value != "a" || cfg.Second.Value != "b" {
+		t.Errorf("configuration was not restored: %+v", cfg)
+	}
+
+	if err := mergeWithRollback(cfg, &compositeConfig{First: childConfig{Value: "c"}, Second: childConfig{Value: "d"}}); err != nil {
+		t.Fatalf("mergeWithRollback() error: %v", err)
+	}
+	if cfg.First.Value != "c" || cfg.Second.Value != "d" {
+		t.Errorf("configuration was not merged: %+v", cfg)
+	}
+}
+
+func TestSnapshotAllRestoresInReverseOrder(t *testing.T) {
+	var order []string
+	snapshot := func(name string) Snapshotter {
+		return snapshotterFunc(func() (Snapshot, error) {
+			return SnapshotFunc(func() error {
+				order = append(order, name)
+				return nil
+			}), nil
+		})
+	}
+
+	s, err := SnapshotAll(snapshot("first"), "not a snapshotter", snapshot("second"))
+	if err != nil {
+		t.Fatalf("SnapshotAll() error: %v", err)
+	}
+	if err := s.Restore(); err != nil {
+		t.Fatalf("Restore() error: %v", err)
+	}
+	if strings.Join(order, ",") != "second,first" {
+		t.Errorf("restored in order %v", order)
+	}
+}
+
+type snapshotterFunc func() (Snapshot, error)
+
+func (f snapshotterFunc) Snapshot() (Snapshot, error) {
+	return f()
+}
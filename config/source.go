@@ -0,0 +1,170 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RemoteSource is a configuration document that does not live in a local
+// file, e.g. a key in Consul KV. Remote sources are layered on top of the
+// -config.file files, in the order they were added, and below the command
+// line flags.
+type RemoteSource interface {
+	// Name identifies the source in errors and in the provenance, e.g.
+	// consul://services/api/config.toml.
+	Name() string
+	// Fetch returns the current document and its format.
+	Fetch(ctx context.Context) ([]byte, Format, error)
+	// Watch returns a channel receiving a value whenever the document may
+	// have changed, which reloads the configuration like a file change. It
+	// is closed once ctx is canceled.
+	Watch(ctx context.Context) <-chan struct{}
+}
+
+// StringSource is implemented by remote sources whose documents hold every
+// value as a string, e.g. the items of a Nomad Variable. Their values are
+// converted to the kind of the field they set before they are decoded, like
+// command line flags, e.g. "8080" for an int field, "true" for a bool field
+// or "5m" for a time.Duration field.
+type StringSource interface {
+	RemoteSource
+	// StringValues reports whether the values of the documents of the
+	// source are all strings.
+	StringValues() bool
+}
+
+// sourceFlag is a RemoteSource enabled by a command line parameter.
+type sourceFlag struct {
+	name      string
+	usage     string
+	newSource func(value string) (RemoteSource, error)
+}
+
+// WithRemoteSourceFlag adds the source returned by newSource when the -name
+// parameter is given, e.g. -config.consul-key=services/api/config.toml. Like
+// -config.file, the parameter is read before the other flags are parsed.
+func WithRemoteSourceFlag(name, usage string, newSource func(value string) (RemoteSource, error)) ParseOption {
+	return func(p *Parser) {
+		p.sourceFlags = append(p.sourceFlags, sourceFlag{name: name, usage: usage, newSource: newSource})
+	}
+}
+
+// WithRemoteSources adds sources to every parse, see RemoteSource.
+func WithRemoteSources(sources ...RemoteSource) ParseOption {
+	return func(p *Parser) {
+		p.sources = append(p.sources, sources...)
+	}
+}
+
+// parseSources returns the sources of p, including the ones enabled by a
+// parameter in args.
+func (p *Parser) parseSources(args []string) ([]RemoteSource, error) {
+	sources := append([]RemoteSource{}, p.sources...)
+	for _, sf := range p.sourceFlags {
+		value := parseFlagParameter(args, sf.name, sf.usage)
+		if value == "" {
+			continue
+		}
+
+		source, err := sf.newSource(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid -%s: %w", sf.name, err)
+		}
+		sources = append(sources, source)
+	}
+
+	return sources, nil
+}
+
+// registerSourceFlags registers the parameters of p's source flags so the
+// flag set does not reject them.
+func (p *Parser) registerSourceFlags(f *flag.FlagSet) {
+	for _, sf := range p.sourceFlags {
+		IgnoredFlag(f, sf.name, sf.usage)
+	}
+}
+
+// convertStrings converts the string values of data, a document in format,
+// to the kind of the field of t they set, see StringSource. The document is
+// returned as JSON.
+func convertStrings(data []byte, format Format, t reflect.Type) ([]byte, Format, error) {
+	doc, err := parseDocument(data, format)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var errs ValidationErrors
+	convertTable(doc, t, nil, &errs)
+	if len(errs) > 0 {
+		return nil, "", errs
+	}
+
+	out, err := json.Marshal(doc)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return out, FormatJSON, nil
+}
+
+// convertTable converts the string values of doc, the table of the struct
+// type t at path, in place. Keys that are not fields of t are left to the
+// decoder to report.
+func convertTable(doc map[string]any, t reflect.Type, path []string, errs *ValidationErrors) {
+	for key, value := range doc {
+		_, ft, ok := tomlField(t, key)
+		if !ok {
+			continue
+		}
+		for ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+
+		keyPath := append(path[:len(path):len(path)], key)
+		switch value := value.(type) {
+		case map[string]any:
+			if isStruct(ft) {
+				convertTable(value, ft, keyPath, errs)
+			}
+		case string:
+			converted, err := convertString(value, ft)
+			if err != nil {
+				*errs = append(*errs, FieldError(strings.Join(keyPath, "."), "invalid value %q for a %s field", value, ft))
+				continue
+			}
+			doc[key] = converted
+		}
+	}
+}
+
+// convertString converts s to the kind of t. Strings, and types decoded
+// from text, are left as is.
+func convertString(s string, t reflect.Type) (any, error) {
+	if reflect.PointerTo(t).Implements(textUnmarshalerType) {
+		return s, nil
+	}
+	if t == reflect.TypeOf(time.Duration(0)) {
+		if d, err := time.ParseDuration(s); err == nil {
+			return int64(d), nil
+		}
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		return strconv.ParseBool(s)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.ParseInt(s, 10, t.Bits())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return strconv.ParseUint(s, 10, t.Bits())
+	case reflect.Float32, reflect.Float64:
+		return strconv.ParseFloat(s, t.Bits())
+	default:
+		return s, nil
+	}
+}
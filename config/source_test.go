@@ -0,0 +1,73 @@
+package config
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// stringSource is a StringSource serving a JSON document.
+type stringSource struct {
+	doc     string
+	strings bool
+}
+
+func (s stringSource) Name() string {
+	return "strings://test"
+}
+
+func (s stringSource) Fetch(ctx context.Context) ([]byte, Format, error) {
+	return []byte(s.doc), FormatJSON, nil
+}
+
+func (s stringSource) Watch(ctx context.Context) <-chan struct{} {
+	return nil
+}
+
+func (s stringSource) StringValues() bool {
+	return s.strings
+}
+
+type stringSourceConfig struct {
+	Name    string        `toml:"name"`
+	Debug   bool          `toml:"debug"`
+	Ratio   float64       `toml:"ratio"`
+	Timeout time.Duration `toml:"timeout"`
+	Backoff Duration      `toml:"backoff"`
+	Server  *testServer   `toml:"server"`
+}
+
+func TestDecodeStringSource(t *testing.T) {
+	source := stringSource{
+		doc:     `{"name": "8080", "debug": "true", "ratio": "0.5", "timeout": "5m", "backoff": "1s", "server": {"port": "8080"}}`,
+		strings: true,
+	}
+
+	var cfg stringSourceConfig
+	if _, err := decodeFiles(nil, &cfg, decodeOptions{sources: []RemoteSource{source}}); err != nil {
+		t.Fatalf("decodeFiles() error: %v", err)
+	}
+	if cfg.Name != "8080" || !cfg.Debug || cfg.Ratio != 0.5 || cfg.Timeout != 5*time.Minute || cfg.Backoff.Duration != time.Second || cfg.Server == nil || cfg.Server.Port != 8080 {
+		t.Errorf("decoded = %+v %+v", cfg, cfg.Server)
+	}
+
+	source.doc = `{"debug": "yes", "server": {"port": "http"}}`
+	_, err := decodeFiles(nil, &stringSourceConfig{}, decodeOptions{sources: []RemoteSource{source}})
+	var errs ValidationErrors
+	if !errors.As(err, &errs) || len(errs) != 2 {
+		t.Fatalf("expected a ValidationError for each invalid value, got %v", err)
+	}
+	for _, e := range errs {
+		if e.File != "strings://test" || e.Path != "debug" && e.Path != "server.port" {
+			t.Errorf("unexpected error: %+v", e)
+		}
+	}
+
+	// sources whose documents are typed are decoded as is.
+	source.strings = false
+	source.doc = `{"debug": "true"}`
+	if _, err := decodeFiles(nil, &stringSourceConfig{}, decodeOptions{sources: []RemoteSource{source}}); err == nil {
+		t.Error("expected a string to be rejected for a bool field of a typed document")
+	}
+}
@@ -93,46 +93,60 @@ func (c *DigitalOceanSpacesConfig) WithClient(client *s3.Client) {
 func (c *DigitalOceanSpacesConfig) RegisterFlags(f *flag.FlagSet, prefix string) {
 	c.prefix = prefix
 	prefix, upperPrefix := CreatePrefix(prefix)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.Region,
 		fmt.Sprintf("%s.region", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_REGION", upperPrefix), "sfo3"),
+		fmt.Sprintf("%s_REGION", upperPrefix),
+		"sfo3",
 		"region to associate the client to",
 	)
-	f.BoolVar(
+	env.BoolVar(
+		f,
 		&c.TLSSkipVerify,
 		fmt.Sprintf("%s.tls-skip-verify", prefix),
-		env.GetEnvBoolDefault(fmt.Sprintf("%s_TLS_SKIP_VERIFY", upperPrefix), false),
+		fmt.Sprintf("%s_TLS_SKIP_VERIFY", upperPrefix),
+		false,
 		"region to associate the client to",
 	)
-	f.BoolVar(
+	env.BoolVar(
+		f,
 		&c.UsePathStyle,
 		fmt.Sprintf("%s.use-path-style", prefix),
-		env.GetEnvBoolDefault(fmt.Sprintf("%s_USE_PATH_STYLE", upperPrefix), false),
+		fmt.Sprintf("%s_USE_PATH_STYLE", upperPrefix),
+		false,
 		"use aws path style when making requests",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.InternalEndpoint,
 		fmt.Sprintf("%s.endpoint", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_ENDPOINT", upperPrefix), ""),
+		fmt.Sprintf("%s_ENDPOINT", upperPrefix),
+		"",
 		"base endpoint to use for requests. this will be combined with region to form the full URL",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.AccessKeyID,
 		fmt.Sprintf("%s.access-key-id", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_ACCESS_KEY_ID", upperPrefix), env.GetEnvStrDefault("AWS_ACCESS_KEY_ID", env.GetEnvStrDefault("SPACES_ACCESS_KEY_ID", ""))),
+		fmt.Sprintf("%s_ACCESS_KEY_ID,AWS_ACCESS_KEY_ID,SPACES_ACCESS_KEY_ID", upperPrefix),
+		"",
 		"Spaces Access Key ID for authentication",
 	)
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.SecretAccessKey,
 		fmt.Sprintf("%s.secret-access-key", prefix),
-		env.GetEnvStrDefault(fmt.Sprintf("%s_SECRET_ACCESS_KEY", upperPrefix), env.GetEnvStrDefault("AWS_SECRET_ACCESS_KEY", env.GetEnvStrDefault("SPACES_SECRET_ACCESS_KEY", ""))),
+		fmt.Sprintf("%s_SECRET_ACCESS_KEY,AWS_SECRET_ACCESS_KEY,SPACES_SECRET_ACCESS_KEY", upperPrefix),
+		"",
 		"Spaces Secret Access Key for authentication",
 	)
-	f.BoolVar(
+	env.BoolVar(
+		f,
 		&c.UseHTTPS,
 		fmt.Sprintf("%s.use-https", prefix),
-		env.GetEnvBoolDefault(fmt.Sprintf("%s_USE_HTTPS", upperPrefix), true),
+		fmt.Sprintf("%s_USE_HTTPS", upperPrefix),
+		true,
 		"should HTTPS be used when connecting to the endpoint",
 	)
 	// see the struct for why this is commented out
@@ -0,0 +1,234 @@
+package config
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ReloadStage is the step of a reload that failed.
+type ReloadStage string
+
+const (
+	// ReloadStageDecode covers listing, reading and decoding the config
+	// files and remote sources.
+	ReloadStageDecode    ReloadStage = "decode"
+	ReloadStageValidate  ReloadStage = "validate"
+	ReloadStagePreflight ReloadStage = "preflight"
+	ReloadStageMerge     ReloadStage = "merge"
+)
+
+// stageError records the ReloadStage an error happened in.
+type stageError struct {
+	stage ReloadStage
+	err   error
+}
+
+func (e *stageError) Error() string {
+	return e.err.Error()
+}
+
+func (e *stageError) Unwrap() error {
+	return e.err
+}
+
+func failedAt(stage ReloadStage, err error) error {
+	return &stageError{stage: stage, err: err}
+}
+
+// errorStage returns the stage err happened in, ReloadStageDecode when it is
+// unknown.
+func errorStage(err error) ReloadStage {
+	var stageErr *stageError
+	if errors.As(err, &stageErr) {
+		return stageErr.stage
+	}
+
+	return ReloadStageDecode
+}
+
+// configHash identifies a configuration by the hash of its Dump. Secrets are
+// redacted by Dump, so rotating one does not change the hash.
+func configHash(cfg any) string {
+	out, err := Dump(cfg)
+	if err != nil {
+		return ""
+	}
+
+	sum := sha256.Sum256(out)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ReloadState is the outcome of the initial load and the reloads of a
+// configuration.
+type ReloadState struct {
+	// Hash identifies the configuration in effect, see Dump. Comparing it
+	// across instances tells whether they run the same configuration.
+	Hash string `json:"hash"`
+	// LoadedAt is when the configuration was first loaded.
+	LoadedAt time.Time `json:"loaded_at"`
+	// LastSuccess is when the configuration in effect was applied, either by
+	// the initial load or by a reload.
+	LastSuccess time.Time `json:"last_success"`
+	// LastAttempt is when the last reload finished, successfully or not.
+	LastAttempt *time.Time `json:"last_attempt,omitempty"`
+	// Failing is true when the last reload failed, i.e. the configuration in
+	// effect is not the one in the files.
+	Failing bool `json:"failing"`
+	// LastError is the error of the last failed reload, kept after later
+	// reloads succeed.
+	LastError      string      `json:"last_error,omitempty"`
+	LastErrorStage ReloadStage `json:"last_error_stage,omitempty"`
+	LastErrorAt    *time.Time  `json:"last_error_at,omitempty"`
+	Reloads        int         `json:"reloads"`
+	Failures       int         `json:"failures"`
+}
+
+// ReloadStatus tracks the ReloadState of a Parser. It is safe for concurrent
+// use. Pass one to WithReloadStatus and serve it with StatusHandler.
+type ReloadStatus struct {
+	mu    sync.RWMutex
+	state ReloadState
+}
+
+// State returns a copy of the current state.
+func (s *ReloadStatus) State() ReloadState {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.state
+}
+
+func (s *ReloadStatus) loaded(at time.Time, hash string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Hash = hash
+	s.state.LoadedAt = at
+	s.state.LastSuccess = at
+}
+
+func (s *ReloadStatus) reloaded(at time.Time, event ReloadEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.state.Reloads++
+	s.state.LastAttempt = &at
+	s.state.Failing = event.Err != nil
+	if event.Err != nil {
+		s.state.Failures++
+		s.state.LastError = event.Err.Error()
+		s.state.LastErrorStage = event.Stage
+		s.state.LastErrorAt = &at
+		return
+	}
+
+	s.state.Hash = event.Hash
+	s.state.LastSuccess = at
+}
+
+// WithReloadStatus records the outcome of the load and the reloads in s,
+// e.g. to serve it with StatusHandler.
+func WithReloadStatus(s *ReloadStatus) ParseOption {
+	return func(o *Parser) {
+		o.status = s
+	}
+}
+
+// StatusHandler serves the ReloadState of s as JSON, e.g. on
+// /debug/config/status. It responds with 503 Service Unavailable while the
+// last reload is failing so it can back an alert.
+func StatusHandler(s *ReloadStatus) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := s.State()
+
+		w.Header().Set("Content-Type", "application/json")
+		if state.Failing {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(state)
+	})
+}
+
+const meterName = "github.com/bloominlabs/baseplate-go/config"
+
+// reloadMetrics are the OpenTelemetry instruments reporting reloads.
+type reloadMetrics struct {
+	attempts metric.Int64Counter
+	failures metric.Int64Counter
+}
+
+// registerMetrics creates the reload instruments on the MeterProvider of the
+// Parser, and observes the state of status until ctx is canceled.
+func (p *Parser) registerMetrics(ctx context.Context, status *ReloadStatus) (*reloadMetrics, error) {
+	meter := p.meterProvider().Meter(meterName)
+
+	var (
+		m   reloadMetrics
+		err error
+	)
+	m.attempts, err = meter.Int64Counter("config.reload.attempts",
+		metric.WithDescription("Number of configuration reloads, by trigger."),
+		metric.WithUnit("{reload}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	m.failures, err = meter.Int64Counter("config.reload.failures",
+		metric.WithDescription("Number of failed configuration reloads, by trigger and the stage that failed."),
+		metric.WithUnit("{reload}"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	lastSuccess, err := meter.Float64ObservableGauge("config.reload.last_success",
+		metric.WithDescription("Unix time the configuration in effect was applied."),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return nil, err
+	}
+	hash, err := meter.Int64ObservableGauge("config.hash",
+		metric.WithDescription("Hash of the configuration in effect, secrets excluded. Differs between instances running different configurations."),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	reg, err := meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		state := status.State()
+		o.ObserveFloat64(lastSuccess, float64(state.LastSuccess.UnixNano())/float64(time.Second))
+		if b, err := hex.DecodeString(state.Hash); err == nil && len(b) >= 4 {
+			o.ObserveInt64(hash, int64(binary.BigEndian.Uint32(b)))
+		}
+		return nil
+	}, lastSuccess, hash)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		<-ctx.Done()
+		_ = reg.Unregister()
+	}()
+
+	return &m, nil
+}
+
+func (m *reloadMetrics) record(ctx context.Context, event ReloadEvent) {
+	trigger := attribute.String("trigger", string(event.Trigger))
+	m.attempts.Add(ctx, 1, metric.WithAttributes(trigger))
+	if event.Err != nil {
+		m.failures.Add(ctx, 1, metric.WithAttributes(trigger, attribute.String("stage", string(event.Stage))))
+	}
+}
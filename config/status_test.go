@@ -0,0 +1,108 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+func TestParserReloadStatus(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "address = \"file:8080\"\n")
+
+	reader := sdkmetric.NewManualReader()
+	status := &ReloadStatus{}
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml")
+	p.MeterProvider = sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))
+	events := make(chan ReloadEvent, 1)
+	WithReloadStatus(status)(p)
+	WithReloadHook(func(e ReloadEvent) {
+		events <- e
+	})(p)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfg := &parserConfig{merged: make(chan struct{}, 1)}
+	if err := p.Parse(ctx, cfg, nil); err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	loaded := status.State()
+	if loaded.Hash == "" || loaded.LastSuccess.IsZero() || loaded.Reloads != 0 {
+		t.Fatalf("state after load = %+v", loaded)
+	}
+
+	reload := func(content string) ReloadEvent {
+		fsys.write("/etc/app/config.toml", content)
+		w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+		select {
+		case e := <-events:
+			return e
+		case <-time.After(time.Second):
+			t.Fatal("reload hook was not called")
+		}
+		return ReloadEvent{}
+	}
+
+	if e := reload("unknown = true\n"); e.Stage != ReloadStageDecode {
+		t.Errorf("Stage = %q, want decode", e.Stage)
+	}
+	failed := status.State()
+	if !failed.Failing || failed.LastError == "" || failed.LastErrorStage != ReloadStageDecode || failed.Hash != loaded.Hash {
+		t.Errorf("state after a failed reload = %+v", failed)
+	}
+
+	rec := httptest.NewRecorder()
+	StatusHandler(status).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/config/status", nil))
+	var served ReloadState
+	if err := json.Unmarshal(rec.Body.Bytes(), &served); err != nil {
+		t.Fatalf("failed to decode status: %v", err)
+	}
+	if rec.Code != http.StatusServiceUnavailable || served.LastError != failed.LastError {
+		t.Errorf("served %d %+v", rec.Code, served)
+	}
+
+	e := reload("address = \"new:8080\"\n")
+	<-cfg.merged
+	if e.Err != nil || e.Hash == "" || e.Hash == loaded.Hash {
+		t.Errorf("event = %+v, want a successful reload with a new hash", e)
+	}
+	reloaded := status.State()
+	if reloaded.Failing || reloaded.Hash != e.Hash || reloaded.Reloads != 2 || reloaded.Failures != 1 || reloaded.LastError == "" {
+		t.Errorf("state after a successful reload = %+v", reloaded)
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(ctx, &rm); err != nil {
+		t.Fatalf("Collect() error: %v", err)
+	}
+	sums := map[string]int64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			sum, ok := m.Data.(metricdata.Sum[int64])
+			if !ok {
+				continue
+			}
+			for _, dp := range sum.DataPoints {
+				key := m.Name
+				if stage, ok := dp.Attributes.Value(attribute.Key("stage")); ok {
+					key += "/" + stage.AsString()
+				}
+				sums[key] += dp.Value
+			}
+		}
+	}
+	if sums["config.reload.attempts"] != 2 || sums["config.reload.failures/decode"] != 1 {
+		t.Errorf("metrics = %v", sums)
+	}
+}
@@ -1,8 +1,11 @@
 package stripe
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"net/http"
 	"sync"
 
 	"github.com/hashicorp/go-cleanhttp"
@@ -33,10 +36,12 @@ func (c *StripeConfig) WithClient(client *client.API) {
 }
 
 func (c *StripeConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(
+	env.StringVar(
+		f,
 		&c.SecretKey,
 		"stripe.secret_key",
-		env.GetEnvStrDefault("STRIPE_SECRET_KEY", ""),
+		"STRIPE_SECRET_KEY",
+		"",
 		"stripe API secret key from the portal",
 	)
 }
@@ -61,6 +66,30 @@ func (c *StripeConfig) Merge(other *StripeConfig) error {
 	return nil
 }
 
+// Preflight checks that stripe accepts the secret key of other before Merge
+// swaps it in, by retrieving the balance of the account. Restricted keys that
+// are not allowed to read the balance pass the check.
+func (c *StripeConfig) Preflight(ctx context.Context, other *StripeConfig) error {
+	sc, err := (&StripeConfig{SecretKey: other.SecretKey}).CreateClient()
+	if err != nil {
+		return err
+	}
+
+	params := &stripe.BalanceParams{}
+	params.Context = ctx
+	_, err = sc.Balance.Get(params)
+
+	var stripeErr *stripe.Error
+	if errors.As(err, &stripeErr) && stripeErr.HTTPStatusCode == http.StatusForbidden {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("stripe rejected the secret key: %w", err)
+	}
+
+	return nil
+}
+
 func (c *StripeConfig) Validate() error {
 	var validationErrors error
 	if c.SecretKey == "" {
@@ -19,9 +19,9 @@ type TailscaleConfig struct {
 }
 
 func (c *TailscaleConfig) RegisterFlags(f *flag.FlagSet) {
-	f.StringVar(&c.Tailnet, "tailscale.tailnet", env.GetEnvStrDefault("TAILSCALE_TAILNET", "bloominlabs.com"), "tailnet to perform API operations on")
-	f.StringVar(&c.ApiToken, "tailscale.api-token", env.GetEnvStrDefault("TAILSCALE_API_TOKEN", ""), "Token to use to authenticate to tailscale")
-	f.StringVar(&c.BaseURL, "tailscale.base-url", env.GetEnvStrDefault("TAILSCALE_BASE_URL", ""), "Base URL to use for tailscale requests. normally used by tests")
+	env.StringVar(f, &c.Tailnet, "tailscale.tailnet", "TAILSCALE_TAILNET", "bloominlabs.com", "tailnet to perform API operations on")
+	env.StringVar(f, &c.ApiToken, "tailscale.api-token", "TAILSCALE_API_TOKEN", "", "Token to use to authenticate to tailscale")
+	env.StringVar(f, &c.BaseURL, "tailscale.base-url", "TAILSCALE_BASE_URL", "", "Base URL to use for tailscale requests. normally used by tests")
 }
 
 func (c *TailscaleConfig) Merge(other *TailscaleConfig) error {
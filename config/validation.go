@@ -0,0 +1,168 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ValidationError is a problem with a single configuration value. Path is
+// the key path of the value, e.g. server.tls.cert_path. File, Line and
+// Column locate it in a config file when it was read from one.
+type ValidationError struct {
+	Path   string
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+// FieldError returns a ValidationError for the value at path, formatting the
+// message like fmt.Errorf. Validate implementations of nested configurations
+// should use paths relative to themselves and let the parent Nest them.
+func FieldError(path string, format string, args ...any) *ValidationError {
+	return &ValidationError{Path: path, Err: fmt.Errorf(format, args...)}
+}
+
+func (e *ValidationError) Error() string {
+	var b strings.Builder
+	if e.Path != "" {
+		b.WriteString(e.Path)
+		b.WriteString(": ")
+	}
+	b.WriteString(e.Err.Error())
+
+	var location []string
+	if e.File != "" {
+		location = append(location, e.File)
+	}
+	if e.Line > 0 {
+		location = append(location, fmt.Sprintf("line %d, column %d", e.Line, e.Column))
+	}
+	if len(location) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(location, ", "))
+	}
+
+	return b.String()
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationErrors is a list of ValidationError, rendered one per line.
+type ValidationErrors []*ValidationError
+
+func (e ValidationErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%d configuration errors:", len(e))
+	for _, err := range e {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+
+	return b.String()
+}
+
+func (e ValidationErrors) Unwrap() []error {
+	errs := make([]error, len(e))
+	for i, err := range e {
+		errs[i] = err
+	}
+
+	return errs
+}
+
+// AsValidationErrors flattens err into a list of ValidationError. errors
+// joined with errors.Join, ValidationErrors and multierror values are
+// flattened; any other error becomes a ValidationError without a path.
+func AsValidationErrors(err error) ValidationErrors {
+	var out ValidationErrors
+	var walk func(err error)
+	walk = func(err error) {
+		switch e := err.(type) {
+		case nil:
+		case *ValidationError:
+			copied := *e
+			out = append(out, &copied)
+		case ValidationErrors:
+			for _, err := range e {
+				walk(err)
+			}
+		case interface{ Unwrap() []error }:
+			for _, err := range e.Unwrap() {
+				walk(err)
+			}
+		case interface{ WrappedErrors() []error }:
+			for _, err := range e.WrappedErrors() {
+				walk(err)
+			}
+		default:
+			out = append(out, &ValidationError{Err: err})
+		}
+	}
+	walk(err)
+
+	return out
+}
+
+// JoinValidationErrors aggregates errs, which may be nil, into a single
+// ValidationErrors. It returns nil when there is no error.
+func JoinValidationErrors(errs ...error) error {
+	var out ValidationErrors
+	for _, err := range errs {
+		out = append(out, AsValidationErrors(err)...)
+	}
+	if len(out) == 0 {
+		return nil
+	}
+
+	return out
+}
+
+// Nest prefixes the path of every ValidationError in err with prefix, so a
+// parent configuration can aggregate the errors of the configurations it
+// embeds:
+//
+//	return config.JoinValidationErrors(
+//		config.Nest("server", c.Server.Validate()),
+//		config.Nest("database", c.Database.Validate()),
+//	)
+func Nest(prefix string, err error) error {
+	errs := AsValidationErrors(err)
+	if len(errs) == 0 {
+		return nil
+	}
+
+	for _, e := range errs {
+		if e.Path == "" {
+			e.Path = prefix
+		} else {
+			e.Path = prefix + "." + e.Path
+		}
+	}
+
+	return errs
+}
+
+// withFile sets the file of every ValidationError in err that does not have
+// one. Other errors are wrapped with the file name.
+func withFile(err error, file string) error {
+	var errs ValidationErrors
+	if !errors.As(err, &errs) {
+		return fmt.Errorf("failed to decode %s: %w", file, err)
+	}
+
+	errs = AsValidationErrors(errs)
+	for _, e := range errs {
+		if e.File == "" {
+			e.File = file
+		}
+	}
+
+	return errs
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestDecodeConfigurationValidationErrors(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+		want    ValidationError
+	}{
+		{
+			name:    "syntax",
+			file:    "syntax.toml",
+			content: "name = \"api\"\nport = = 1\n",
+			want:    ValidationError{Line: 2, Column: 8},
+		},
+		{
+			name:    "type",
+			file:    "type.toml",
+			content: "name = \"api\"\nratio = \"high\"\n",
+			want:    ValidationError{Path: "ratio", Line: 2, Column: 9},
+		},
+		{
+			name:    "unknown field",
+			file:    "unknown.toml",
+			content: "name = \"api\"\n\n[server]\nadress = \"0.0.0.0\"\n",
+			want:    ValidationError{Path: "server.adress", Line: 4, Column: 1},
+		},
+		{
+			name:    "unknown yaml field",
+			file:    "unknown.yaml",
+			content: "server:\n  adress: 0.0.0.0\n",
+			want:    ValidationError{Path: "server.adress", Line: 2, Column: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			file := writeFile(t, dir, tt.file, tt.content)
+			err := DecodeConfiguration(file, &testConfig{})
+
+			var errs ValidationErrors
+			if !errors.As(err, &errs) || len(errs) != 1 {
+				t.Fatalf("expected a single ValidationError, got %v", err)
+			}
+
+			got := errs[0]
+			if got.Path != tt.want.Path || got.File != file || got.Line != tt.want.Line || got.Column != tt.want.Column {
+				t.Errorf("got path=%q file=%q line=%d column=%d, want path=%q file=%q line=%d column=%d",
+					got.Path, got.File, got.Line, got.Column, tt.want.Path, file, tt.want.Line, tt.want.Column)
+			}
+		})
+	}
+}
+
+func TestNestValidationErrors(t *testing.T) {
+	tls := JoinValidationErrors(
+		FieldError("cert_path", "file does not exist"),
+		nil,
+		errors.New("certificate expired"),
+	)
+	server := JoinValidationErrors(
+		FieldError("address", "missing port"),
+		Nest("tls", tls),
+	)
+	err := JoinValidationErrors(
+		Nest("server", server),
+		Nest("database", fmt.Errorf("did not find a 'host'")),
+		Nest("stripe", nil),
+	)
+
+	want := `4 configuration errors:
+  - server.address: missing port
+  - server.tls.cert_path: file does not exist
+  - server.tls: certificate expired
+  - database: did not find a 'host'`
+	if err.Error() != want {
+		t.Errorf("Error() =\n%s\nwant\n%s", err, want)
+	}
+
+	if JoinValidationErrors(nil, Nest("stripe", nil)) != nil {
+		t.Error("expected nil when there is no error")
+	}
+}
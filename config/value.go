@@ -0,0 +1,139 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// Value holds an immutable snapshot of a configuration. Readers call Load to
+// get the current snapshot and reloads replace it as a whole with Store, so a
+// reader never observes a half-applied reload and the configuration type
+// does not need its own locking.
+//
+// Snapshots must not be modified once stored.
+type Value[T Configuration] struct {
+	current atomic.Pointer[T]
+
+	mu          sync.Mutex
+	subscribers map[int]func(old, new T)
+	nextID      int
+}
+
+// NewValue returns a Value holding cfg.
+func NewValue[T Configuration](cfg T) *Value[T] {
+	v := &Value[T]{}
+	v.current.Store(&cfg)
+
+	return v
+}
+
+// Load returns the current snapshot.
+func (v *Value[T]) Load() T {
+	if cfg := v.current.Load(); cfg != nil {
+		return *cfg
+	}
+
+	var zero T
+	return zero
+}
+
+func (v *Value[T]) snapshot() any {
+	return v.Load()
+}
+
+// Store replaces the current snapshot with cfg and calls every subscriber
+// with the previous and the new snapshot, in the order they subscribed.
+func (v *Value[T]) Store(cfg T) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	var old T
+	if prev := v.current.Swap(&cfg); prev != nil {
+		old = *prev
+	}
+
+	for id := 0; id < v.nextID; id++ {
+		if fn, ok := v.subscribers[id]; ok {
+			fn(old, cfg)
+		}
+	}
+}
+
+// Subscribe calls fn after every Store with the old and the new snapshot.
+// Subscribers are called synchronously and must not call Store or Subscribe.
+// The returned function removes the subscription.
+func (v *Value[T]) Subscribe(fn func(old, new T)) (unsubscribe func()) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.subscribers == nil {
+		v.subscribers = make(map[int]func(old, new T))
+	}
+	id := v.nextID
+	v.nextID++
+	v.subscribers[id] = fn
+
+	return func() {
+		v.mu.Lock()
+		defer v.mu.Unlock()
+		delete(v.subscribers, id)
+	}
+}
+
+// ParseValue parses the configuration like Parser.Parse, but instead of
+// merging reloads into a live configuration it builds a whole new snapshot
+// with createCfg, validates it, runs its preflight checks, or those of its
+// fields when T is not a Preflighter, see Preflighter, and stores it in the
+// returned Value. Any Configuration works, including the existing
+// WatchableConfiguration types: their Merge method is simply not used. When
+// createCfg is nil, T must be a pointer and new zero values of the type it
+// points to are used. A nil p uses the same globals as ParseConfiguration.
+func ParseValue[T Configuration](ctx context.Context, p *Parser, createCfg func() T) (*Value[T], error) {
+	if p == nil {
+		p = &Parser{}
+	}
+
+	if createCfg == nil {
+		var zero T
+		if _, ok := newLike(zero).(T); !ok {
+			return nil, fmt.Errorf("createCfg is required when %T is not a pointer", zero)
+		}
+		createCfg = func() T {
+			return newLike(zero).(T)
+		}
+	}
+
+	cfg := createCfg()
+	l, err := p.load(ctx, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	v := NewValue(cfg)
+	l.current = func() any { return v.Load() }
+	err = p.watch(ctx, l, func(files []string) (decodeResult, error) {
+		newConfig := createCfg()
+		decoded, err := reloadConfiguration(newConfig, p.flagSet(), files, l.args, l.opts)
+		if err != nil {
+			return decoded, failedAt(ReloadStageDecode, fmt.Errorf("failed to decode updated config file: %w", err))
+		}
+
+		if err := newConfig.Validate(); err != nil {
+			return decoded, failedAt(ReloadStageValidate, fmt.Errorf("updated config failed validation: %w", err))
+		}
+
+		if err := preflight(ctx, v.Load(), newConfig); err != nil {
+			return decoded, failedAt(ReloadStagePreflight, err)
+		}
+
+		v.Store(newConfig)
+		return decoded, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
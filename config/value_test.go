@@ -0,0 +1,92 @@
+package config
+
+import (
+	"context"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/bloominlabs/baseplate-go/config/filesystem"
+)
+
+func TestValueStoreNotifiesSubscribers(t *testing.T) {
+	first := &reloadConfig{Address: "first"}
+	v := NewValue(first)
+
+	var calls []string
+	unsubscribe := v.Subscribe(func(old, new *reloadConfig) {
+		calls = append(calls, old.Address+"->"+new.Address)
+	})
+	v.Subscribe(func(old, new *reloadConfig) {
+		calls = append(calls, "second subscriber")
+	})
+
+	v.Store(&reloadConfig{Address: "second"})
+	unsubscribe()
+	v.Store(&reloadConfig{Address: "third"})
+
+	want := []string{"first->second", "second subscriber", "second subscriber"}
+	if len(calls) != len(want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+	for i := range want {
+		if calls[i] != want[i] {
+			t.Errorf("calls = %v, want %v", calls, want)
+			break
+		}
+	}
+
+	if got := v.Load().Address; got != "third" {
+		t.Errorf("Load().Address = %q, want third", got)
+	}
+	if first.Address != "first" {
+		t.Errorf("the old snapshot was modified: %+v", first)
+	}
+}
+
+func TestParseValueReload(t *testing.T) {
+	fsys := &mapFS{files: fstest.MapFS{}}
+	fsys.write("/etc/app/config.toml", "address = \"file:8080\"\n")
+
+	p, w := newTestParser(fsys, "-config.file", "/etc/app/config.toml", "-parser.bucket", "from-flag")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	v, err := ParseValue[*parserConfig](ctx, p, nil)
+	if err != nil {
+		t.Fatalf("ParseValue() error: %v", err)
+	}
+
+	initial := v.Load()
+	if initial.Address != "file:8080" || initial.Bucket != "from-flag" {
+		t.Fatalf("parsed = %s %s, want file:8080 from-flag", initial.Address, initial.Bucket)
+	}
+
+	swapped := make(chan *parserConfig, 1)
+	v.Subscribe(func(old, new *parserConfig) {
+		if old != initial {
+			t.Errorf("old snapshot = %p, want %p", old, initial)
+		}
+		swapped <- new
+	})
+
+	fsys.write("/etc/app/config.toml", "address = \"updated:8080\"\n")
+	w.eventsCh <- &filesystem.FileWatcherEvent{Filenames: []string{"/etc/app/config.toml"}}
+
+	select {
+	case cfg := <-swapped:
+		if cfg.Address != "updated:8080" || cfg.Bucket != "from-flag" {
+			t.Errorf("reloaded = %s %s, want updated:8080 from-flag", cfg.Address, cfg.Bucket)
+		}
+		if v.Load() != cfg {
+			t.Error("Load() did not return the new snapshot")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("configuration was not reloaded")
+	}
+
+	if initial.Address != "file:8080" {
+		t.Errorf("the initial snapshot was modified: %s", initial.Address)
+	}
+}
@@ -0,0 +1,310 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The types below implement flag.Value for values that are otherwise parsed
+// by hand in every RegisterFlags method. They decode from the same
+// configuration file values Dump writes, so a dumped configuration can be
+// loaded again, and they can be defaulted from the environment with
+// env.GetEnvValueDefault or the env tag of RegisterStructFlags.
+
+// StringSlice is a list of strings, given as comma separated values on the
+// command line and as an array in configuration files. Setting it replaces
+// the previous values.
+type StringSlice []string
+
+func (s StringSlice) String() string {
+	return strings.Join(s, ",")
+}
+
+func (s *StringSlice) Set(value string) error {
+	out := StringSlice{}
+	for _, part := range strings.Split(value, ",") {
+		if part = strings.TrimSpace(part); part != "" {
+			out = append(out, part)
+		}
+	}
+	*s = out
+
+	return nil
+}
+
+// KeyValueMap is a map of strings, given as comma separated key=value pairs
+// on the command line and as a table in configuration files. Setting it
+// replaces the previous pairs.
+type KeyValueMap map[string]string
+
+func (m KeyValueMap) String() string {
+	parts := make([]string, 0, len(m))
+	for k, v := range m {
+		parts = append(parts, k+"="+v)
+	}
+	sort.Strings(parts)
+
+	return strings.Join(parts, ",")
+}
+
+func (m *KeyValueMap) Set(value string) error {
+	out := KeyValueMap{}
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok {
+			return fmt.Errorf("expected key=value, got %q", pair)
+		}
+		out[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	*m = out
+
+	return nil
+}
+
+// ByteSize is a number of bytes, e.g. "512MiB". Units are case insensitive:
+// kB, MB, GB and TB are powers of 1000, KiB, MiB, GiB and TiB, as well as
+// the single letters K, M, G and T, are powers of 1024. A plain number is a
+// number of bytes.
+type ByteSize uint64
+
+const (
+	Byte     ByteSize = 1
+	Kibibyte          = 1024 * Byte
+	Mebibyte          = 1024 * Kibibyte
+	Gibibyte          = 1024 * Mebibyte
+	Tebibyte          = 1024 * Gibibyte
+)
+
+var byteSizeUnits = map[string]ByteSize{
+	"":    Byte,
+	"b":   Byte,
+	"kb":  1000,
+	"mb":  1000 * 1000,
+	"gb":  1000 * 1000 * 1000,
+	"tb":  1000 * 1000 * 1000 * 1000,
+	"k":   Kibibyte,
+	"kib": Kibibyte,
+	"m":   Mebibyte,
+	"mib": Mebibyte,
+	"g":   Gibibyte,
+	"gib": Gibibyte,
+	"t":   Tebibyte,
+	"tib": Tebibyte,
+}
+
+// ParseByteSize parses a size such as "10MiB" or "1.5GB".
+func ParseByteSize(s string) (ByteSize, error) {
+	s = strings.TrimSpace(s)
+	i := strings.IndexFunc(s, func(r rune) bool {
+		return (r < '0' || r > '9') && r != '.'
+	})
+	if i < 0 {
+		i = len(s)
+	}
+
+	number, unit := s[:i], strings.ToLower(strings.TrimSpace(s[i:]))
+	multiplier, ok := byteSizeUnits[unit]
+	if !ok || number == "" {
+		return 0, fmt.Errorf("invalid size %q. expected a number of bytes with an optional unit, e.g. 512MiB", s)
+	}
+
+	if n, err := strconv.ParseUint(number, 10, 64); err == nil {
+		if n > math.MaxUint64/uint64(multiplier) {
+			return 0, fmt.Errorf("size %q is too large", s)
+		}
+		return ByteSize(n) * multiplier, nil
+	}
+
+	f, err := strconv.ParseFloat(number, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: %w", s, err)
+	}
+	bytes := f * float64(multiplier)
+	if bytes >= math.MaxUint64 {
+		return 0, fmt.Errorf("size %q is too large", s)
+	}
+
+	return ByteSize(math.Round(bytes)), nil
+}
+
+// String formats b with the largest binary unit dividing it, e.g. "512MiB".
+func (b ByteSize) String() string {
+	for _, unit := range []struct {
+		size ByteSize
+		name string
+	}{
+		{Tebibyte, "TiB"},
+		{Gibibyte, "GiB"},
+		{Mebibyte, "MiB"},
+		{Kibibyte, "KiB"},
+	} {
+		if b >= unit.size && b%unit.size == 0 {
+			return strconv.FormatUint(uint64(b/unit.size), 10) + unit.name
+		}
+	}
+
+	return strconv.FormatUint(uint64(b), 10) + "B"
+}
+
+func (b *ByteSize) Set(value string) error {
+	parsed, err := ParseByteSize(value)
+	if err != nil {
+		return err
+	}
+	*b = parsed
+
+	return nil
+}
+
+func (b ByteSize) MarshalText() ([]byte, error) {
+	return []byte(b.String()), nil
+}
+
+// UnmarshalText accepts both sizes with a unit and integers, which are
+// numbers of bytes.
+func (b *ByteSize) UnmarshalText(text []byte) error {
+	return b.Set(string(text))
+}
+
+// URL is an absolute URL, e.g. "https://api.example.com/v1".
+type URL struct {
+	url.URL
+}
+
+func (u URL) String() string {
+	return u.URL.String()
+}
+
+func (u *URL) Set(value string) error {
+	if value == "" {
+		*u = URL{}
+		return nil
+	}
+
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	if !parsed.IsAbs() {
+		return fmt.Errorf("%q is not an absolute URL, e.g. https://example.com", value)
+	}
+	u.URL = *parsed
+
+	return nil
+}
+
+func (u URL) MarshalText() ([]byte, error) {
+	return []byte(u.String()), nil
+}
+
+func (u *URL) UnmarshalText(text []byte) error {
+	return u.Set(string(text))
+}
+
+// Duration is a time.Duration written as a string such as "5m" in
+// configuration files. Integers are accepted as well and are nanoseconds,
+// like for time.Duration fields.
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) String() string {
+	return d.Duration.String()
+}
+
+func (d *Duration) Set(value string) error {
+	parsed, err := time.ParseDuration(value)
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	if n, err := strconv.ParseInt(string(text), 10, 64); err == nil {
+		d.Duration = time.Duration(n)
+		return nil
+	}
+
+	return d.Set(string(text))
+}
+
+// Enum is a string restricted to a set of allowed values. The allowed values
+// must be set before the Enum is parsed, with NewEnum in a RegisterFlags
+// method or with the enum tag of RegisterStructFlags:
+//
+//	Format config.Enum `toml:"format" default:"json" enum:"json,text"`
+//
+// An Enum without allowed values accepts anything.
+type Enum struct {
+	value   string
+	allowed []string
+}
+
+// NewEnum returns an Enum set to def, which must be one of allowed.
+func NewEnum(def string, allowed ...string) Enum {
+	e := Enum{allowed: allowed}
+	if err := e.Set(def); err != nil {
+		panic(fmt.Sprintf("NewEnum: %s", err))
+	}
+
+	return e
+}
+
+// Value returns the current value.
+func (e Enum) Value() string {
+	return e.value
+}
+
+// Allowed returns the allowed values.
+func (e Enum) Allowed() []string {
+	return e.allowed
+}
+
+// SetAllowed replaces the allowed values. RegisterStructFlags calls it for
+// the enum tag.
+func (e *Enum) SetAllowed(allowed ...string) {
+	e.allowed = allowed
+}
+
+func (e Enum) String() string {
+	return e.value
+}
+
+func (e *Enum) Set(value string) error {
+	if len(e.allowed) > 0 && value != "" {
+		ok := false
+		for _, allowed := range e.allowed {
+			ok = ok || value == allowed
+		}
+		if !ok {
+			return fmt.Errorf("invalid value %q. expected one of %s", value, strings.Join(e.allowed, ", "))
+		}
+	}
+	e.value = value
+
+	return nil
+}
+
+func (e Enum) MarshalText() ([]byte, error) {
+	return []byte(e.value), nil
+}
+
+func (e *Enum) UnmarshalText(text []byte) error {
+	return e.Set(string(text))
+}
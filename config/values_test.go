@@ -0,0 +1,130 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type valuesConfig struct {
+	Hosts   StringSlice `toml:"hosts" default:"a,b"`
+	Labels  KeyValueMap `toml:"labels"`
+	MaxSize ByteSize    `toml:"max_size" default:"10MiB"`
+	API     URL         `toml:"api" default:"https://api.example.com/v1"`
+	Timeout Duration    `toml:"timeout" default:"5m"`
+	Format  Enum        `toml:"format" default:"json" enum:"json,text"`
+}
+
+func (c *valuesConfig) RegisterFlags(f *flag.FlagSet) {
+	RegisterStructFlags(f, "values", c)
+}
+
+func (c *valuesConfig) Validate() error {
+	return nil
+}
+
+func TestParseByteSize(t *testing.T) {
+	tests := map[string]ByteSize{
+		"1024":   1024,
+		"512B":   512,
+		"1k":     Kibibyte,
+		"10MiB":  10 * Mebibyte,
+		"1.5GiB": 3 * Gibibyte / 2,
+		"2 GB":   2000 * 1000 * 1000,
+	}
+	for in, want := range tests {
+		got, err := ParseByteSize(in)
+		if err != nil || got != want {
+			t.Errorf("ParseByteSize(%q) = %d, %v, want %d", in, got, err, want)
+		}
+	}
+
+	for _, in := range []string{"", "MiB", "10 parsecs", "-1"} {
+		if _, err := ParseByteSize(in); err == nil {
+			t.Errorf("ParseByteSize(%q) expected an error", in)
+		}
+	}
+
+	if s := (10 * Mebibyte).String(); s != "10MiB" {
+		t.Errorf("String() = %q", s)
+	}
+}
+
+func TestValueFlags(t *testing.T) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+
+	var cfg valuesConfig
+	cfg.RegisterFlags(fs)
+	if cfg.MaxSize != 10*Mebibyte || cfg.Timeout.Duration != 5*time.Minute || cfg.Format.Value() != "json" || cfg.API.Host != "api.example.com" {
+		t.Fatalf("defaults = %+v", cfg)
+	}
+
+	err := fs.Parse([]string{
+		"-values.hosts", "c, d",
+		"-values.labels", "team=infra,env=prod",
+		"-values.max-size", "1GiB",
+		"-values.timeout", "30s",
+		"-values.format", "text",
+	})
+	if err != nil {
+		t.Fatalf("Parse() error: %v", err)
+	}
+	if !reflect.DeepEqual(cfg.Hosts, StringSlice{"c", "d"}) || cfg.Labels["env"] != "prod" || cfg.MaxSize != Gibibyte || cfg.Timeout.Duration != 30*time.Second || cfg.Format.Value() != "text" {
+		t.Errorf("parsed = %+v", cfg)
+	}
+
+	if err := fs.Set("values.format", "xml"); err == nil {
+		t.Error("expected a value outside of the enum to be rejected")
+	}
+	if err := fs.Set("values.api", "/relative"); err == nil {
+		t.Error("expected a relative URL to be rejected")
+	}
+}
+
+func TestValuesRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	file := writeFile(t, dir, "config.toml", `hosts = ["a", "b"]
+max_size = "512MiB"
+api = "https://api.example.com/v2"
+timeout = "90s"
+format = "text"
+
+[labels]
+team = "infra"
+`)
+
+	newConfig := func() *valuesConfig {
+		var cfg valuesConfig
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		cfg.RegisterFlags(fs)
+		return &cfg
+	}
+
+	cfg := newConfig()
+	if err := DecodeConfiguration(file, cfg); err != nil {
+		t.Fatalf("DecodeConfiguration() error: %v", err)
+	}
+	if cfg.MaxSize != 512*Mebibyte || cfg.Timeout.Duration != 90*time.Second || cfg.API.Path != "/v2" || cfg.Labels["team"] != "infra" {
+		t.Fatalf("decoded = %+v", cfg)
+	}
+
+	out, err := Dump(cfg)
+	if err != nil {
+		t.Fatalf("Dump() error: %v", err)
+	}
+	dumped := newConfig()
+	if err := DecodeConfiguration(writeFile(t, dir, "dump.toml", string(out)), dumped); err != nil {
+		t.Fatalf("failed to decode the dump %s: %v", out, err)
+	}
+	if !reflect.DeepEqual(cfg, dumped) {
+		t.Errorf("round trip = %+v, want %+v", dumped, cfg)
+	}
+
+	bad := newConfig()
+	if err := DecodeConfiguration(writeFile(t, dir, "bad.toml", "format = \"xml\"\n"), bad); err == nil {
+		t.Error("expected a value outside of the enum to be rejected")
+	}
+}